@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const INCIDENT_ADMISSION = "admission-denied"
+
+const ADMISSION_PROMPT = `Kubernetes could not create pods for %s %s in namespace %s: admission rejected them (%s). No pod exists, so there are no logs. Explain which policy rejected the pod and why, point at the exact field of the pod template that violates it, and suggest the smallest change to the workload (or, if the workload is legitimate, to the policy or namespace) that lets the pod be admitted.
+
+Denial (FailedCreate event):
+%s
+
+Pod template security settings:
+%s
+
+Namespace:
+%s`
+
+// admissionDenials tell admission failures apart by the controller that
+// rejected the pod; the first match wins.
+var admissionDenials = []struct {
+	Category string
+	Pattern  *regexp.Regexp
+}{
+	{"pod-security", regexp.MustCompile(`(?i)violates PodSecurity`)},
+	{"gatekeeper", regexp.MustCompile(`(?i)gatekeeper|\[denied by [^\]]+\]`)},
+	{"kyverno", regexp.MustCompile(`(?i)kyverno`)},
+	{"scc", regexp.MustCompile(`(?i)security context constraint|securitycontextconstraints`)},
+	{"webhook", regexp.MustCompile(`(?i)admission webhook "[^"]+" denied the request`)},
+	{"quota", regexp.MustCompile(`(?i)exceeded quota|must specify (limits|requests)`)},
+	{"limit-range", regexp.MustCompile(`(?i)(maximum|minimum) (cpu|memory|ephemeral-storage) usage per (container|pod)`)},
+	{"forbidden", regexp.MustCompile(`(?i)\bis forbidden\b`)},
+}
+
+// admissionFailure is a controller whose pods are being rejected. It is
+// alerted once and forgotten after resolveAfter without new rejections.
+type admissionFailure struct {
+	Incident *Incident
+	Last     time.Time
+}
+
+var (
+	admissionMu       sync.Mutex
+	admissionFailures = map[string]*admissionFailure{}
+)
+
+// admissionCategory returns what rejected the pod, or "" if the FailedCreate
+// event is not an admission denial.
+func admissionCategory(message string) string {
+	for _, d := range admissionDenials {
+		if d.Pattern.MatchString(message) {
+			return d.Category
+		}
+	}
+	return ""
+}
+
+// watchAdmission alerts on workloads whose pods are rejected at admission.
+// Such pods are never created, so the pod loop cannot see them; the
+// controllers' FailedCreate events are the only trace.
+func watchAdmission(clientset kubernetes.Interface, dyn dynamic.Interface) {
+	started := time.Now()
+	var err error
+	for {
+		time.Sleep(pollDelay("admission", err))
+		err = nil
+		config := cfg()
+
+		for _, ns := range watchedNamespaces(config) {
+			if !allowed(ns, "list", "events") {
+				continue
+			}
+			var events *corev1.EventList
+			events, err = clientset.CoreV1().Events(ns).List(context.Background(), v1.ListOptions{FieldSelector: "reason=FailedCreate"})
+			if err != nil {
+				log.Printf("❌ Error fetching FailedCreate events: %v", err)
+				break
+			}
+			for _, e := range events.Items {
+				if !collector.EventTime(e).After(started) || !config.watchesNamespace(e.Namespace) {
+					continue
+				}
+				category := admissionCategory(e.Message)
+				if category == "" || !ruleFor(e.Namespace).allowsType(INCIDENT_ADMISSION) {
+					continue
+				}
+				key := fmt.Sprintf("%s/%s/%s", e.Namespace, e.InvolvedObject.Kind, e.InvolvedObject.Name)
+				admissionMu.Lock()
+				f, exists := admissionFailures[key]
+				if !exists {
+					f = &admissionFailure{}
+					admissionFailures[key] = f
+				}
+				if collector.EventTime(e).After(f.Last) {
+					f.Last = collector.EventTime(e)
+				}
+				admissionMu.Unlock()
+				if !exists {
+					log.Printf("🛡️ Detected admission denial (%s) for %s %s [%s]", category, e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Namespace)
+					go func(e corev1.Event, category string, f *admissionFailure) {
+						inc := analyzeAdmission(clientset, dyn, e, category)
+						admissionMu.Lock()
+						f.Incident = inc
+						admissionMu.Unlock()
+					}(e, category, f)
+				}
+			}
+		}
+		resolveAdmissions(config)
+	}
+}
+
+// resolveAdmissions forgets the failures that stopped, so a later rejection
+// alerts again.
+func resolveAdmissions(config *Config) {
+	admissionMu.Lock()
+	defer admissionMu.Unlock()
+	for key, f := range admissionFailures {
+		if time.Since(f.Last) < config.ResolveAfter.Duration || f.Incident == nil {
+			continue
+		}
+		log.Printf("✅ No more admission denials for %s", key)
+		incidentsMu.Lock()
+		f.Incident.Resolved = time.Now()
+		incidentsMu.Unlock()
+		delete(admissionFailures, key)
+	}
+}
+
+func analyzeAdmission(clientset kubernetes.Interface, dyn dynamic.Interface, e corev1.Event, category string) *Incident {
+	namespace := e.Namespace
+	config := cfg().forNamespace(namespace).forIncident(INCIDENT_ADMISSION)
+	ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+	defer cancel()
+	ctx = withUsage(ctx, namespace)
+
+	kind, name := e.InvolvedObject.Kind, e.InvolvedObject.Name
+	workload, template := podTemplateOf(ctx, clientset, namespace, kind, name)
+	security := "unavailable"
+	if template != nil {
+		security = describePodSecurity(template)
+	}
+	nsInfo := describeNamespaceAdmission(ctx, clientset, namespace)
+
+	inc := &Incident{
+		ID:        fmt.Sprintf("%s-%s-admission-%d", namespace, name, collector.EventTime(e).Unix()),
+		Type:      INCIDENT_ADMISSION,
+		Severity:  severityOf(INCIDENT_ADMISSION),
+		Namespace: namespace,
+		Pod:       kind + "/" + name,
+		Workload:  workload,
+		Reason:    category,
+		Signature: signatureOf(namespace, workload, INCIDENT_ADMISSION, category),
+		Time:      collector.EventTime(e),
+		Events:    []corev1.Event{e},
+		Resources: security,
+		Language:  config.languageFor(namespace, ruleFor(namespace).slackChannel(config)),
+	}
+	if silence(config, inc) {
+		recordIncident(inc)
+		publishIncident(ctx, dyn, inc)
+		return inc
+	}
+
+	prompt := fmt.Sprintf(ADMISSION_PROMPT, kind, name, namespace, category, e.Message, security, nsInfo) + languageInstruction(inc.Language)
+	analysis, err := callModel(ctx, config, prompt)
+	if err != nil {
+		log.Printf("❌ Failed to analyze admission denial of %s %s: %v", kind, name, err)
+		analysis = fmt.Sprintf("⚠️ *AI analysis unavailable* (%v).\n*Denied by:* %s\n%s", err, category, e.Message)
+	}
+	inc.Analysis = analysis
+	inc.PromptTokens, inc.ResponseTokens = usageOf(ctx)
+
+	channel := config.channelFor(ruleFor(namespace).slackChannel(config))
+	threadTS := postToSlack(map[string]interface{}{
+		"channel": channel,
+		"text":    localized(formatterFor(FORMAT_MRKDWN), inc.Language).Header(viewOf(inc)),
+	})
+	if threadTS != "" {
+		slack := localized(formatterFor(FORMAT_MRKDWN), inc.Language)
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🛡️", Title: "Denial", Body: e.Message}))
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🔐", Title: "Pod template security", Body: security + "\n" + nsInfo}))
+		sendSlackThread(channel, threadTS, slack.Section(analysisSection(analysis)))
+	}
+
+	inc.Channel, inc.ThreadTS = channel, threadTS
+	recordIncident(inc)
+	publishIncident(ctx, dyn, inc)
+	notify(config, inc)
+	return inc
+}
+
+// podTemplateOf returns the workload a controller belongs to and the pod
+// template it tries to create pods from.
+func podTemplateOf(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) (string, *corev1.PodSpec) {
+	switch kind {
+	case "ReplicaSet":
+		rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return name, nil
+		}
+		workload := name
+		for _, ref := range rs.OwnerReferences {
+			if ref.Controller != nil && *ref.Controller {
+				workload = ref.Name
+			}
+		}
+		return workload, &rs.Spec.Template.Spec
+	case "StatefulSet":
+		if sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, v1.GetOptions{}); err == nil {
+			return name, &sts.Spec.Template.Spec
+		}
+	case "DaemonSet":
+		if ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, v1.GetOptions{}); err == nil {
+			return name, &ds.Spec.Template.Spec
+		}
+	case "Job":
+		if job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, v1.GetOptions{}); err == nil {
+			for _, ref := range job.OwnerReferences {
+				if ref.Kind == "CronJob" {
+					return ref.Name, &job.Spec.Template.Spec
+				}
+			}
+			return name, &job.Spec.Template.Spec
+		}
+	}
+	return name, nil
+}
+
+// describePodSecurity lists the settings of a pod template that admission
+// policies usually check.
+func describePodSecurity(spec *corev1.PodSpec) string {
+	var lines []string
+	if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		lines = append(lines, fmt.Sprintf("hostNetwork=%t hostPID=%t hostIPC=%t", spec.HostNetwork, spec.HostPID, spec.HostIPC))
+	}
+	if sc := spec.SecurityContext; sc != nil {
+		lines = append(lines, "pod securityContext: "+describeSecurity(sc.RunAsNonRoot, sc.RunAsUser, sc.SeccompProfile, nil, nil, nil, nil))
+	}
+	if spec.ServiceAccountName != "" {
+		lines = append(lines, "serviceAccountName: "+spec.ServiceAccountName)
+	}
+	for _, v := range spec.Volumes {
+		if v.HostPath != nil {
+			lines = append(lines, fmt.Sprintf("volume %s: hostPath %s", v.Name, v.HostPath.Path))
+		}
+	}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		line := fmt.Sprintf("container %s (image %s)", c.Name, c.Image)
+		if sc := c.SecurityContext; sc != nil {
+			line += ": " + describeSecurity(sc.RunAsNonRoot, sc.RunAsUser, sc.SeccompProfile, sc.Privileged, sc.AllowPrivilegeEscalation, sc.ReadOnlyRootFilesystem, sc.Capabilities)
+		} else {
+			line += ": no securityContext"
+		}
+		for _, p := range c.Ports {
+			if p.HostPort != 0 {
+				line += fmt.Sprintf(", hostPort %d", p.HostPort)
+			}
+		}
+		if len(c.Resources.Limits) == 0 {
+			line += ", no resource limits"
+		}
+		if len(c.Resources.Requests) == 0 {
+			line += ", no resource requests"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func describeSecurity(nonRoot *bool, user *int64, seccomp *corev1.SeccompProfile, privileged, escalation, readOnly *bool, caps *corev1.Capabilities) string {
+	var parts []string
+	flag := func(name string, v *bool) {
+		if v != nil {
+			parts = append(parts, fmt.Sprintf("%s=%t", name, *v))
+		}
+	}
+	flag("runAsNonRoot", nonRoot)
+	if user != nil {
+		parts = append(parts, fmt.Sprintf("runAsUser=%d", *user))
+	}
+	if seccomp != nil {
+		parts = append(parts, "seccompProfile="+string(seccomp.Type))
+	}
+	flag("privileged", privileged)
+	flag("allowPrivilegeEscalation", escalation)
+	flag("readOnlyRootFilesystem", readOnly)
+	if caps != nil {
+		if len(caps.Add) > 0 {
+			parts = append(parts, fmt.Sprintf("capabilities.add=%v", caps.Add))
+		}
+		if len(caps.Drop) > 0 {
+			parts = append(parts, fmt.Sprintf("capabilities.drop=%v", caps.Drop))
+		}
+	}
+	if len(parts) == 0 {
+		return "empty"
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeNamespaceAdmission reports the namespace's Pod Security Admission
+// levels.
+func describeNamespaceAdmission(ctx context.Context, clientset kubernetes.Interface, namespace string) string {
+	if !allowed("", "get", "namespaces") {
+		return "unknown (the service account may not get namespaces)"
+	}
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
+	if err != nil {
+		return fmt.Sprintf("unknown: %v", err)
+	}
+	var lines []string
+	for key, value := range ns.Labels {
+		if strings.HasPrefix(key, "pod-security.kubernetes.io/") {
+			lines = append(lines, key+"="+value)
+		}
+	}
+	if len(lines) == 0 {
+		return "no pod-security.kubernetes.io labels (the cluster default level applies)"
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
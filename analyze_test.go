@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// recordingSlack is a SlackClient that keeps every call instead of posting.
+type recordingSlack struct {
+	mu    sync.Mutex
+	calls []map[string]interface{}
+}
+
+func (s *recordingSlack) Call(method string, payload map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payload["method"] = method
+	s.calls = append(s.calls, payload)
+	if ts, ok := payload["thread_ts"].(string); ok {
+		return ts
+	}
+	return "1700000000.000100"
+}
+
+// text joins the text of every message posted so far.
+func (s *recordingSlack) text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var texts []string
+	for _, call := range s.calls {
+		text, _ := call["text"].(string)
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// setup installs the config and a recording Slack client for one test, with
+// no crash-loop threads left over from earlier ones.
+func setup(t *testing.T, config string) *recordingSlack {
+	t.Helper()
+	c, err := parseConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack := &recordingSlack{}
+	configMu.Lock()
+	previous, previousSlack := currentConfig, slackClient
+	currentConfig, slackClient = c, slack
+	configMu.Unlock()
+	threadsMu.Lock()
+	threads = map[string]*slackThread{}
+	threadsMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		currentConfig, slackClient = previous, previousSlack
+		configMu.Unlock()
+	})
+	return slack
+}
+
+// crashingPod is a pod whose only container just terminated and is now in
+// CrashLoopBackOff, with the back-off event the kubelet records for it.
+func crashingPod(name string, terminated corev1.ContainerStateTerminated) (*corev1.Pod, []runtime.Object) {
+	finished := time.Now().Add(-time.Minute)
+	terminated.FinishedAt = v1.NewTime(finished)
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "shop", UID: types.UID("uid-" + name)},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Image: "registry.example.com/shop/api:1.2.3",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+		}}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "app",
+				RestartCount:         3,
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &terminated},
+			}},
+		},
+	}
+	backoff := &corev1.Event{
+		ObjectMeta:     v1.ObjectMeta{Name: name + ".backoff", Namespace: "shop"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: name, Namespace: "shop", FieldPath: "spec.containers{app}"},
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container app",
+		Type:           corev1.EventTypeWarning,
+		LastTimestamp:  v1.NewTime(finished),
+	}
+	return pod, []runtime.Object{pod, backoff}
+}
+
+func TestAnalyzePodHeuristics(t *testing.T) {
+	slack := setup(t, "slackChannel: '#alerts'\ncorrelation:\n  enabled: false\n")
+	pod, objects := crashingPod("api-oom", corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"})
+	clientset := fake.NewSimpleClientset(objects...)
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	cs := pod.Status.ContainerStatuses[0]
+	inc := analyzePod(clientset, dyn, *pod, cs, cs.LastTerminationState.Terminated.FinishedAt.Time)
+	if inc == nil {
+		t.Fatal("analyzePod returned no incident")
+	}
+	if inc.Category != "oom" || inc.PromptVersion != PROMPT_HEURISTICS || inc.Reason != "OOMKilled" {
+		t.Errorf("incident = category %q, prompt version %q, reason %q; want an OOM found by the heuristics", inc.Category, inc.PromptVersion, inc.Reason)
+	}
+	if !strings.Contains(slack.text(), "exceeded its memory limit of 256Mi") {
+		t.Errorf("Slack messages do not explain the OOM kill:\n%s", slack.text())
+	}
+	if !strings.Contains(slack.text(), "Back-off restarting failed container") {
+		t.Errorf("Slack messages do not include the pod's events:\n%s", slack.text())
+	}
+	if slack.calls[0]["channel"] != "#alerts" {
+		t.Errorf("alert went to %v, want #alerts", slack.calls[0]["channel"])
+	}
+
+	events, _ := clientset.CoreV1().Events("shop").List(context.Background(), v1.ListOptions{})
+	found := false
+	for _, e := range events.Items {
+		found = found || e.Reason == collector.DIAGNOSIS_EVENT_REASON && e.InvolvedObject.Name == pod.Name
+	}
+	if !found {
+		t.Error("no diagnosis event was attached to the pod")
+	}
+}
+
+func TestAnalyzePodModel(t *testing.T) {
+	var prompt string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		var req struct {
+			Prompt string      `json:"prompt"`
+			Format interface{} `json:"format"`
+		}
+		json.Unmarshal(raw, &req)
+		prompt = req.Prompt
+		if req.Format == nil {
+			t.Error("structured output was not requested")
+		}
+		answer, _ := json.Marshal(map[string]interface{}{
+			"root_cause":         "The payment gateway rejects the API key.",
+			"category":           "dependency",
+			"confidence":         0.7,
+			"explanation":        "The container exits right after the gateway answers 401.",
+			"suggested_commands": []string{"kubectl -n shop get secret payment-gateway"},
+			"needs_human":        false,
+		})
+		json.NewEncoder(w).Encode(map[string]interface{}{"response": string(answer), "prompt_eval_count": 900, "eval_count": 60})
+	}))
+	defer ollama.Close()
+
+	slack := setup(t, "slackChannel: '#alerts'\nheuristics: false\nstructuredOutput: true\nollamaAPI: "+ollama.URL+"\ncorrelation:\n  enabled: false\n")
+	pod, objects := crashingPod("api-model", corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"})
+	clientset := fake.NewSimpleClientset(objects...)
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	cs := pod.Status.ContainerStatuses[0]
+	inc := analyzePod(clientset, dyn, *pod, cs, cs.LastTerminationState.Terminated.FinishedAt.Time)
+	if inc == nil {
+		t.Fatal("analyzePod returned no incident")
+	}
+	// The fake clientset answers every log request with "fake logs".
+	for _, want := range []string{"fake logs", "Back-off restarting failed container", "256Mi"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+	if inc.Category != "dependency" || inc.RootCause != "The payment gateway rejects the API key." {
+		t.Errorf("incident = category %q, root cause %q; want the model's answer", inc.Category, inc.RootCause)
+	}
+	if inc.PromptTokens != 900 || inc.ResponseTokens != 60 {
+		t.Errorf("usage = %d/%d tokens, want 900/60", inc.PromptTokens, inc.ResponseTokens)
+	}
+	if !strings.Contains(slack.text(), "kubectl -n shop get secret payment-gateway") {
+		t.Errorf("Slack messages do not include the model's analysis:\n%s", slack.text())
+	}
+}
+
+func TestAnalyzePodFakeModel(t *testing.T) {
+	setup(t, "heuristics: false\ncorrelation:\n  enabled: false\n")
+	modelOverride = cannedModel{}
+	defer func() { modelOverride = nil }()
+
+	pod, objects := crashingPod("api-canned", corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"})
+	cs := pod.Status.ContainerStatuses[0]
+	inc := analyzePod(fake.NewSimpleClientset(objects...), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), *pod, cs, cs.LastTerminationState.Terminated.FinishedAt.Time)
+	if inc == nil || !strings.HasPrefix(inc.Analysis, "Canned analysis (--fake-model)") {
+		t.Fatalf("incident = %+v, want the canned analysis", inc)
+	}
+}
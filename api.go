@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const API_LIST_LIMIT = 100
+
+type incidentSummary struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Severity  string     `json:"severity,omitempty"`
+	Namespace string     `json:"namespace"`
+	Pod       string     `json:"pod"`
+	Workload  string     `json:"workload"`
+	Container string     `json:"container,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	ExitCode  int32      `json:"exitCode,omitempty"`
+	Category  string     `json:"category,omitempty"`
+	Signature string     `json:"signature"`
+	Time      time.Time  `json:"time"`
+	Resolved  *time.Time `json:"resolved,omitempty"`
+	Restarts  int        `json:"restarts,omitempty"`
+	Changes   []string   `json:"changes,omitempty"`
+	Runbooks  []string   `json:"runbooks,omitempty"`
+	SlackTS   string     `json:"slackTS,omitempty"`
+	GroupID   string     `json:"groupId,omitempty"`
+
+	RootCause  string  `json:"rootCause,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	NeedsHuman bool    `json:"needsHuman,omitempty"`
+
+	PromptTokens   int `json:"promptTokens,omitempty"`
+	ResponseTokens int `json:"responseTokens,omitempty"`
+
+	PromptVersion string `json:"promptVersion,omitempty"`
+	FeedbackUp    int    `json:"feedbackUp,omitempty"`
+	FeedbackDown  int    `json:"feedbackDown,omitempty"`
+}
+
+type incidentDetail struct {
+	incidentSummary
+	Events    []string `json:"events"`
+	Resources string   `json:"resources"`
+	Logs      string   `json:"logs"`
+	Analysis  string   `json:"analysis"`
+}
+
+// summarize must be called with incidentsMu held.
+func summarize(i *Incident) incidentSummary {
+	s := incidentSummary{
+		ID:        i.ID,
+		Type:      i.Type,
+		Severity:  i.Severity,
+		Namespace: i.Namespace,
+		Pod:       i.Pod,
+		Workload:  i.Workload,
+		Container: i.Container,
+		Reason:    i.Reason,
+		ExitCode:  i.ExitCode,
+		Category:  i.Category,
+		Signature: i.Signature,
+		Time:      i.Time,
+		Restarts:  i.Restarts,
+		Changes:   i.Changes,
+		Runbooks:  runbookURLs(i.Runbooks),
+		SlackTS:   i.ThreadTS,
+		GroupID:   i.GroupID,
+
+		RootCause:  i.RootCause,
+		Confidence: i.Confidence,
+		NeedsHuman: i.NeedsHuman,
+
+		PromptTokens:   i.PromptTokens,
+		ResponseTokens: i.ResponseTokens,
+
+		PromptVersion: i.PromptVersion,
+	}
+	t := i.tally()
+	s.FeedbackUp, s.FeedbackDown = t.Up, t.Down
+	if !i.Resolved.IsZero() {
+		resolved := i.Resolved
+		s.Resolved = &resolved
+	}
+	return s
+}
+
+// detailOf must be called with incidentsMu held.
+func detailOf(i *Incident) incidentDetail {
+	events := []string{}
+	for _, line := range strings.Split(collector.FormatEvents(i.Events), "\n") {
+		if line != "" {
+			events = append(events, line)
+		}
+	}
+	return incidentDetail{
+		incidentSummary: summarize(i),
+		Events:          events,
+		Resources:       i.Resources,
+		Logs:            i.Logs,
+		Analysis:        i.Analysis,
+	}
+}
+
+// requireToken guards the API with the bearer token from API_TOKEN. The API
+// is disabled when no token is configured.
+func requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("API_TOKEN")
+		if token == "" {
+			http.Error(w, "API disabled: API_TOKEN is not set", http.StatusNotFound)
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type apiTenantKey struct{}
+
+// requireAPIToken guards the incidents API. It accepts API_TOKEN and the
+// tokens of tenants with apiTokenEnv; a tenant's token only reaches the
+// tenant's namespaces. The API is disabled when no token is configured.
+func requireAPIToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokens := apiTokens()
+		if len(tokens) == 0 {
+			http.Error(w, "API disabled: API_TOKEN is not set", http.StatusNotFound)
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for tenant, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+				h(w, r.WithContext(context.WithValue(r.Context(), apiTenantKey{}, tenant)))
+				return
+			}
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// apiMayRead reports whether the caller's token reaches the namespace.
+func apiMayRead(r *http.Request, namespace string) bool {
+	tenant, _ := r.Context().Value(apiTenantKey{}).(string)
+	return tenant == "" || tenantFor(cfg(), namespace) == tenant
+}
+
+// handleIncidents serves GET /incidents, filtered by the namespace, type,
+// workload and since query parameters, newest first.
+func handleIncidents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	since := time.Time{}
+	if s := q.Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "since must be a duration like 24h", http.StatusBadRequest)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+	limit := API_LIST_LIMIT
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	var matched []incidentSummary
+	incidentsMu.Lock()
+	for _, i := range incidents {
+		if !i.Time.After(since) ||
+			(q.Get("namespace") != "" && i.Namespace != q.Get("namespace")) ||
+			(q.Get("type") != "" && i.Type != q.Get("type")) ||
+			(q.Get("workload") != "" && i.Workload != q.Get("workload")) {
+			continue
+		}
+		matched = append(matched, summarize(i))
+	}
+	incidentsMu.Unlock()
+	// Tenants are looked up outside the lock, as that may ask the API server.
+	list := []incidentSummary{}
+	for _, i := range matched {
+		if apiMayRead(r, i.Namespace) {
+			list = append(list, i)
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Time.After(list[b].Time) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+var formatContentTypes = map[string]string{
+	FORMAT_MRKDWN:   "text/plain; charset=utf-8",
+	FORMAT_MARKDOWN: "text/markdown; charset=utf-8",
+	FORMAT_TEXT:     "text/plain; charset=utf-8",
+	FORMAT_HTML:     "text/html; charset=utf-8",
+}
+
+// handleIncident serves GET /incidents/{id} with the full collected context,
+// as JSON or, with ?format=, rendered as a document.
+func handleIncident(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/incidents/")
+	format := r.URL.Query().Get("format")
+	f := formatterFor(format)
+	if format != "" && f == nil {
+		http.Error(w, "unknown format, use mrkdwn, markdown, text or html", http.StatusBadRequest)
+		return
+	}
+
+	var detail *incidentDetail
+	var rendered string
+	incidentsMu.Lock()
+	for _, i := range incidents {
+		if i.ID == id {
+			d := detailOf(i)
+			detail = &d
+			if f != nil {
+				rendered = f.Document(viewOf(i))
+			}
+		}
+	}
+	incidentsMu.Unlock()
+	if detail == nil || !apiMayRead(r, detail.Namespace) {
+		http.Error(w, "incident not found", http.StatusNotFound)
+		return
+	}
+	if f != nil {
+		w.Header().Set("Content-Type", formatContentTypes[format])
+		w.Write([]byte(rendered))
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// handleAnalyze serves POST /analyze: it runs the full analysis for a pod on
+// demand and returns it. Like an analysis asked for from Slack, it is not
+// posted, stored, paged or counted as an incident.
+func handleAnalyze(clientset kubernetes.Interface, dyn dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Namespace string `json:"namespace"`
+			Pod       string `json:"pod"`
+			Container string `json:"container"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Namespace == "" || req.Pod == "" {
+			http.Error(w, `expected {"namespace": "...", "pod": "...", "container": "..."}`, http.StatusBadRequest)
+			return
+		}
+		if !cfg().watchesNamespace(req.Namespace) || !apiMayRead(r, req.Namespace) || !allowed(req.Namespace, "get", "pods") {
+			http.Error(w, fmt.Sprintf("namespace %s is not watched by the analyzer or not covered by this token", req.Namespace), http.StatusForbidden)
+			return
+		}
+
+		pod, err := clientset.CoreV1().Pods(req.Namespace).Get(r.Context(), req.Pod, v1.GetOptions{})
+		if err != nil {
+			log.Printf("⚠️ On-demand analysis: failed to get pod %s [%s]: %v", req.Pod, req.Namespace, err)
+			switch {
+			case errors.IsNotFound(err):
+				http.Error(w, fmt.Sprintf("pod %s not found in %s", req.Pod, req.Namespace), http.StatusNotFound)
+			case errors.IsForbidden(err):
+				http.Error(w, fmt.Sprintf("the analyzer may not get pods in %s", req.Namespace), http.StatusForbidden)
+			case errors.IsTimeout(err) || errors.IsServerTimeout(err) || r.Context().Err() != nil:
+				http.Error(w, "timed out getting the pod", http.StatusGatewayTimeout)
+			default:
+				http.Error(w, "failed to get the pod from the API server", http.StatusBadGateway)
+			}
+			return
+		}
+		cs, ok := pickContainer(pod, req.Container)
+		if !ok {
+			http.Error(w, fmt.Sprintf("container %q not found in pod %s", req.Container, req.Pod), http.StatusNotFound)
+			return
+		}
+		restartTime := time.Now()
+		if t := cs.LastTerminationState.Terminated; t != nil && !t.FinishedAt.IsZero() {
+			restartTime = t.FinishedAt.Time
+		}
+
+		log.Printf("🌐 On-demand analysis of %s [%s] via API", req.Pod, req.Namespace)
+		// An empty reply has no Slack thread: the analysis is only returned.
+		inc := analyzePodFor(clientset, dyn, *pod, cs, restartTime, &slackReply{})
+		if inc == nil {
+			http.Error(w, "analysis skipped (excluded by a PodAnalyzerRule, or the pod's events could not be read)", http.StatusConflict)
+			return
+		}
+		incidentsMu.Lock()
+		detail := detailOf(inc)
+		incidentsMu.Unlock()
+		writeJSON(w, http.StatusOK, detail)
+	}
+}
+
+// pickContainer returns the named container, or the one with the most
+// restarts if no name is given.
+func pickContainer(pod *corev1.Pod, name string) (corev1.ContainerStatus, bool) {
+	var picked corev1.ContainerStatus
+	found := false
+	for _, cs := range pod.Status.ContainerStatuses {
+		if name != "" {
+			if cs.Name == name {
+				return cs, true
+			}
+			continue
+		}
+		if !found || cs.RestartCount > picked.RestartCount {
+			picked, found = cs, true
+		}
+	}
+	return picked, found
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghulevishal/pod-analyzer/internal/notifier"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHandleAnalyze(t *testing.T) {
+	slack := setup(t, "excludeNamespaces: [kube-system]\ncorrelation:\n  enabled: false\n")
+	_, objects := crashingPod("api-on-demand", corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"})
+	handler := handleAnalyze(fake.NewSimpleClientset(objects...), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()))
+
+	tests := []struct {
+		name, method, body string
+		status             int
+	}{
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+		{"no pod", "POST", `{"namespace": "shop"}`, http.StatusBadRequest},
+		{"excluded namespace", "POST", `{"namespace": "kube-system", "pod": "coredns-0"}`, http.StatusForbidden},
+		{"missing pod", "POST", `{"namespace": "shop", "pod": "api-gone"}`, http.StatusNotFound},
+		{"missing container", "POST", `{"namespace": "shop", "pod": "api-on-demand", "container": "sidecar"}`, http.StatusNotFound},
+		{"analyzed", "POST", `{"namespace": "shop", "pod": "api-on-demand"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(tt.method, "/analyze", strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body.String())
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var detail incidentDetail
+		if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil {
+			t.Fatal(err)
+		}
+		if detail.Container != "app" || detail.Category != "oom" || !strings.Contains(detail.Analysis, "256Mi") {
+			t.Errorf("%s: detail = %+v, want the OOM analysis of container app", tt.name, detail)
+		}
+	}
+	if len(slack.calls) > 0 {
+		t.Errorf("an on-demand analysis posted to Slack: %v", slack.calls)
+	}
+}
+
+func TestWebSlack(t *testing.T) {
+	var auth string
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/chat.update" {
+			w.Write([]byte(`{"ok": false, "error": "message_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true, "ts": "1700000000.000200"}`))
+	}))
+	defer srv.Close()
+
+	setup(t, "")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	slack := webSlack{api: &notifier.Slack{BaseURL: srv.URL}}
+
+	if ts := slack.Call("chat.postMessage", map[string]interface{}{"channel": "#alerts", "text": "hi"}); ts != "1700000000.000200" {
+		t.Errorf("ts = %q", ts)
+	}
+	if auth != "Bearer xoxb-test" || body["channel"] != "#alerts" {
+		t.Errorf("request: Authorization %q, body %v", auth, body)
+	}
+	if ts := slack.Call("chat.update", map[string]interface{}{"channel": "#alerts", "ts": "1", "text": "hi"}); ts != "" {
+		t.Errorf("failed update returned ts %q", ts)
+	}
+
+	t.Setenv("SLACK_BOT_TOKEN", "")
+	auth = ""
+	if ts := slack.Call("chat.postMessage", map[string]interface{}{"channel": "#alerts", "text": "hi"}); ts != "" || auth != "" {
+		t.Error("posted to Slack without a token")
+	}
+}
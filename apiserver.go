@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	MAX_POLL_BACKOFF   = 5 * time.Minute
+	POLL_JITTER        = 0.1
+	CLIENT_WAIT_NOTICE = time.Second
+)
+
+var (
+	kubeQPS   = flag.Float64("kube-qps", 20, "maximum queries per second to the API server")
+	kubeBurst = flag.Int("kube-burst", 40, "maximum burst of queries to the API server")
+)
+
+// API server health, exported as self-health metrics.
+var (
+	apiMu              sync.Mutex
+	apiRequests        int
+	apiErrors          int
+	apiThrottled       int
+	apiClientWaits     int
+	apiClientWaitTotal time.Duration
+	pollFailures       = map[string]int{}
+	pollBackoffs       = map[string]time.Duration{}
+	pollSucceeded      = map[string]time.Time{}
+	pollErrors         = map[string]string{}
+)
+
+// throttledRateLimiter counts how often and how long requests waited for the
+// client-side rate limiter.
+type throttledRateLimiter struct {
+	flowcontrol.RateLimiter
+}
+
+func (l throttledRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.RateLimiter.Wait(ctx)
+	l.observe(time.Since(start))
+	return err
+}
+
+func (l throttledRateLimiter) Accept() {
+	start := time.Now()
+	l.RateLimiter.Accept()
+	l.observe(time.Since(start))
+}
+
+func (l throttledRateLimiter) observe(waited time.Duration) {
+	if waited < 10*time.Millisecond {
+		return
+	}
+	apiMu.Lock()
+	apiClientWaits++
+	apiClientWaitTotal += waited
+	apiMu.Unlock()
+	if waited >= CLIENT_WAIT_NOTICE {
+		log.Printf("🐢 Waited %s for the client-side rate limit (--kube-qps %g, --kube-burst %d)", waited.Round(time.Millisecond), *kubeQPS, *kubeBurst)
+	}
+}
+
+// countingTransport counts API server responses, in particular 429s that
+// mean the server is throttling the analyzer.
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	apiMu.Lock()
+	apiRequests++
+	switch {
+	case err != nil || resp.StatusCode >= 500:
+		apiErrors++
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiThrottled++
+	}
+	apiMu.Unlock()
+	return resp, err
+}
+
+// configureAPIClient applies the QPS and burst flags and instruments the
+// client for the self-health metrics. In read-only mode, writes are refused
+// before they reach the server.
+func configureAPIClient(config *rest.Config) {
+	config.QPS = float32(*kubeQPS)
+	config.Burst = *kubeBurst
+	config.RateLimiter = throttledRateLimiter{flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst)}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return countingTransport{next: rt}
+	})
+	if *readOnly {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return readOnlyTransport{next: rt}
+		})
+	}
+}
+
+// pollDelay returns how long a poll loop waits before its next round: the
+// check interval with jitter after a success, and an exponential backoff
+// after consecutive failures, at least as long as the server asked for.
+func pollDelay(loop string, err error) time.Duration {
+	interval := cfg().CheckInterval.Duration
+	apiMu.Lock()
+	defer apiMu.Unlock()
+	if err == nil {
+		if pollFailures[loop] > 0 {
+			log.Printf("✅ %s recovered after %d failed attempt(s)", loop, pollFailures[loop])
+		}
+		pollFailures[loop], pollBackoffs[loop] = 0, 0
+		pollSucceeded[loop], pollErrors[loop] = time.Now(), ""
+		return jitter(interval)
+	}
+
+	pollErrors[loop] = err.Error()
+
+	pollFailures[loop]++
+	delay := interval
+	for i := 1; i < pollFailures[loop] && delay < MAX_POLL_BACKOFF; i++ {
+		delay *= 2
+	}
+	if delay > MAX_POLL_BACKOFF {
+		delay = MAX_POLL_BACKOFF
+	}
+	delay = jitter(delay)
+	if seconds, ok := errors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > delay {
+		delay = time.Duration(seconds) * time.Second
+	}
+	if errors.IsTooManyRequests(err) {
+		log.Printf("🐢 API server is throttling %s, backing off for %s", loop, delay.Round(time.Second))
+	}
+	pollBackoffs[loop] = delay
+	return delay
+}
+
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (1 + POLL_JITTER*(2*rand.Float64()-1)))
+}
+
+func writeAPIMetrics(b *strings.Builder) {
+	apiMu.Lock()
+	defer apiMu.Unlock()
+	b.WriteString("# HELP pod_analyzer_apiserver_requests_total Requests sent to the API server.\n")
+	b.WriteString("# TYPE pod_analyzer_apiserver_requests_total counter\n")
+	fmt.Fprintf(b, "pod_analyzer_apiserver_requests_total %d\n", apiRequests)
+	b.WriteString("# HELP pod_analyzer_apiserver_errors_total API server requests that failed or returned 5xx.\n")
+	b.WriteString("# TYPE pod_analyzer_apiserver_errors_total counter\n")
+	fmt.Fprintf(b, "pod_analyzer_apiserver_errors_total %d\n", apiErrors)
+	b.WriteString("# HELP pod_analyzer_apiserver_throttled_total API server responses with 429 Too Many Requests.\n")
+	b.WriteString("# TYPE pod_analyzer_apiserver_throttled_total counter\n")
+	fmt.Fprintf(b, "pod_analyzer_apiserver_throttled_total %d\n", apiThrottled)
+	b.WriteString("# HELP pod_analyzer_client_throttled_total Requests delayed by the client-side rate limiter.\n")
+	b.WriteString("# TYPE pod_analyzer_client_throttled_total counter\n")
+	fmt.Fprintf(b, "pod_analyzer_client_throttled_total %d\n", apiClientWaits)
+	b.WriteString("# HELP pod_analyzer_client_throttled_seconds_total Time spent waiting for the client-side rate limiter.\n")
+	b.WriteString("# TYPE pod_analyzer_client_throttled_seconds_total counter\n")
+	fmt.Fprintf(b, "pod_analyzer_client_throttled_seconds_total %g\n", apiClientWaitTotal.Seconds())
+
+	loops := make([]string, 0, len(pollFailures))
+	for l := range pollFailures {
+		loops = append(loops, l)
+	}
+	sort.Strings(loops)
+	b.WriteString("# HELP pod_analyzer_poll_consecutive_failures Consecutive failed rounds of a poll loop.\n")
+	b.WriteString("# TYPE pod_analyzer_poll_consecutive_failures gauge\n")
+	for _, l := range loops {
+		fmt.Fprintf(b, "pod_analyzer_poll_consecutive_failures{loop=%q} %d\n", l, pollFailures[l])
+	}
+	b.WriteString("# HELP pod_analyzer_poll_backoff_seconds Current backoff of a poll loop; 0 when healthy.\n")
+	b.WriteString("# TYPE pod_analyzer_poll_backoff_seconds gauge\n")
+	for _, l := range loops {
+		fmt.Fprintf(b, "pod_analyzer_poll_backoff_seconds{loop=%q} %g\n", l, pollBackoffs[l].Seconds())
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ARCHIVE_S3  = "s3"
+	ARCHIVE_GCS = "gcs"
+
+	GCS_ENDPOINT    = "https://storage.googleapis.com"
+	ARCHIVE_TIMEOUT = 30 * time.Second
+)
+
+// ArchiveConfig selects the bucket completed incidents are written to. GCS
+// is written through its S3-compatible XML API with HMAC keys.
+type ArchiveConfig struct {
+	Provider string `json:"provider"`
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix"`
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint"`
+}
+
+// ArchiveNotifier writes each incident as JSON (logs, events and analysis
+// included) to object storage, under a date-partitioned key so the archive
+// can be queried by day. The object is rewritten when the incident
+// resolves. Credentials come from ARCHIVE_ACCESS_KEY_ID and
+// ARCHIVE_SECRET_ACCESS_KEY, or the usual AWS_* variables.
+type ArchiveNotifier struct {
+	config ArchiveConfig
+}
+
+func (n *ArchiveNotifier) Name() string {
+	return "archive"
+}
+
+func (n *ArchiveNotifier) Notify(inc *Incident) error {
+	return n.archive(inc)
+}
+
+func (n *ArchiveNotifier) Update(inc *Incident) error {
+	return n.archive(inc)
+}
+
+// Resolve rewrites every incident of the signature, since the resolution
+// closes them all.
+func (n *ArchiveNotifier) Resolve(inc *Incident) error {
+	incidentsMu.Lock()
+	var list []*Incident
+	for _, i := range incidents {
+		if i.Signature == inc.Signature && !i.Resolved.IsZero() {
+			list = append(list, i)
+		}
+	}
+	incidentsMu.Unlock()
+	for _, i := range list {
+		if err := n.archive(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ArchiveNotifier) archive(inc *Incident) error {
+	incidentsMu.Lock()
+	body, err := json.MarshalIndent(detailOf(inc), "", "  ")
+	incidentsMu.Unlock()
+	if err != nil {
+		return err
+	}
+	key := archiveKey(n.config.Prefix, inc)
+	if *dryRun {
+		fmt.Printf("----- [dry-run] archive %s/%s (%d bytes)\n", n.config.Bucket, key, len(body))
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ARCHIVE_TIMEOUT)
+	defer cancel()
+	return n.put(ctx, key, outbound("archive", n.config.Bucket+"/"+key, body))
+}
+
+// archiveKey partitions the archive by the incident's day, Hive-style, so
+// query engines can prune by date.
+func archiveKey(prefix string, inc *Incident) string {
+	t := inc.Time.UTC()
+	key := fmt.Sprintf("year=%04d/month=%02d/day=%02d/%s.json", t.Year(), t.Month(), t.Day(), inc.ID)
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		key = prefix + "/" + key
+	}
+	return key
+}
+
+// put uploads an object with a SigV4-signed PUT, which both S3 and GCS's
+// interoperability API accept.
+func (n *ArchiveNotifier) put(ctx context.Context, key string, body []byte) error {
+	accessKey, secretKey := os.Getenv("ARCHIVE_ACCESS_KEY_ID"), os.Getenv("ARCHIVE_SECRET_ACCESS_KEY")
+	if accessKey == "" {
+		accessKey, secretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("no credentials: set ARCHIVE_ACCESS_KEY_ID and ARCHIVE_SECRET_ACCESS_KEY")
+	}
+
+	region, endpoint := n.config.Region, n.config.Endpoint
+	if n.config.Provider == ARCHIVE_GCS {
+		if region == "" {
+			region = "auto"
+		}
+		if endpoint == "" {
+			endpoint = GCS_ENDPOINT
+		}
+	} else if region == "" {
+		region = "us-east-1"
+	}
+	var target string
+	if endpoint == "" {
+		target = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", n.config.Bucket, region, sigv4Escape(key))
+	} else {
+		target = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), n.config.Bucket, sigv4Escape(key))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" && os.Getenv("ARCHIVE_ACCESS_KEY_ID") == "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, body, accessKey, secretKey, region, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("PUT %s: %s: %s", target, resp.Status, truncate(string(respBody), 200))
+	}
+	return nil
+}
+
+// signV4 signs a request for the "s3" service with AWS Signature Version 4.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sigv4Escape percent-encodes everything but unreserved characters and
+// slashes, as SigV4 expects object keys in the canonical path.
+func sigv4Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	AUDIT_RETENTION   = 30 * 24 * time.Hour
+	AUDIT_PRUNE_EVERY = time.Hour
+	REDACTED          = "[REDACTED]"
+)
+
+// AuditConfig controls the record of every payload sent off-cluster (model,
+// Slack, email, issue trackers) and the redaction applied to it first.
+type AuditConfig struct {
+	Enabled        bool        `json:"enabled"`
+	Path           string      `json:"path"`
+	Retention      v1.Duration `json:"retention"`
+	Redact         bool        `json:"redact"`
+	RedactPatterns []string    `json:"redactPatterns"`
+}
+
+// auditRecord describes one outbound payload. The payload itself is not
+// kept, only its hash, so a copy can be matched against the record later.
+type auditRecord struct {
+	Time        time.Time      `json:"time"`
+	Destination string         `json:"destination"`
+	Target      string         `json:"target"`
+	SHA256      string         `json:"sha256"`
+	Bytes       int            `json:"bytes"`
+	Redactions  map[string]int `json:"redactions,omitempty"`
+}
+
+type redaction struct {
+	name    string
+	pattern *regexp.Regexp
+	replace string
+}
+
+// Credentials that commonly end up in logs and environment dumps. The
+// key=value pattern also matches JSON-escaped quotes, since it is applied to
+// encoded request bodies.
+var defaultRedactions = []redaction{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), REDACTED},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`), "Bearer " + REDACTED},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), REDACTED},
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), REDACTED},
+	{"credential", regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)(\\?["']?\s*[:=]\s*\\?["']?)[^\s"'\\,;&]+`), "${1}${2}" + REDACTED},
+	{"url-password", regexp.MustCompile(`(://[^/\s:@"\\]+:)[^/\s@"\\]+@`), "${1}" + REDACTED + "@"},
+}
+
+var (
+	auditMu     sync.Mutex
+	auditLog    []auditRecord
+	auditPruned time.Time
+
+	customRedactionsMu  sync.Mutex
+	customRedactionsSrc []string
+	customRedactions    []redaction
+)
+
+// redactions returns the default patterns plus the configured ones, compiled
+// once per config change.
+func redactions(config *Config) []redaction {
+	customRedactionsMu.Lock()
+	defer customRedactionsMu.Unlock()
+	if !sameStrings(customRedactionsSrc, config.Audit.RedactPatterns) {
+		customRedactionsSrc = config.Audit.RedactPatterns
+		customRedactions = nil
+		for i, p := range config.Audit.RedactPatterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Printf("⚠️ Ignoring invalid redact pattern %q: %v", p, err)
+				continue
+			}
+			customRedactions = append(customRedactions, redaction{"custom-" + strconv.Itoa(i+1), re, REDACTED})
+		}
+	}
+	return append(append([]redaction{}, defaultRedactions...), customRedactions...)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// redact masks credentials in an outbound payload and counts what it masked
+// by pattern name.
+func redact(config *Config, body []byte) ([]byte, map[string]int) {
+	if !config.Audit.Redact {
+		return body, nil
+	}
+	var counts map[string]int
+	for _, r := range redactions(config) {
+		n := len(r.pattern.FindAllIndex(body, -1))
+		if n == 0 {
+			continue
+		}
+		body = r.pattern.ReplaceAll(body, []byte(r.replace))
+		if counts == nil {
+			counts = map[string]int{}
+		}
+		counts[r.name] += n
+	}
+	return body, counts
+}
+
+// outbound redacts a payload about to leave the cluster and records it in
+// the audit log. destination is the kind of service (slack, model, email,
+// tracker), target the endpoint or recipient. The returned body is what
+// must be sent.
+func outbound(destination, target string, body []byte) []byte {
+	config := cfg()
+	body, counts := redact(config, body)
+	if counts != nil {
+		log.Printf("🙈 Redacted %v before sending to %s", counts, destination)
+	}
+	if !config.Audit.Enabled {
+		return body
+	}
+
+	sum := sha256.Sum256(body)
+	rec := auditRecord{
+		Time:        time.Now(),
+		Destination: destination,
+		Target:      target,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Bytes:       len(body),
+		Redactions:  counts,
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditLog = append(auditLog, rec)
+	if config.Audit.Path != "" {
+		appendAuditFile(config.Audit.Path, rec)
+	}
+	if time.Since(auditPruned) > AUDIT_PRUNE_EVERY {
+		pruneAudit(config)
+		auditPruned = time.Now()
+	}
+	return body
+}
+
+// appendAuditFile must be called with auditMu held.
+func appendAuditFile(path string, rec auditRecord) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("⚠️ Failed to write audit log %s: %v", path, err)
+		return
+	}
+	defer f.Close()
+	line, _ := json.Marshal(rec)
+	f.Write(append(line, '\n'))
+}
+
+// pruneAudit drops records older than the retention from memory and from
+// the audit file. It must be called with auditMu held.
+func pruneAudit(config *Config) {
+	retention := config.Audit.Retention.Duration
+	if retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-retention)
+	kept := auditLog[:0]
+	for _, r := range auditLog {
+		if r.Time.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	auditLog = kept
+
+	path := config.Audit.Path
+	if path == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	var lines [][]byte
+	dropped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r auditRecord
+		if json.Unmarshal(scanner.Bytes(), &r) == nil && !r.Time.After(cutoff) {
+			dropped++
+			continue
+		}
+		lines = append(lines, append(append([]byte{}, scanner.Bytes()...), '\n'))
+	}
+	f.Close()
+	if dropped == 0 {
+		return
+	}
+	var data []byte
+	for _, l := range lines {
+		data = append(data, l...)
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		log.Printf("⚠️ Failed to prune audit log %s: %v", path, err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Printf("⚠️ Failed to prune audit log %s: %v", path, err)
+		return
+	}
+	log.Printf("🧹 Pruned %d audit record(s) older than %s", dropped, retention)
+}
+
+// handleAudit serves GET /audit, the outbound payloads recorded since the
+// analyzer started (or within the retention), filtered by the destination
+// and since query parameters, newest first.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	since := time.Time{}
+	if s := q.Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "since must be a duration like 24h", http.StatusBadRequest)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+
+	list := []auditRecord{}
+	auditMu.Lock()
+	for i := len(auditLog) - 1; i >= 0; i-- {
+		rec := auditLog[i]
+		if !rec.Time.After(since) || (q.Get("destination") != "" && rec.Destination != q.Get("destination")) {
+			continue
+		}
+		list = append(list, rec)
+	}
+	auditMu.Unlock()
+	writeJSON(w, http.StatusOK, list)
+}
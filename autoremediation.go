@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ACTION_ROLLOUT_RESTART = "rollout-restart"
+	ACTION_DELETE_POD      = "delete-pod"
+	ACTION_BUMP_MEMORY     = "bump-memory"
+
+	REMEDIATE_ACTION_ID = "remediate"
+	PROPOSAL_TTL        = 24 * time.Hour
+)
+
+type RemediationConfig struct {
+	Enabled           bool     `json:"enabled"`
+	Actions           []string `json:"actions"`
+	MemoryBumpPercent int64    `json:"memoryBumpPercent"`
+	Approvers         []string `json:"approvers"`
+}
+
+type Proposal struct {
+	ID        string
+	Action    string
+	Namespace string
+	Pod       string
+	Container string
+	Kind      string
+	Workload  string
+	Channel   string
+	ThreadTS  string
+	Created   time.Time
+}
+
+var (
+	proposalsMu sync.Mutex
+	proposals   = map[string]*Proposal{}
+)
+
+func (p *Proposal) describe() string {
+	switch p.Action {
+	case ACTION_ROLLOUT_RESTART:
+		return fmt.Sprintf("Restart %s/%s", strings.ToLower(p.Kind), p.Workload)
+	case ACTION_DELETE_POD:
+		return fmt.Sprintf("Delete pod %s", p.Pod)
+	case ACTION_BUMP_MEMORY:
+		return fmt.Sprintf("Raise %s memory limit by %d%%", p.Container, cfg().Remediation.MemoryBumpPercent)
+	}
+	return p.Action
+}
+
+// access is the permission the action needs, as checked before it is
+// offered and again when it is approved.
+func (p *Proposal) access() (group, resourceName, verb string) {
+	switch p.Action {
+	case ACTION_ROLLOUT_RESTART:
+		return "apps", workloadResource(p.Kind), "patch"
+	case ACTION_DELETE_POD:
+		return "", "pods", "delete"
+	case ACTION_BUMP_MEMORY:
+		return "apps", workloadResource(p.Kind), "update"
+	}
+	return "", "", ""
+}
+
+// proposeRemediation offers the whitelisted actions that apply to this pod
+// and that the analyzer's service account is actually allowed to perform.
+func proposeRemediation(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, inc *Incident, channel string) {
+	rc := cfg().Remediation
+	if len(rc.Approvers) == 0 {
+		log.Printf("⚠️ Not proposing remediation for %s [%s]: remediation.approvers is empty", pod.Name, pod.Namespace)
+		return
+	}
+	kind, workload := podController(pod)
+
+	var offered []*Proposal
+	for _, action := range rc.Actions {
+		p := &Proposal{
+			ID:        fmt.Sprintf("%s-%s-%d", inc.ID, action, time.Now().UnixNano()),
+			Action:    action,
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Container: inc.Container,
+			Kind:      kind,
+			Workload:  workload,
+			Channel:   channel,
+			ThreadTS:  inc.ThreadTS,
+			Created:   time.Now(),
+		}
+		switch action {
+		case ACTION_ROLLOUT_RESTART, ACTION_DELETE_POD:
+		case ACTION_BUMP_MEMORY:
+			if inc.Reason != "OOMKilled" || analyzer.MemoryLimit(pod, inc.Container).IsZero() {
+				continue
+			}
+		default:
+			log.Printf("⚠️ Unknown remediation action %q in config", action)
+			continue
+		}
+		group, resourceName, verb := p.access()
+		if resourceName == "" || !canI(ctx, clientset, verb, group, resourceName, pod.Namespace) {
+			continue
+		}
+		offered = append(offered, p)
+	}
+	if len(offered) == 0 {
+		return
+	}
+
+	proposalsMu.Lock()
+	for id, p := range proposals {
+		if time.Since(p.Created) > PROPOSAL_TTL {
+			delete(proposals, id)
+		}
+	}
+	var buttons []interface{}
+	for _, p := range offered {
+		proposals[p.ID] = p
+		buttons = append(buttons, map[string]interface{}{
+			"type":      "button",
+			"text":      map[string]string{"type": "plain_text", "text": "Approve: " + p.describe()},
+			"action_id": REMEDIATE_ACTION_ID,
+			"value":     p.ID,
+			"confirm": map[string]interface{}{
+				"title":   map[string]string{"type": "plain_text", "text": "Run remediation?"},
+				"text":    map[string]string{"type": "mrkdwn", "text": p.describe() + " in `" + p.Namespace + "`."},
+				"confirm": map[string]string{"type": "plain_text", "text": "Run it"},
+				"deny":    map[string]string{"type": "plain_text", "text": "Cancel"},
+			},
+		})
+	}
+	proposalsMu.Unlock()
+
+	text := "🔧 *Proposed remediation* — requires approval"
+	postToSlack(map[string]interface{}{
+		"channel":   channel,
+		"thread_ts": inc.ThreadTS,
+		"text":      text,
+		"blocks": []interface{}{
+			map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+			map[string]interface{}{"type": "actions", "elements": buttons},
+		},
+	})
+}
+
+func handleRemediationApproval(clientset kubernetes.Interface, in SlackInteraction) {
+	rc := cfg().Remediation
+	if !rc.Enabled || *readOnly {
+		return
+	}
+	// Without approvers nobody may approve, rather than everybody.
+	if !containsString(rc.Approvers, in.UserID) {
+		postToSlack(map[string]interface{}{
+			"channel":   in.ChannelID,
+			"thread_ts": in.ThreadTS,
+			"text":      fmt.Sprintf("⛔ <@%s> is not allowed to approve remediation actions.", in.UserID),
+		})
+		return
+	}
+
+	proposalsMu.Lock()
+	p, ok := proposals[in.Value]
+	delete(proposals, in.Value)
+	proposalsMu.Unlock()
+	if !ok {
+		replaceInteractiveMessage(in.ResponseURL, "⌛ This remediation proposal has expired or was already handled.")
+		return
+	}
+
+	// The proposal may be hours old: the config or the service account's
+	// RBAC can have changed since it was offered.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	group, resourceName, verb := p.access()
+	switch {
+	case !containsString(rc.Actions, p.Action):
+		replaceInteractiveMessage(in.ResponseURL, fmt.Sprintf("⛔ *%s* is no longer enabled, nothing was changed.", p.describe()))
+		return
+	case resourceName == "" || !canI(ctx, clientset, verb, group, resourceName, p.Namespace):
+		replaceInteractiveMessage(in.ResponseURL, fmt.Sprintf("⛔ The analyzer may no longer %s %s, nothing was changed.", verb, resourceName))
+		return
+	}
+
+	log.Printf("🔧 %s approved by %s (%s) for %s [%s]", p.Action, in.UserName, in.UserID, p.Pod, p.Namespace)
+	replaceInteractiveMessage(in.ResponseURL, fmt.Sprintf("🔧 *%s* approved by <@%s>, running…", p.describe(), in.UserID))
+
+	result := fmt.Sprintf("✅ *%s* completed.", p.describe())
+	if err := runRemediation(ctx, clientset, p); err != nil {
+		result = fmt.Sprintf("❌ *%s* failed: %v", p.describe(), err)
+	}
+	sendSlackThread(p.Channel, p.ThreadTS, result)
+}
+
+func runRemediation(ctx context.Context, clientset kubernetes.Interface, p *Proposal) error {
+	if *dryRun {
+		log.Printf("🧪 [dry-run] would run %s", p.describe())
+		return nil
+	}
+	switch p.Action {
+	case ACTION_DELETE_POD:
+		return clientset.CoreV1().Pods(p.Namespace).Delete(ctx, p.Pod, v1.DeleteOptions{})
+	case ACTION_ROLLOUT_RESTART:
+		patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`, time.Now().Format(time.RFC3339)))
+		var err error
+		switch p.Kind {
+		case "Deployment":
+			_, err = clientset.AppsV1().Deployments(p.Namespace).Patch(ctx, p.Workload, types.StrategicMergePatchType, patch, v1.PatchOptions{})
+		case "StatefulSet":
+			_, err = clientset.AppsV1().StatefulSets(p.Namespace).Patch(ctx, p.Workload, types.StrategicMergePatchType, patch, v1.PatchOptions{})
+		case "DaemonSet":
+			_, err = clientset.AppsV1().DaemonSets(p.Namespace).Patch(ctx, p.Workload, types.StrategicMergePatchType, patch, v1.PatchOptions{})
+		default:
+			return fmt.Errorf("cannot restart a %s", p.Kind)
+		}
+		return err
+	case ACTION_BUMP_MEMORY:
+		return bumpMemoryLimit(ctx, clientset, p)
+	}
+	return fmt.Errorf("unknown action %q", p.Action)
+}
+
+func bumpMemoryLimit(ctx context.Context, clientset kubernetes.Interface, p *Proposal) error {
+	bump := func(spec *corev1.PodSpec) error {
+		for i := range spec.Containers {
+			c := &spec.Containers[i]
+			if c.Name != p.Container {
+				continue
+			}
+			limit := c.Resources.Limits.Memory()
+			if limit.IsZero() {
+				return fmt.Errorf("container %s has no memory limit", c.Name)
+			}
+			mi := int64(1024 * 1024)
+			raised := limit.Value() * (100 + cfg().Remediation.MemoryBumpPercent) / 100
+			raised = (raised + mi - 1) / mi * mi
+			c.Resources.Limits[corev1.ResourceMemory] = *resource.NewQuantity(raised, resource.BinarySI)
+			return nil
+		}
+		return fmt.Errorf("container %s not found", p.Container)
+	}
+
+	switch p.Kind {
+	case "Deployment":
+		d, err := clientset.AppsV1().Deployments(p.Namespace).Get(ctx, p.Workload, v1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := bump(&d.Spec.Template.Spec); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().Deployments(p.Namespace).Update(ctx, d, v1.UpdateOptions{})
+		return err
+	case "StatefulSet":
+		s, err := clientset.AppsV1().StatefulSets(p.Namespace).Get(ctx, p.Workload, v1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := bump(&s.Spec.Template.Spec); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().StatefulSets(p.Namespace).Update(ctx, s, v1.UpdateOptions{})
+		return err
+	case "DaemonSet":
+		ds, err := clientset.AppsV1().DaemonSets(p.Namespace).Get(ctx, p.Workload, v1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := bump(&ds.Spec.Template.Spec); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().DaemonSets(p.Namespace).Update(ctx, ds, v1.UpdateOptions{})
+		return err
+	}
+	return fmt.Errorf("cannot change resources of a %s", p.Kind)
+}
+
+func workloadResource(kind string) string {
+	switch kind {
+	case "Deployment":
+		return "deployments"
+	case "StatefulSet":
+		return "statefulsets"
+	case "DaemonSet":
+		return "daemonsets"
+	}
+	return ""
+}
+
+// canI asks the API server whether our own service account may perform the
+// verb, so actions are only offered when RBAC grants them.
+func canI(ctx context.Context, clientset kubernetes.Interface, verb, group, resourceName, namespace string) bool {
+	allowed, err := accessReview(ctx, clientset, verb, group, resourceName, namespace)
+	if err != nil {
+		log.Printf("⚠️ Access review for %s %s failed: %v", verb, resourceName, err)
+		return false
+	}
+	return allowed
+}
+
+// accessReview runs a SelfSubjectAccessReview; resourceName may name a
+// subresource as in "pods/log".
+func accessReview(ctx context.Context, clientset kubernetes.Interface, verb, group, resourceName, namespace string) (bool, error) {
+	parts := strings.SplitN(resourceName, "/", 2)
+	attrs := &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      verb,
+		Group:     group,
+		Resource:  parts[0],
+	}
+	if len(parts) == 2 {
+		attrs.Subresource = parts[1]
+	}
+	review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attrs},
+	}, v1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SCALE_WINDOW = 15 * time.Minute
+	SCALE_EVENTS = 5
+)
+
+// describeAutoscaler reports the HorizontalPodAutoscaler of the pod's
+// workload: replica bounds, current against target metrics, conditions and
+// recent rescales. The second result flags what the alert should call out:
+// a rescale within the window around the crash, or an HPA pinned at its
+// maximum.
+func describeAutoscaler(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, crash time.Time, window time.Duration) (string, []string) {
+	if !allowed(pod.Namespace, "list", "horizontalpodautoscalers.autoscaling") {
+		return "", nil
+	}
+	kind, name := podController(pod)
+	list, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(pod.Namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return "", nil
+	}
+	var hpa *autoscalingv2.HorizontalPodAutoscaler
+	for i := range list.Items {
+		ref := list.Items[i].Spec.ScaleTargetRef
+		if ref.Kind == kind && ref.Name == name {
+			hpa = &list.Items[i]
+		}
+	}
+	if hpa == nil {
+		return "", nil
+	}
+
+	min := derefInt32(hpa.Spec.MinReplicas, 1)
+	lines := []string{fmt.Sprintf("HPA %s: %d current, %d desired replicas (min %d, max %d)",
+		hpa.Name, hpa.Status.CurrentReplicas, hpa.Status.DesiredReplicas, min, hpa.Spec.MaxReplicas)}
+	current := map[string]string{}
+	for _, m := range hpa.Status.CurrentMetrics {
+		current[metricStatusName(m)] = metricValue(metricStatusCurrent(m))
+	}
+	for _, m := range hpa.Spec.Metrics {
+		key := metricSpecName(m)
+		value := current[key]
+		if value == "" {
+			value = "unknown"
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s (target %s)", key, value, metricTarget(metricSpecTarget(m))))
+	}
+	var flags []string
+	pinned := hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas
+	for _, c := range hpa.Status.Conditions {
+		if c.Status == corev1.ConditionTrue && c.Type != autoscalingv2.ScalingLimited {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("condition %s=%s (%s): %s", c.Type, c.Status, c.Reason, c.Message))
+		if c.Type == autoscalingv2.ScalingLimited && c.Status == corev1.ConditionTrue && c.Reason == "TooManyReplicas" {
+			pinned = true
+		}
+	}
+	if pinned {
+		flags = append(flags, fmt.Sprintf("HPA `%s` is pinned at its maximum of %d replicas: the load is more than the workload may scale to", hpa.Name, hpa.Spec.MaxReplicas))
+	}
+	if t := hpa.Status.LastScaleTime; t != nil {
+		lines = append(lines, fmt.Sprintf("last rescale: %s", t.Format("2006-01-02 15:04:05")))
+	}
+
+	if allowed(pod.Namespace, "list", "events") {
+		events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, v1.ListOptions{
+			FieldSelector: "involvedObject.kind=HorizontalPodAutoscaler,involvedObject.name=" + hpa.Name,
+		})
+		if err == nil {
+			var rescales []string
+			var closest *corev1.Event
+			for i, e := range events.Items {
+				if e.Reason != "SuccessfulRescale" {
+					if e.Type == corev1.EventTypeWarning {
+						rescales = append(rescales, fmt.Sprintf("%s %s: %s", collector.EventTime(e).Format("15:04:05"), e.Reason, e.Message))
+					}
+					continue
+				}
+				rescales = append(rescales, fmt.Sprintf("%s %s", collector.EventTime(e).Format("15:04:05"), e.Message))
+				gap := absDuration(collector.EventTime(e).Sub(crash))
+				if gap <= window && (closest == nil || gap < absDuration(collector.EventTime(*closest).Sub(crash))) {
+					closest = &events.Items[i]
+				}
+			}
+			if len(rescales) > SCALE_EVENTS {
+				rescales = rescales[len(rescales)-SCALE_EVENTS:]
+			}
+			if len(rescales) > 0 {
+				lines = append(lines, "recent autoscaler events:\n"+strings.Join(rescales, "\n"))
+			}
+			if closest != nil {
+				when := "before"
+				if collector.EventTime(*closest).After(crash) {
+					when = "after"
+				}
+				flags = append(flags, fmt.Sprintf("HPA `%s` rescaled %s %s the crash (%s)",
+					hpa.Name, humanDuration(absDuration(collector.EventTime(*closest).Sub(crash))), when, closest.Message))
+			}
+		}
+	}
+
+	if len(flags) > 0 {
+		lines = append(lines, "flagged: "+strings.Join(flags, "; "))
+	}
+	return strings.Join(lines, "\n"), flags
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func metricSpecName(m autoscalingv2.MetricSpec) string {
+	switch {
+	case m.Resource != nil:
+		return "resource " + string(m.Resource.Name)
+	case m.ContainerResource != nil:
+		return fmt.Sprintf("container %s resource %s", m.ContainerResource.Container, m.ContainerResource.Name)
+	case m.Pods != nil:
+		return "pods metric " + m.Pods.Metric.Name
+	case m.Object != nil:
+		return fmt.Sprintf("object metric %s of %s/%s", m.Object.Metric.Name, m.Object.DescribedObject.Kind, m.Object.DescribedObject.Name)
+	case m.External != nil:
+		return "external metric " + m.External.Metric.Name
+	}
+	return string(m.Type)
+}
+
+func metricStatusName(m autoscalingv2.MetricStatus) string {
+	switch {
+	case m.Resource != nil:
+		return "resource " + string(m.Resource.Name)
+	case m.ContainerResource != nil:
+		return fmt.Sprintf("container %s resource %s", m.ContainerResource.Container, m.ContainerResource.Name)
+	case m.Pods != nil:
+		return "pods metric " + m.Pods.Metric.Name
+	case m.Object != nil:
+		return fmt.Sprintf("object metric %s of %s/%s", m.Object.Metric.Name, m.Object.DescribedObject.Kind, m.Object.DescribedObject.Name)
+	case m.External != nil:
+		return "external metric " + m.External.Metric.Name
+	}
+	return string(m.Type)
+}
+
+func metricSpecTarget(m autoscalingv2.MetricSpec) autoscalingv2.MetricTarget {
+	switch {
+	case m.Resource != nil:
+		return m.Resource.Target
+	case m.ContainerResource != nil:
+		return m.ContainerResource.Target
+	case m.Pods != nil:
+		return m.Pods.Target
+	case m.Object != nil:
+		return m.Object.Target
+	case m.External != nil:
+		return m.External.Target
+	}
+	return autoscalingv2.MetricTarget{}
+}
+
+func metricStatusCurrent(m autoscalingv2.MetricStatus) autoscalingv2.MetricValueStatus {
+	switch {
+	case m.Resource != nil:
+		return m.Resource.Current
+	case m.ContainerResource != nil:
+		return m.ContainerResource.Current
+	case m.Pods != nil:
+		return m.Pods.Current
+	case m.Object != nil:
+		return m.Object.Current
+	case m.External != nil:
+		return m.External.Current
+	}
+	return autoscalingv2.MetricValueStatus{}
+}
+
+func metricTarget(t autoscalingv2.MetricTarget) string {
+	return metricValue(autoscalingv2.MetricValueStatus{Value: t.Value, AverageValue: t.AverageValue, AverageUtilization: t.AverageUtilization})
+}
+
+func metricValue(v autoscalingv2.MetricValueStatus) string {
+	switch {
+	case v.AverageUtilization != nil:
+		return fmt.Sprintf("%d%% of requests", *v.AverageUtilization)
+	case v.AverageValue != nil:
+		return v.AverageValue.String() + " per pod"
+	case v.Value != nil:
+		return v.Value.String()
+	}
+	return "unknown"
+}
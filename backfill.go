@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	"github.com/ghulevishal/pod-analyzer/internal/detector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	BACKFILL_SINCE   = 24 * time.Hour
+	BACKFILL_EVENTS  = 30
+	BACKFILL_MESSAGE = 200
+	BACKFILL_TIME    = "2006-01-02 15:04"
+	BACKFILL_PROMPT  = "Below is a report of the problems currently visible in a Kubernetes cluster: workloads whose containers restarted, containers stuck waiting, and Warning events. Rank the findings by how urgent they look, group the ones that probably share a cause, and say for the top few what to check first. Be brief.\n\n"
+)
+
+// backfillWorkload sums up the restarts of one workload's containers within
+// the report's range.
+type backfillWorkload struct {
+	Namespace string
+	Workload  string
+	Pods      map[string]bool
+	Restarts  int32
+	Last      time.Time
+	Reason    string
+	Diagnosis string
+}
+
+// backfillEvents sums up the Warning events of one object with one reason.
+type backfillEvents struct {
+	Namespace string
+	Object    string
+	Reason    string
+	Count     int32
+	Last      time.Time
+	Message   string
+}
+
+// runBackfill implements the backfill subcommand: one report of the
+// restarts, stuck containers and Warning events already in the cluster, so
+// turning the analyzer on shows the problems that predate it. It prints the
+// report, or posts it to Slack with --slack, and returns.
+func runBackfill(clientset kubernetes.Interface, args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	since := fs.Duration("since", BACKFILL_SINCE, "report restarts and Warning events of this long before now")
+	from := fs.String("from", "", "start of the range as RFC 3339, instead of --since")
+	to := fs.String("to", "", "end of the range as RFC 3339 (default now)")
+	format := fs.String("format", FORMAT_TEXT, "report format: text, markdown, mrkdwn or html")
+	toSlack := fs.Bool("slack", false, "post the report to the Slack channel instead of printing it")
+	summarize := fs.Bool("summarize", false, "ask the model to rank the findings")
+	fs.Parse(args)
+
+	end := time.Now()
+	if *to != "" {
+		t, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			log.Fatalf("❌ Invalid --to: %v", err)
+		}
+		end = t
+	}
+	start := end.Add(-*since)
+	if *from != "" {
+		t, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			log.Fatalf("❌ Invalid --from: %v", err)
+		}
+		start = t
+	}
+	formatter := formatterFor(*format)
+	if formatter == nil {
+		log.Fatalf("❌ Unknown report format %q", *format)
+	}
+
+	config := cfg()
+	ctx := context.Background()
+	log.Printf("📋 Backfilling from %s to %s", start.Format(BACKFILL_TIME), end.Format(BACKFILL_TIME))
+	workloads, stuck, err := backfillPods(ctx, clientset, start, end)
+	if err != nil {
+		log.Fatalf("❌ Error fetching pods: %v", err)
+	}
+	events := backfillWarnings(ctx, clientset, start, end)
+	v := backfillView(config, start, end, workloads, stuck, events)
+
+	if *summarize && (len(workloads) > 0 || len(stuck) > 0 || len(events) > 0) {
+		report := formatterFor(FORMAT_TEXT).Document(v)
+		summary, err := callModel(withUsage(ctx, ""), config, BACKFILL_PROMPT+report+languageInstruction(config.Language))
+		if err != nil {
+			log.Printf("❌ Model summary failed: %v", err)
+		} else {
+			v.Sections = append([]viewSection{analysisSection(summary)}, v.Sections...)
+		}
+	}
+
+	if !*toSlack {
+		fmt.Fprintln(os.Stdout, localized(formatter, config.Language).Document(v))
+		return
+	}
+	slack := localized(formatterFor(FORMAT_MRKDWN), config.Language)
+	ts := postToSlack(map[string]interface{}{
+		"channel": config.SlackChannel,
+		"text":    slack.Header(v),
+	})
+	for _, s := range v.Sections {
+		sendSlackThread(config.SlackChannel, ts, slack.Section(s))
+	}
+}
+
+// backfillPods finds the containers that restarted within the range, grouped
+// by workload, and the containers stuck waiting right now.
+func backfillPods(ctx context.Context, clientset kubernetes.Interface, start, end time.Time) ([]*backfillWorkload, []viewField, error) {
+	pods, err := listPods(ctx, clientset)
+	if err != nil {
+		return nil, nil, err
+	}
+	byWorkload := map[string]*backfillWorkload{}
+	var stuck []viewField
+	for i := range pods {
+		pod := &pods[i]
+		if !cfg().watchesNamespace(pod.Namespace) || detector.IsEvicted(pod) {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if detector.StuckWaiting(cs) {
+				diagnosis := cs.State.Waiting.Message
+				if c := classify(pod, cs, INCIDENT_START_FAILURE, nil, ""); c != nil {
+					diagnosis = c.Summary
+				}
+				stuck = append(stuck, viewField{
+					Label: fmt.Sprintf("%s/%s (%s)", pod.Namespace, pod.Name, cs.Name),
+					Value: cs.State.Waiting.Reason + ": " + truncate(diagnosis, BACKFILL_MESSAGE),
+				})
+				continue
+			}
+			t := cs.LastTerminationState.Terminated
+			if cs.RestartCount == 0 || t == nil || t.FinishedAt.Time.Before(start) || t.FinishedAt.Time.After(end) {
+				continue
+			}
+			workload := workloadName(pod)
+			key := pod.Namespace + "/" + workload
+			w := byWorkload[key]
+			if w == nil {
+				w = &backfillWorkload{Namespace: pod.Namespace, Workload: workload, Pods: map[string]bool{}}
+				byWorkload[key] = w
+			}
+			w.Pods[pod.Name] = true
+			w.Restarts += cs.RestartCount
+			if t.FinishedAt.Time.After(w.Last) {
+				w.Last = t.FinishedAt.Time
+				w.Reason = fmt.Sprintf("%s (exit code %d)", t.Reason, t.ExitCode)
+				w.Diagnosis = ""
+				if c := classify(pod, cs, INCIDENT_RESTART, nil, ""); c != nil {
+					w.Diagnosis = c.Summary
+				}
+			}
+		}
+	}
+
+	var workloads []*backfillWorkload
+	for _, w := range byWorkload {
+		workloads = append(workloads, w)
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Restarts != workloads[j].Restarts {
+			return workloads[i].Restarts > workloads[j].Restarts
+		}
+		return workloads[i].Namespace+"/"+workloads[i].Workload < workloads[j].Namespace+"/"+workloads[j].Workload
+	})
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].Label < stuck[j].Label })
+	return workloads, stuck, nil
+}
+
+// backfillWarnings sums up the Warning events within the range by object and
+// reason, most frequent first. Only the events the API server still keeps
+// (an hour by default) can be reported.
+func backfillWarnings(ctx context.Context, clientset kubernetes.Interface, start, end time.Time) []*backfillEvents {
+	byKey := map[string]*backfillEvents{}
+	for _, ns := range watchedNamespaces(cfg()) {
+		if !allowed(ns, "list", "events") {
+			continue
+		}
+		list, err := clientset.CoreV1().Events(ns).List(ctx, v1.ListOptions{FieldSelector: "type=" + corev1.EventTypeWarning})
+		if err != nil {
+			log.Printf("⚠️ Failed to list events in %s: %v", ns, err)
+			continue
+		}
+		for _, e := range list.Items {
+			at := collector.EventTime(e)
+			if !cfg().watchesNamespace(e.Namespace) || at.Before(start) || at.After(end) {
+				continue
+			}
+			object := e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name
+			key := e.Namespace + "/" + object + "/" + e.Reason
+			b := byKey[key]
+			if b == nil {
+				b = &backfillEvents{Namespace: e.Namespace, Object: object, Reason: e.Reason}
+				byKey[key] = b
+			}
+			count := e.Count
+			if count == 0 {
+				count = 1
+			}
+			b.Count += count
+			if at.After(b.Last) {
+				b.Last, b.Message = at, e.Message
+			}
+		}
+	}
+
+	var events []*backfillEvents
+	for _, b := range byKey {
+		events = append(events, b)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Count != events[j].Count {
+			return events[i].Count > events[j].Count
+		}
+		return events[i].Last.After(events[j].Last)
+	})
+	return events
+}
+
+func backfillView(config *Config, start, end time.Time, workloads []*backfillWorkload, stuck []viewField, events []*backfillEvents) *incidentView {
+	namespaces := strings.Join(config.Namespaces, ", ")
+	if namespaces == "" {
+		namespaces = "all"
+	}
+	v := &incidentView{
+		Emoji: "📋",
+		Title: "Backfill Report",
+		Fields: []viewField{
+			{Emoji: "🕒", Label: "Range", Value: start.Format(BACKFILL_TIME) + " – " + end.Format(BACKFILL_TIME)},
+			{Emoji: "📦", Label: "Namespaces", Value: namespaces},
+			{Emoji: "🔁", Label: "Restarting workloads", Value: fmt.Sprint(len(workloads))},
+			{Emoji: "⛔", Label: "Stuck containers", Value: fmt.Sprint(len(stuck))},
+			{Emoji: "⚠️", Label: "Warning events", Value: fmt.Sprint(len(events))},
+		},
+	}
+
+	restarts := viewSection{Emoji: "🔁", Title: "Restarting workloads", Rows: [][]string{{"Workload", "Pods", "Restarts", "Last restart", "Last reason", "Diagnosis"}}}
+	var lines []string
+	for _, w := range workloads {
+		line := fmt.Sprintf("%s/%s: %d restarts across %d pod(s), last at %s, %s",
+			w.Namespace, w.Workload, w.Restarts, len(w.Pods), w.Last.Format(BACKFILL_TIME), w.Reason)
+		if w.Diagnosis != "" {
+			line += "\n  " + w.Diagnosis
+		}
+		lines = append(lines, line)
+		restarts.Rows = append(restarts.Rows, []string{w.Namespace + "/" + w.Workload, fmt.Sprint(len(w.Pods)),
+			fmt.Sprint(w.Restarts), w.Last.Format(BACKFILL_TIME), w.Reason, w.Diagnosis})
+	}
+	restarts.Body = strings.Join(lines, "\n")
+
+	waiting := viewSection{Emoji: "⛔", Title: "Stuck containers", Rows: [][]string{{"Container", "State"}}}
+	lines = nil
+	for _, f := range stuck {
+		lines = append(lines, f.Label+": "+f.Value)
+		waiting.Rows = append(waiting.Rows, []string{f.Label, f.Value})
+	}
+	waiting.Body = strings.Join(lines, "\n")
+
+	warnings := viewSection{Emoji: "⚠️", Title: "Warning events", Rows: [][]string{{"Object", "Reason", "Count", "Last seen", "Message"}}}
+	lines = nil
+	for i, e := range events {
+		if i == BACKFILL_EVENTS {
+			lines = append(lines, fmt.Sprintf("… and %d more", len(events)-BACKFILL_EVENTS))
+			break
+		}
+		object := e.Namespace + "/" + e.Object
+		message := truncate(strings.TrimSpace(e.Message), BACKFILL_MESSAGE)
+		lines = append(lines, fmt.Sprintf("%s ×%d %s %s: %s", e.Last.Format(BACKFILL_TIME), e.Count, object, e.Reason, message))
+		warnings.Rows = append(warnings.Rows, []string{object, e.Reason, fmt.Sprint(e.Count), e.Last.Format(BACKFILL_TIME), message})
+	}
+	warnings.Body = strings.Join(lines, "\n")
+
+	v.Sections = []viewSection{restarts, waiting, warnings}
+	for i := range v.Sections {
+		if len(v.Sections[i].Rows) == 1 {
+			v.Sections[i].Rows = nil
+		}
+	}
+	return v
+}
@@ -1,3 +1,8 @@
+//go:build ignore
+
+// The original single-file version of the analyzer, kept for reference. It
+// is not part of the build.
+
 package main
 
 import (
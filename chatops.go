@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const CHATOPS_HELP = "Usage: `@pod-analyzer analyze <namespace>/<pod>[/<container>]`. A unique prefix of the pod name is enough."
+
+var analyzeCommand = regexp.MustCompile(`(?i)\banalyze\s+([a-z0-9-]+)/([a-z0-9.-]+)(?:/([a-z0-9-]+))?`)
+
+// ChatOpsConfig lets people ask for an analysis by mentioning the bot.
+// Channels maps Slack channel IDs to the namespaces that may be analyzed
+// from them; "*" allows every namespace.
+type ChatOpsConfig struct {
+	Enabled  bool                `json:"enabled"`
+	Channels map[string][]string `json:"channels"`
+}
+
+// slackReply is the Slack thread an on-demand analysis is posted into. It
+// is empty for API requests, which only get the analysis returned.
+type slackReply struct {
+	Channel string
+	TS      string
+	User    string
+}
+
+var (
+	slackEventsMu   sync.Mutex
+	slackEventsSeen = map[string]time.Time{}
+)
+
+// allows reports whether the namespace may be analyzed from the channel.
+func (c ChatOpsConfig) allows(channel, namespace string) bool {
+	for _, ns := range c.Channels[channel] {
+		if ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSlackEvents serves the Slack Events API: the URL verification
+// handshake, app_mention events carrying analyze commands, and reactions
+// on alerts giving feedback on their analysis.
+func handleSlackEvents(clientset kubernetes.Interface, dyn dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, tenant, ok := verifySlackRequest(r)
+		if !ok {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		var payload struct {
+			Type      string `json:"type"`
+			Challenge string `json:"challenge"`
+			EventID   string `json:"event_id"`
+			Event     struct {
+				Type     string `json:"type"`
+				User     string `json:"user"`
+				Text     string `json:"text"`
+				Channel  string `json:"channel"`
+				TS       string `json:"ts"`
+				ThreadTS string `json:"thread_ts"`
+				Reaction string `json:"reaction"`
+				Item     struct {
+					Type    string `json:"type"`
+					Channel string `json:"channel"`
+					TS      string `json:"ts"`
+				} `json:"item"`
+			} `json:"event"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, "bad payload", http.StatusBadRequest)
+			return
+		}
+		if payload.Type == "url_verification" {
+			w.Write([]byte(payload.Challenge))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if payload.Type != "event_callback" || !firstDelivery(payload.EventID) {
+			return
+		}
+
+		e := payload.Event
+		if (e.Type == "reaction_added" || e.Type == "reaction_removed") && e.Item.Type == "message" {
+			go handleReaction(dyn, tenantChannel(tenant, e.Item.Channel), e.Item.TS, e.User, e.Reaction, e.Type == "reaction_added")
+			return
+		}
+		if e.Type != "app_mention" {
+			return
+		}
+		reply := &slackReply{Channel: tenantChannel(tenant, e.Channel), TS: e.ThreadTS, User: e.User}
+		if reply.TS == "" {
+			reply.TS = e.TS
+		}
+		go handleMention(clientset, dyn, tenant, e.Channel, e.Text, reply)
+	}
+}
+
+// firstDelivery drops the retries Slack sends when it did not get an
+// acknowledgement in time.
+func firstDelivery(eventID string) bool {
+	slackEventsMu.Lock()
+	defer slackEventsMu.Unlock()
+	for id, t := range slackEventsSeen {
+		if time.Since(t) > time.Hour {
+			delete(slackEventsSeen, id)
+		}
+	}
+	if _, seen := slackEventsSeen[eventID]; seen {
+		return false
+	}
+	slackEventsSeen[eventID] = time.Now()
+	return true
+}
+
+func handleMention(clientset kubernetes.Interface, dyn dynamic.Interface, tenant, channel, text string, reply *slackReply) {
+	config := cfg()
+	if !config.ChatOps.Enabled {
+		return
+	}
+	m := analyzeCommand.FindStringSubmatch(text)
+	if m == nil {
+		sendSlackThread(reply.Channel, reply.TS, CHATOPS_HELP)
+		return
+	}
+	// "checkout-7d9f..." shortens a name just like "checkout-7d9f".
+	namespace, podName, container := m[1], strings.TrimRight(m[2], "."), m[3]
+
+	switch {
+	case !config.ChatOps.allows(channel, namespace):
+		log.Printf("⛔ %s asked to analyze %s/%s from channel %s, which may not analyze that namespace", reply.User, namespace, podName, channel)
+		sendSlackThread(reply.Channel, reply.TS, fmt.Sprintf("⛔ This channel may not analyze pods in `%s`.", namespace))
+		return
+	case tenantFor(config, namespace) != tenant:
+		sendSlackThread(reply.Channel, reply.TS, fmt.Sprintf("⛔ `%s` does not belong to this workspace.", namespace))
+		return
+	case !config.watchesNamespace(namespace) || !allowed(namespace, "get", "pods"):
+		sendSlackThread(reply.Channel, reply.TS, fmt.Sprintf("⛔ The analyzer does not watch `%s`.", namespace))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	pod, err := findPod(ctx, clientset, namespace, podName)
+	cancel()
+	if err != nil {
+		sendSlackThread(reply.Channel, reply.TS, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	cs, ok := pickContainer(pod, container)
+	if !ok {
+		sendSlackThread(reply.Channel, reply.TS, fmt.Sprintf("❌ Container `%s` not found in pod `%s`.", container, pod.Name))
+		return
+	}
+	restartTime := time.Now()
+	if t := cs.LastTerminationState.Terminated; t != nil && !t.FinishedAt.IsZero() {
+		restartTime = t.FinishedAt.Time
+	}
+
+	log.Printf("💬 On-demand analysis of %s [%s] requested by %s in Slack", pod.Name, namespace, reply.User)
+	sendSlackThread(reply.Channel, reply.TS, fmt.Sprintf("🔍 Analyzing `%s/%s` (container `%s`) for <@%s>…", namespace, pod.Name, cs.Name, reply.User))
+	if inc := analyzePodFor(clientset, dyn, *pod, cs, restartTime, reply); inc == nil {
+		sendSlackThread(reply.Channel, reply.TS, "⚠️ Analysis skipped: excluded by a PodAnalyzerRule, or the pod's events could not be read.")
+	}
+}
+
+// findPod gets the pod by name, or else the only pod whose name starts with
+// it, so names can be shortened in chat.
+func findPod(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*corev1.Pod, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, v1.GetOptions{})
+	if err == nil {
+		return pod, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var matches []*corev1.Pod
+	for i := range list.Items {
+		if strings.HasPrefix(list.Items[i].Name, name) {
+			matches = append(matches, &list.Items[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no pod `%s` in `%s`", name, namespace)
+	case 1:
+		return matches[0], nil
+	}
+	var names []string
+	for _, p := range matches {
+		names = append(names, p.Name)
+	}
+	return nil, fmt.Errorf("`%s` matches several pods: `%s`", name, strings.Join(names, "`, `"))
+}
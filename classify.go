@@ -0,0 +1,18 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const READINESS_TIMEOUT = 10 * time.Minute
+
+// classify runs the heuristics with the settings of the current config.
+func classify(pod *corev1.Pod, cs corev1.ContainerStatus, incidentType string, events []corev1.Event, errorLines string) *analyzer.Classification {
+	return analyzer.Classify(pod, cs, events, errorLines, analyzer.Options{
+		ProbeFailure:     incidentType == INCIDENT_PROBE_FAILURE,
+		ReadinessTimeout: cfg().ReadinessTimeout.Duration,
+	})
+}
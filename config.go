@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	CONFIG_FILE            = "/etc/pod-analyzer/config.yaml"
+	CONFIG_RELOAD_INTERVAL = 10 * time.Second
+	EVENT_LOOKBACK         = 10 * time.Minute
+
+	DEFAULT_PROMPT = `Here are the logs and events from a Kubernetes pod. Help me identify the issue and suggest a fix. Compare resource usage with the limits to spot OOM kills or CPU throttling.
+{{- if eq .Type "probe-failure"}}{{if eq .ProbeKind "readiness"}} The container has been failing its readiness probe for a long time, so it gets no traffic, but it was not restarted: judge whether the application is really not ready (stuck at startup, waiting for a dependency) or the probe is wrong or too strict, and suggest concrete probe tuning (path, port, initialDelaySeconds, timeoutSeconds, periodSeconds, failureThreshold) if so.{{else}} The container was restarted because its liveness probe failed: judge whether the application is really unhealthy or the probe is too strict, and suggest concrete probe tuning (initialDelaySeconds, timeoutSeconds, periodSeconds, failureThreshold) if so.{{end}}{{end}}
+{{- if eq .Type "flapping"}} The workload is flapping: it restarted {{.Restarts}} times within {{.Window}}, so look for a cause that keeps recurring (crash on a periodic task, leak, dependency that keeps failing) rather than a one-off error.{{end}}
+
+{{- if .Changes}}
+
+Recent changes (a new release or configuration update shortly before the crash is a likely trigger; if the release is crashing, say so and point at what changed):
+{{.Changes}}
+{{- end}}
+{{- if .Delivery}}
+
+Delivery (the GitOps or progressive delivery objects managing this workload, with their sync status and Git revision; a crash right after a sync or on a canary revision points at that revision, and a failed or pending sync means the running version may not be the one in Git):
+{{.Delivery}}
+{{- end}}
+{{- if .History}}
+
+Previous incidents of this workload (if this is a recurrence, say so; if an earlier suggested fix evidently did not help or was not applied, escalate your recommendation instead of repeating it):
+{{.History}}
+{{- end}}
+{{- if .Registry}}
+
+Registry probe (the analyzer asked the registry for the image manifest with the pod's pull secrets; state this finding as the cause of the pull failure instead of guessing from the error message):
+{{.Registry}}
+{{- end}}
+
+Events:
+{{.Events}}
+
+Resources:
+{{.Resources}}
+{{- if .Probes}}
+
+Probes:
+{{.Probes}}
+{{- end}}
+{{- if .Autoscaler}}
+
+Autoscaler (the workload's HorizontalPodAutoscaler: replica bounds, current against target metrics and recent rescales; a crash right around a rescale, or an HPA pinned at its maximum, points at load or resource pressure rather than a code bug):
+{{.Autoscaler}}
+{{- end}}
+{{- if .Replica}}
+
+Healthy replica (another replica of the same workload that runs without restarts, and how the crashing pod differs from it; a difference such as another node, image digest or revision is the first suspect, and if there is none, look at what only this replica receives):
+{{.Replica}}
+{{- end}}
+{{- if .Network}}
+
+Network (the Services, endpoints, NetworkPolicies and mesh sidecars behind the connection errors in the logs; base a network misconfiguration diagnosis on these objects, and say so if they look fine):
+{{.Network}}
+{{- end}}
+{{- if .Storage}}
+
+Storage (persistent volume claims, volumes and storage events; attach/mount failures or a full volume often explain crash loops of stateful workloads):
+{{.Storage}}
+{{- end}}
+{{- if .Runbooks}}
+
+Runbooks (this organization's procedures for this kind of failure; if one applies, name it by its title in your answer and align your suggested fix with its steps instead of improvising a different one):
+{{.Runbooks}}
+{{- end}}
+{{- if .Enrichment}}
+
+Site-specific context (added by this cluster's enrichers, e.g. ownership, deploy history or runbooks; prefer it over assumptions):
+{{.Enrichment}}
+{{- end}}
+{{- if .Errors}}
+
+Key errors and stack traces (extracted from the full logs, look at these first):
+{{.Errors}}
+{{- end}}
+
+Logs:
+{{.Logs}}
+{{- if .Language}}
+
+Write your entire answer in {{.Language}}. Keep Kubernetes object names, field names, commands and log lines as they are.
+{{- end}}`
+)
+
+type Config struct {
+	SlackChannel       string               `json:"slackChannel"`
+	OllamaAPI          string               `json:"ollamaAPI"`
+	OllamaModel        string               `json:"ollamaModel"`
+	Provider           string               `json:"provider"`
+	OpenAIAPI          string               `json:"openaiAPI"`
+	OpenAIModel        string               `json:"openaiModel"`
+	StructuredOutput   bool                 `json:"structuredOutput"`
+	ModelParams        ModelParams          `json:"modelParams"`
+	IncidentModels     map[string]string    `json:"incidentModels"`
+	CheckInterval      v1.Duration          `json:"checkInterval"`
+	Logs               LogConfig            `json:"logs"`
+	LogSource          LogSourceConfig      `json:"logSource"`
+	Timeouts           TimeoutConfig        `json:"timeouts"`
+	Correlation        CorrelationConfig    `json:"correlation"`
+	Threads            ThreadConfig         `json:"threads"`
+	Audit              AuditConfig          `json:"audit"`
+	Nodes              NodeConfig           `json:"nodes"`
+	Maintenance        []MaintenanceWindow  `json:"maintenance"`
+	Suppress           []SuppressRule       `json:"suppress"`
+	Runbooks           []Runbook            `json:"runbooks"`
+	Delivery           DeliveryConfig       `json:"delivery"`
+	ChatOps            ChatOpsConfig        `json:"chatops"`
+	Usage              UsageConfig          `json:"usage"`
+	RegistryProbe      RegistryProbeConfig  `json:"registryProbe"`
+	NamespaceLogs      map[string]LogConfig `json:"namespaceLogs"`
+	EventLookback      v1.Duration          `json:"eventLookback"`
+	IssueThreshold     int                  `json:"issueThreshold"`
+	IssueWindow        v1.Duration          `json:"issueWindow"`
+	Namespaces         []string             `json:"namespaces"`
+	ExcludeNamespaces  []string             `json:"excludeNamespaces"`
+	PromptTemplate     string               `json:"promptTemplate"`
+	ContextTokens      int                  `json:"contextTokens"`
+	ResponseTokens     int                  `json:"responseTokens"`
+	ModelContextTokens map[string]int       `json:"modelContextTokens"`
+	SummarizeOverflow  bool                 `json:"summarizeOverflow"`
+	Heuristics         bool                 `json:"heuristics"`
+	Digests            []DigestConfig       `json:"digests"`
+	Remediation        RemediationConfig    `json:"remediation"`
+	Email              EmailConfig          `json:"email"`
+	Archive            ArchiveConfig        `json:"archive"`
+	Hooks              HooksConfig          `json:"hooks"`
+	Language           string               `json:"language"`
+	Languages          map[string]string    `json:"languages"`
+	Flapping           FlappingConfig       `json:"flapping"`
+	ResolveAfter       v1.Duration          `json:"resolveAfter"`
+	ReadinessTimeout   v1.Duration          `json:"readinessTimeout"`
+	ChangeWindow       v1.Duration          `json:"changeWindow"`
+	RolloutWindow      v1.Duration          `json:"rolloutWindow"`
+	ScaleWindow        v1.Duration          `json:"scaleWindow"`
+	HistoryWindow      v1.Duration          `json:"historyWindow"`
+	HistoryIncidents   int                  `json:"historyIncidents"`
+
+	TenantLabel string                  `json:"tenantLabel"`
+	Tenants     map[string]TenantConfig `json:"tenants"`
+
+	prompt *template.Template
+	tenant string
+}
+
+var (
+	configMu      sync.RWMutex
+	currentConfig = defaultConfig()
+)
+
+func defaultConfig() *Config {
+	c := &Config{
+		SlackChannel:      SLACK_CHANNEL,
+		OllamaAPI:         OLLAMA_API,
+		OllamaModel:       OLLAMA_MODEL,
+		Provider:          PROVIDER_OLLAMA,
+		OpenAIAPI:         OPENAI_API,
+		OpenAIModel:       OPENAI_MODEL,
+		CheckInterval:     v1.Duration{Duration: CHECK_INTERVAL},
+		Logs:              LogConfig{TailLines: LOG_LINES, MaxBytes: LOG_MAX_BYTES},
+		EventLookback:     v1.Duration{Duration: EVENT_LOOKBACK},
+		IssueThreshold:    ISSUE_THRESHOLD,
+		IssueWindow:       v1.Duration{Duration: ISSUE_WINDOW},
+		PromptTemplate:    DEFAULT_PROMPT,
+		ContextTokens:     CONTEXT_TOKENS,
+		ResponseTokens:    RESPONSE_TOKENS,
+		SummarizeOverflow: true,
+		Heuristics:        true,
+		ResolveAfter:      v1.Duration{Duration: RESOLVE_AFTER},
+		ReadinessTimeout:  v1.Duration{Duration: READINESS_TIMEOUT},
+		ChangeWindow:      v1.Duration{Duration: CHANGE_WINDOW},
+		RolloutWindow:     v1.Duration{Duration: ROLLOUT_WINDOW},
+		ScaleWindow:       v1.Duration{Duration: SCALE_WINDOW},
+		HistoryWindow:     v1.Duration{Duration: HISTORY_WINDOW},
+		HistoryIncidents:  HISTORY_INCIDENTS,
+		RegistryProbe:     RegistryProbeConfig{Timeout: v1.Duration{Duration: REGISTRY_PROBE_TIMEOUT}},
+		Timeouts: TimeoutConfig{
+			Analysis: v1.Duration{Duration: ANALYSIS_TIMEOUT},
+			Logs:     v1.Duration{Duration: LOGS_TIMEOUT},
+			Events:   v1.Duration{Duration: EVENTS_TIMEOUT},
+			Model:    v1.Duration{Duration: MODEL_TIMEOUT},
+			Slack:    v1.Duration{Duration: SLACK_TIMEOUT},
+		},
+		Threads: ThreadConfig{
+			Reuse:     true,
+			ConfigMap: THREAD_CONFIGMAP,
+			Expire:    v1.Duration{Duration: THREAD_EXPIRE},
+		},
+		Nodes:       NodeConfig{ControlPlane: true},
+		TenantLabel: TENANT_LABEL,
+		Audit: AuditConfig{
+			Retention: v1.Duration{Duration: AUDIT_RETENTION},
+			Redact:    true,
+		},
+		Correlation: CorrelationConfig{
+			Enabled: true,
+			Window:  v1.Duration{Duration: CORRELATION_WINDOW},
+			Delay:   v1.Duration{Duration: CORRELATION_DELAY},
+			ByNode:  true,
+		},
+		Flapping: FlappingConfig{
+			Threshold: FLAPPING_THRESHOLD,
+			Window:    v1.Duration{Duration: FLAPPING_WINDOW},
+		},
+		Remediation: RemediationConfig{
+			Actions:           []string{ACTION_ROLLOUT_RESTART, ACTION_DELETE_POD, ACTION_BUMP_MEMORY},
+			MemoryBumpPercent: 25,
+		},
+	}
+	c.prompt = template.Must(template.New("prompt").Parse(c.PromptTemplate))
+	return c
+}
+
+func cfg() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return currentConfig
+}
+
+func configPath() string {
+	if p := os.Getenv("CONFIG_FILE"); p != "" {
+		return p
+	}
+	return CONFIG_FILE
+}
+
+// parseConfig overlays the file on top of the defaults, so a ConfigMap only
+// has to set the keys it wants to change.
+func parseConfig(data []byte) (*Config, error) {
+	c := defaultConfig()
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	t, err := template.New("prompt").Parse(c.PromptTemplate)
+	if err != nil {
+		return nil, err
+	}
+	c.prompt = t
+	return c, nil
+}
+
+// watchConfig polls the config file and swaps in new settings when its
+// content changes. Polling the content rather than using inotify copes with
+// the symlink swap kubelet performs when a mounted ConfigMap is updated.
+func watchConfig(path string, last []byte) {
+	for {
+		time.Sleep(CONFIG_RELOAD_INTERVAL)
+		last = reloadConfig(path, last)
+	}
+}
+
+func reloadConfig(path string, last []byte) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if last != nil || !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to read config %s: %v", path, err)
+		}
+		return last
+	}
+	if bytes.Equal(data, last) {
+		return last
+	}
+
+	c, err := parseConfig(data)
+	if err != nil {
+		log.Printf("❌ Invalid config %s, keeping previous settings: %v", path, err)
+		return data
+	}
+	configMu.Lock()
+	currentConfig = c
+	configMu.Unlock()
+
+	if last == nil {
+		log.Printf("⚙️ Loaded config from %s", path)
+	} else {
+		log.Printf("🔄 Reloaded config from %s", path)
+	}
+	return data
+}
+
+func (c *Config) watchesNamespace(namespace string) bool {
+	for _, ns := range c.ExcludeNamespaces {
+		if ns == namespace {
+			return false
+		}
+	}
+	if len(c.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range c.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+type PromptData struct {
+	Type       string
+	Restarts   int
+	Window     string
+	Events     string
+	Resources  string
+	Probes     string
+	ProbeKind  string
+	Storage    string
+	Network    string
+	Autoscaler string
+	Replica    string
+	Enrichment string
+	Runbooks   string
+	Language   string
+	Changes    string
+	Delivery   string
+	History    string
+	Registry   string
+	Errors     string
+	Logs       string
+}
+
+func renderPrompt(t *template.Template, data PromptData) string {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		log.Printf("⚠️ Prompt template failed, using default: %v", err)
+		b.Reset()
+		defaultConfig().prompt.Execute(&b, data)
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const CHANGE_WINDOW = 30 * time.Minute
+
+type configVersion struct {
+	resourceVersion string
+	changed         time.Time
+}
+
+// configVersions remembers the resourceVersion of each ConfigMap and Secret
+// looked at, so a change is noticed even when the object carries no
+// managedFields timestamps.
+var (
+	configVersionsMu sync.Mutex
+	configVersions   = map[string]configVersion{}
+)
+
+// referencedConfig lists the ConfigMaps and Secrets a pod reads through
+// volumes, projected volumes, env and envFrom.
+func referencedConfig(pod *corev1.Pod) (configMaps, secrets []string) {
+	cms, secs := map[string]bool{}, map[string]bool{}
+	for _, v := range pod.Spec.Volumes {
+		if v.ConfigMap != nil {
+			cms[v.ConfigMap.Name] = true
+		}
+		if v.Secret != nil {
+			secs[v.Secret.SecretName] = true
+		}
+		if v.Projected != nil {
+			for _, s := range v.Projected.Sources {
+				if s.ConfigMap != nil {
+					cms[s.ConfigMap.Name] = true
+				}
+				if s.Secret != nil {
+					secs[s.Secret.Name] = true
+				}
+			}
+		}
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.ConfigMapRef != nil {
+				cms[e.ConfigMapRef.Name] = true
+			}
+			if e.SecretRef != nil {
+				secs[e.SecretRef.Name] = true
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if e.ValueFrom.ConfigMapKeyRef != nil {
+				cms[e.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+			if e.ValueFrom.SecretKeyRef != nil {
+				secs[e.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+	}
+	for name := range cms {
+		configMaps = append(configMaps, name)
+	}
+	for name := range secs {
+		secrets = append(secrets, name)
+	}
+	sort.Strings(configMaps)
+	sort.Strings(secrets)
+	return configMaps, secrets
+}
+
+// configChanges reports the ConfigMaps and Secrets of the pod that were
+// updated within the window before the crash, e.g. "configmap `app-config`
+// updated 3 minutes before the crash".
+func configChanges(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, crash time.Time, window time.Duration) []string {
+	configMaps, secrets := referencedConfig(pod)
+
+	var changes []string
+	check := func(kind, name string, meta v1.ObjectMeta) {
+		changed := lastModified(kind, pod.Namespace, meta)
+		if changed.IsZero() || changed.After(crash) || crash.Sub(changed) > window {
+			return
+		}
+		changes = append(changes, fmt.Sprintf("%s `%s` updated %s before the crash (resourceVersion %s)", kind, name, humanDuration(crash.Sub(changed)), meta.ResourceVersion))
+	}
+	for _, name := range configMaps {
+		if cm, err := clientset.CoreV1().ConfigMaps(pod.Namespace).Get(ctx, name, v1.GetOptions{}); err == nil {
+			check("configmap", name, cm.ObjectMeta)
+		}
+	}
+	for _, name := range secrets {
+		// Only the metadata is used; secret data never leaves this function.
+		if s, err := clientset.CoreV1().Secrets(pod.Namespace).Get(ctx, name, v1.GetOptions{}); err == nil {
+			check("secret", name, s.ObjectMeta)
+		}
+	}
+	return changes
+}
+
+// lastModified is the latest write recorded in managedFields, or the time a
+// new resourceVersion was first seen, falling back to creation.
+func lastModified(kind, namespace string, meta v1.ObjectMeta) time.Time {
+	changed := meta.CreationTimestamp.Time
+	for _, f := range meta.ManagedFields {
+		if f.Time != nil && f.Time.After(changed) {
+			changed = f.Time.Time
+		}
+	}
+
+	key := kind + "/" + namespace + "/" + meta.Name
+	configVersionsMu.Lock()
+	defer configVersionsMu.Unlock()
+	prev, seen := configVersions[key]
+	switch {
+	case !seen:
+		configVersions[key] = configVersion{resourceVersion: meta.ResourceVersion}
+	case prev.resourceVersion != meta.ResourceVersion:
+		prev = configVersion{resourceVersion: meta.ResourceVersion, changed: time.Now()}
+		configVersions[key] = prev
+	}
+	if prev.changed.After(changed) && len(meta.ManagedFields) == 0 {
+		changed = prev.changed
+	}
+	return changed
+}
+
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	case d < 2*time.Minute:
+		return "1 minute"
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	CORRELATION_WINDOW = 5 * time.Minute
+	CORRELATION_DELAY  = time.Minute
+
+	CORRELATION_PROMPT = `Several Kubernetes workloads failed within a few minutes of each other and look related (%s). Find the single root cause that explains them: say which workload is most likely the origin and which failed as a consequence, and suggest a fix for the origin. Do not analyze each failure separately.
+
+%s`
+)
+
+// CorrelationConfig controls how incidents that share a root cause are
+// grouped into one alert.
+type CorrelationConfig struct {
+	Enabled bool        `json:"enabled"`
+	Window  v1.Duration `json:"window"`
+	Delay   v1.Duration `json:"delay"`
+	ByNode  bool        `json:"byNode"`
+}
+
+var (
+	dependencyEnvPattern = regexp.MustCompile(`(?i)(host|hosts|addr|address|url|uri|dsn|endpoint|server|servers)$`)
+	volatilePattern      = regexp.MustCompile(`[0-9a-f]{8,}|\d+`)
+)
+
+// correlationInfo is what incidents are matched by: where the pod ran, the
+// errors it logged, the services it serves and the services it calls.
+type correlationInfo struct {
+	Node     string
+	Errors   map[string]bool
+	Provides map[string]bool
+	Depends  map[string]bool
+
+	errorLines string
+}
+
+type correlated struct {
+	Incident *Incident
+	Info     correlationInfo
+	Reason   string
+
+	// ready is set once the incident's alert is posted; members that join
+	// before are announced in its thread then.
+	ready     bool
+	announced bool
+}
+
+// correlationGroup collects incidents explained by the same root cause. The
+// first incident keeps its alert; the others are added to its thread and a
+// combined analysis follows once no new member arrived for the delay.
+type correlationGroup struct {
+	Lead    *correlated
+	Members []*correlated
+	timer   *time.Timer
+}
+
+var (
+	correlationMu sync.Mutex
+	recentAlerts  []*correlated
+	groups        = map[string]*correlationGroup{}
+)
+
+func correlationInfoFor(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, errorLines string) correlationInfo {
+	info := correlationInfo{
+		Node:       pod.Spec.NodeName,
+		Errors:     map[string]bool{},
+		Provides:   map[string]bool{},
+		Depends:    map[string]bool{},
+		errorLines: errorLines,
+	}
+	for _, line := range strings.Split(errorLines, "\n") {
+		if normalized := normalizeError(line); len(normalized) >= 20 {
+			info.Errors[normalized] = true
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, env := range c.Env {
+			if env.Value == "" || !dependencyEnvPattern.MatchString(env.Name) {
+				continue
+			}
+			for _, host := range dependencyHosts(env.Value, pod.Namespace) {
+				info.Depends[host] = true
+			}
+		}
+	}
+	if allowed(pod.Namespace, "list", "services") {
+		if services, err := clientset.CoreV1().Services(pod.Namespace).List(ctx, v1.ListOptions{}); err == nil {
+			for _, svc := range services.Items {
+				if len(svc.Spec.Selector) > 0 && labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+					info.Provides[svc.Name+"."+svc.Namespace] = true
+				}
+			}
+		}
+	}
+	return info
+}
+
+// normalizeError strips what differs between occurrences of the same error
+// (timestamps, IDs, ports, counters) so errors can be compared across pods.
+func normalizeError(line string) string {
+	line = strings.ToLower(strings.TrimSpace(line))
+	return strings.Join(strings.Fields(volatilePattern.ReplaceAllString(line, "#")), " ")
+}
+
+// dependencyHosts reads service hosts from an address-like env value such as
+// "postgres:5432", "redis.cache.svc.cluster.local" or
+// "amqp://user@rabbitmq.mq:5672/", as name.namespace.
+func dependencyHosts(value, namespace string) []string {
+	var hosts []string
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if i := strings.Index(addr, "://"); i >= 0 {
+			addr = addr[i+3:]
+		}
+		if i := strings.LastIndex(addr, "@"); i >= 0 {
+			addr = addr[i+1:]
+		}
+		if i := strings.IndexAny(addr, ":/?"); i >= 0 {
+			addr = addr[:i]
+		}
+		parts := strings.Split(strings.ToLower(addr), ".")
+		if parts[0] == "" || strings.ContainsAny(parts[0], " =") {
+			continue
+		}
+		ns := namespace
+		if len(parts) > 1 && parts[1] != "svc" {
+			ns = parts[1]
+		}
+		hosts = append(hosts, parts[0]+"."+ns)
+	}
+	return hosts
+}
+
+// correlationReason explains why two incidents likely share a root cause,
+// or returns "" if nothing links them.
+func correlationReason(config *Config, a, b correlationInfo, aName, bName string) string {
+	for host := range a.Depends {
+		if b.Provides[host] {
+			return fmt.Sprintf("`%s` depends on `%s`, served by `%s`", aName, host, bName)
+		}
+	}
+	for host := range b.Depends {
+		if a.Provides[host] {
+			return fmt.Sprintf("`%s` depends on `%s`, served by `%s`", bName, host, aName)
+		}
+	}
+	for e := range a.Errors {
+		if b.Errors[e] {
+			return fmt.Sprintf("same error: `%s`", truncate(e, 120))
+		}
+	}
+	if config.Correlation.ByNode && a.Node != "" && a.Node == b.Node {
+		return fmt.Sprintf("same node `%s`", a.Node)
+	}
+	return ""
+}
+
+// correlate adds the incident to the group of a recent incident it
+// correlates with and reports whether it did; joined incidents get no alert
+// or analysis of their own. Otherwise the incident is remembered so later
+// ones can join it, even while its own analysis is still running.
+func correlate(config *Config, inc *Incident, info correlationInfo) bool {
+	if !config.Correlation.Enabled {
+		return false
+	}
+	correlationMu.Lock()
+	pruneCorrelations(config)
+
+	for _, recent := range recentAlerts {
+		if recent.Incident.Workload == inc.Workload && recent.Incident.Namespace == inc.Namespace {
+			continue
+		}
+		reason := correlationReason(config, info, recent.Info, inc.Workload, recent.Incident.Workload)
+		if reason == "" {
+			continue
+		}
+
+		lead := recent
+		if group, ok := groupOf(recent.Incident); ok {
+			lead = group.Lead
+		}
+		group, ok := groups[lead.Incident.ID]
+		if !ok {
+			group = &correlationGroup{Lead: lead}
+			groups[lead.Incident.ID] = group
+		}
+		member := &correlated{Incident: inc, Info: info, Reason: reason, ready: true}
+		group.Members = append(group.Members, member)
+		recentAlerts = append(recentAlerts, member)
+		incidentsMu.Lock()
+		inc.GroupID = lead.Incident.ID
+		lead.Incident.GroupID = lead.Incident.ID
+		incidentsMu.Unlock()
+
+		delay := config.Correlation.Delay.Duration
+		if group.timer == nil {
+			group.timer = time.AfterFunc(delay, func() { analyzeGroup(group) })
+		} else {
+			group.timer.Reset(delay)
+		}
+		var announce []*correlated
+		if lead.ready {
+			announce = announceMembers(group)
+		}
+		correlationMu.Unlock()
+
+		log.Printf("🔗 Correlated %s [%s] with incident %s: %s", inc.Pod, inc.Namespace, lead.Incident.ID, reason)
+		postAnnouncements(lead.Incident, announce)
+		return true
+	}
+
+	recentAlerts = append(recentAlerts, &correlated{Incident: inc, Info: info})
+	correlationMu.Unlock()
+	return false
+}
+
+// correlationReady marks the incident's alert as posted and announces the
+// incidents that joined it in the meantime.
+func correlationReady(inc *Incident) {
+	correlationMu.Lock()
+	var announce []*correlated
+	for _, c := range recentAlerts {
+		if c.Incident == inc {
+			c.ready = true
+		}
+	}
+	if group, ok := groups[inc.ID]; ok {
+		group.Lead.ready = true
+		announce = announceMembers(group)
+	}
+	correlationMu.Unlock()
+	postAnnouncements(inc, announce)
+}
+
+// announceMembers must be called with correlationMu held. It returns the
+// members not yet announced in the lead's thread and points them at it.
+func announceMembers(group *correlationGroup) []*correlated {
+	var pending []*correlated
+	lead := group.Lead.Incident
+	incidentsMu.Lock()
+	for _, m := range group.Members {
+		if !m.announced {
+			m.announced = true
+			m.Incident.Channel, m.Incident.ThreadTS = lead.Channel, lead.ThreadTS
+			pending = append(pending, m)
+		}
+	}
+	incidentsMu.Unlock()
+	return pending
+}
+
+func postAnnouncements(lead *Incident, members []*correlated) {
+	if lead.ThreadTS == "" {
+		return
+	}
+	for _, m := range members {
+		sendSlackThread(lead.Channel, lead.ThreadTS, fmt.Sprintf("🔗 *Also affected:* `%s` [%s] (%s) — %s",
+			m.Incident.Pod, m.Incident.Namespace, m.Incident.Reason, m.Reason))
+	}
+}
+
+// groupOf must be called with correlationMu held.
+func groupOf(inc *Incident) (*correlationGroup, bool) {
+	if inc.GroupID == "" {
+		return nil, false
+	}
+	group, ok := groups[inc.GroupID]
+	return group, ok
+}
+
+// pruneCorrelations must be called with correlationMu held.
+func pruneCorrelations(config *Config) {
+	cutoff := time.Now().Add(-config.Correlation.Window.Duration)
+	kept := recentAlerts[:0]
+	for _, c := range recentAlerts {
+		if c.Incident.Time.After(cutoff) {
+			kept = append(kept, c)
+		}
+	}
+	recentAlerts = kept
+	for id, group := range groups {
+		if group.Lead.Incident.Time.Before(cutoff.Add(-config.Correlation.Delay.Duration)) {
+			delete(groups, id)
+		}
+	}
+}
+
+// analyzeGroup asks the model for one root cause behind all incidents of the
+// group and posts it to the lead incident's thread.
+func analyzeGroup(group *correlationGroup) {
+	config := cfg().forNamespace(group.Lead.Incident.Namespace)
+	correlationMu.Lock()
+	if !group.Lead.ready {
+		// The lead's own alert is still being analyzed; wait for its thread.
+		if time.Since(group.Lead.Incident.Time) < config.Correlation.Window.Duration+config.Timeouts.Analysis.Duration {
+			group.timer.Reset(config.Correlation.Delay.Duration)
+		}
+		correlationMu.Unlock()
+		return
+	}
+	all := append([]*correlated{group.Lead}, group.Members...)
+	correlationMu.Unlock()
+
+	var reasons []string
+	seen := map[string]bool{}
+	texts := make([]string, len(all))
+	sections := make([]promptSection, len(all))
+	for i, c := range all {
+		if c.Reason != "" && !seen[c.Reason] {
+			seen[c.Reason] = true
+			reasons = append(reasons, c.Reason)
+		}
+		texts[i] = c.Info.errorLines
+		sections[i] = promptSection{name: "errors of " + c.Incident.Pod, text: &texts[i], weight: 1}
+	}
+	sort.Strings(reasons)
+
+	ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+	defer cancel()
+	ctx = withUsage(ctx, group.Lead.Incident.Namespace)
+	overhead := estimateTokens(config.model(), fmt.Sprintf(CORRELATION_PROMPT, strings.Join(reasons, "; "), ""))
+	budgetSections(ctx, config, overhead, sections)
+
+	var b strings.Builder
+	for i, c := range all {
+		inc := c.Incident
+		fmt.Fprintf(&b, "### %s [%s], workload %s, node %s: %s (exit code %d) at %s\n%s\n\n",
+			inc.Pod, inc.Namespace, inc.Workload, c.Info.Node, inc.Reason, inc.ExitCode, inc.Time.Format(time.RFC3339), texts[i])
+	}
+	analysis, err := callModel(ctx, config, fmt.Sprintf(CORRELATION_PROMPT, strings.Join(reasons, "; "), b.String())+languageInstruction(group.Lead.Incident.Language))
+	if err != nil {
+		log.Printf("❌ Failed to analyze correlated incidents of %s: %v", group.Lead.Incident.ID, err)
+		return
+	}
+
+	lead := group.Lead.Incident
+	log.Printf("🧩 Combined analysis of %d correlated incidents (lead %s)", len(all), lead.ID)
+	if lead.ThreadTS != "" {
+		combined := viewSection{Emoji: "🧩", Title: fmt.Sprintf("Combined root-cause analysis (%d incidents)", len(all)), Body: analysis, Prose: true}
+		sendSlackThread(lead.Channel, lead.ThreadTS, localized(formatterFor(FORMAT_MRKDWN), lead.Language).Section(combined))
+	}
+	promptTokens, responseTokens := usageOf(ctx)
+	incidentsMu.Lock()
+	for _, c := range group.Members {
+		c.Incident.Analysis = analysis
+	}
+	lead.PromptTokens += promptTokens
+	lead.ResponseTokens += responseTokens
+	incidentsMu.Unlock()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var enablePprof = flag.Bool("pprof", false, "serve the Go profiler under /debug/pprof/ (requires API_TOKEN like the API)")
+
+// callResult is the outcome of the most recent call to an external service.
+type callResult struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var (
+	startedAt = time.Now()
+
+	debugMu       sync.Mutex
+	lastModelCall *callResult
+	lastModelOK   time.Time
+	lastSlackCall *callResult
+	lastSlackOK   time.Time
+	notifiedSize  int
+)
+
+// observedModel records the outcome of every model call for /debug/status.
+type observedModel struct {
+	ModelClient
+}
+
+func (m observedModel) Complete(ctx context.Context, config *Config, prompt string) (string, error) {
+	start := time.Now()
+	text, err := m.ModelClient.Complete(ctx, config, prompt)
+	recordModelCall(config.model(), start, err)
+	return text, err
+}
+
+func (m observedModel) CompleteStructured(ctx context.Context, config *Config, prompt string) (string, error) {
+	start := time.Now()
+	text, err := m.ModelClient.CompleteStructured(ctx, config, prompt)
+	recordModelCall(config.model(), start, err)
+	return text, err
+}
+
+func recordModelCall(model string, start time.Time, err error) {
+	r := &callResult{Time: time.Now(), Method: model, Duration: time.Since(start).Round(time.Millisecond).String()}
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		lastModelOK = r.Time
+	}
+	lastModelCall = r
+}
+
+// recordSlackCall notes the outcome of a Slack API call; problem is empty
+// on success.
+func recordSlackCall(method string, start time.Time, problem string) {
+	r := &callResult{Time: time.Now(), Method: method, Duration: time.Since(start).Round(time.Millisecond).String(), Error: problem}
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	if problem == "" {
+		lastSlackOK = r.Time
+	}
+	lastSlackCall = r
+}
+
+// recordNotifiedSize notes the size of the map of already reported
+// restarts, which only the main loop may read.
+func recordNotifiedSize(n int) {
+	debugMu.Lock()
+	notifiedSize = n
+	debugMu.Unlock()
+}
+
+func registerDebugHandlers() {
+	mux.HandleFunc("/debug/status", requireToken(handleDebugStatus))
+	if !*enablePprof {
+		return
+	}
+	mux.HandleFunc("/debug/pprof/", requireToken(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", requireToken(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", requireToken(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", requireToken(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", requireToken(pprof.Trace))
+}
+
+type pollStatus struct {
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Backoff             string     `json:"backoff,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// handleDebugStatus serves GET /debug/status: what the analyzer is doing
+// and when its loops and outbound calls last succeeded, for finding out why
+// alerts stopped arriving.
+func handleDebugStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	status := map[string]interface{}{
+		"startedAt":  startedAt.UTC(),
+		"uptime":     time.Since(startedAt).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"heapBytes":  mem.HeapAlloc,
+		"readOnly":   *readOnly,
+		"dryRun":     *dryRun,
+	}
+
+	retryMu.Lock()
+	queued := len(retryQueue)
+	retryMu.Unlock()
+	analysesMu.Lock()
+	running := len(analyses)
+	analysesMu.Unlock()
+	deepMu.Lock()
+	deep := len(deepRequests)
+	deepMu.Unlock()
+	proposalsMu.Lock()
+	pending := len(proposals)
+	proposalsMu.Unlock()
+	status["queues"] = map[string]int{
+		"runningAnalyses":      running,
+		"analysisRetries":      queued,
+		"deepAnalyses":         deep,
+		"remediationProposals": pending,
+	}
+
+	slackEventsMu.Lock()
+	events := len(slackEventsSeen)
+	slackEventsMu.Unlock()
+	overridesMu.Lock()
+	overrides := len(overridesCache)
+	overridesMu.Unlock()
+	incidentsMu.Lock()
+	kept := len(incidents)
+	incidentsMu.Unlock()
+	debugMu.Lock()
+	status["dedup"] = map[string]int{
+		"notifiedRestarts":  notifiedSize,
+		"slackEvents":       events,
+		"workloadOverrides": overrides,
+		"incidents":         kept,
+	}
+	status["model"] = map[string]interface{}{"last": lastModelCall, "lastSuccess": nonZero(lastModelOK)}
+	status["slack"] = map[string]interface{}{"last": lastSlackCall, "lastSuccess": nonZero(lastSlackOK)}
+	debugMu.Unlock()
+
+	polls := map[string]pollStatus{}
+	apiMu.Lock()
+	for loop, t := range pollSucceeded {
+		p := polls[loop]
+		p.LastSuccess = nonZero(t)
+		polls[loop] = p
+	}
+	for loop, n := range pollFailures {
+		p := polls[loop]
+		p.ConsecutiveFailures, p.LastError = n, pollErrors[loop]
+		if d := pollBackoffs[loop]; d > 0 {
+			p.Backoff = d.Round(time.Second).String()
+		}
+		polls[loop] = p
+	}
+	status["polls"] = polls
+	status["apiserver"] = map[string]int{"requests": apiRequests, "errors": apiErrors, "throttled": apiThrottled}
+	apiMu.Unlock()
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func nonZero(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
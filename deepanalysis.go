@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DEEP_ANALYZE_ACTION_ID = "deep-analyze"
+	DEEP_ANALYSIS_TTL      = 24 * time.Hour
+)
+
+// deepRequest keeps what the model needs for an incident that was only
+// classified by the heuristics, so the full analysis can run when someone
+// asks for it.
+type deepRequest struct {
+	Incident *Incident
+	Template *template.Template
+	Data     PromptData
+	Channel  string
+	Summary  string
+	Created  time.Time
+}
+
+var (
+	deepMu       sync.Mutex
+	deepRequests = map[string]*deepRequest{}
+)
+
+// postQuickDiagnosis posts the heuristic diagnosis into the incident thread
+// with a button that runs the LLM analysis on demand.
+func postQuickDiagnosis(channel string, inc *Incident, class *analyzer.Classification, tmpl *template.Template, data PromptData) {
+	text := "⚡ *Quick diagnosis* (`" + class.Category + "`):\n" + class.Summary + "\n*Suggested fix:* " + class.Fix
+
+	deepMu.Lock()
+	for id, r := range deepRequests {
+		if time.Since(r.Created) > DEEP_ANALYSIS_TTL {
+			delete(deepRequests, id)
+		}
+	}
+	deepRequests[inc.ID] = &deepRequest{
+		Incident: inc,
+		Template: tmpl,
+		Data:     data,
+		Channel:  channel,
+		Summary:  text,
+		Created:  time.Now(),
+	}
+	deepMu.Unlock()
+
+	ts := postToSlack(map[string]interface{}{
+		"channel":   channel,
+		"thread_ts": inc.ThreadTS,
+		"text":      text,
+		"blocks": []interface{}{
+			map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": truncate(text, 2900)}},
+			map[string]interface{}{"type": "actions", "elements": []interface{}{
+				map[string]interface{}{
+					"type":      "button",
+					"text":      map[string]string{"type": "plain_text", "text": "🔬 Deep analyze"},
+					"action_id": DEEP_ANALYZE_ACTION_ID,
+					"value":     inc.ID,
+				},
+			}},
+		},
+	})
+	incidentsMu.Lock()
+	inc.AnalysisTS = ts
+	incidentsMu.Unlock()
+}
+
+func handleDeepAnalyze(clientset kubernetes.Interface, dyn dynamic.Interface, in SlackInteraction) {
+	deepMu.Lock()
+	r, ok := deepRequests[in.Value]
+	delete(deepRequests, in.Value)
+	deepMu.Unlock()
+	if !ok {
+		replaceInteractiveMessage(in.ResponseURL, "⌛ The context for this incident has expired or was already analyzed.")
+		return
+	}
+
+	inc := r.Incident
+	log.Printf("🔬 Deep analysis of %s [%s] requested by %s (%s)", inc.Pod, inc.Namespace, in.UserName, in.UserID)
+	replaceInteractiveMessage(in.ResponseURL, r.Summary+fmt.Sprintf("\n\n🔬 Deep analysis requested by <@%s>, running…", in.UserID))
+
+	config := cfg().forNamespace(inc.Namespace).forIncident(r.Data.Type)
+	data := r.Data
+	ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+	defer cancel()
+	ctx = withUsage(ctx, inc.Namespace)
+	fitPromptData(ctx, config, r.Template, &data)
+	analysis, structured, err := analyzeWithModel(ctx, config, renderPrompt(r.Template, data))
+	if err != nil {
+		log.Printf("❌ Failed to analyze pod %s: %v", inc.Pod, err)
+		sendSlackThread(r.Channel, inc.ThreadTS, fmt.Sprintf("❌ Deep analysis failed: %v", err))
+		return
+	}
+
+	postAnalysis(clientset, r.Channel, inc, analysis)
+
+	promptTokens, responseTokens := usageOf(ctx)
+	recordAnalysis(dyn, config, inc, analysis, structured, promptTokens, responseTokens)
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DELIVERY_ARGOCD   = "ArgoCD"
+	DELIVERY_FLUX     = "Flux"
+	DELIVERY_ROLLOUTS = "Argo Rollouts"
+
+	ARGOCD_NAMESPACE           = "argocd"
+	ARGOCD_TRACKING_ANNOTATION = "argocd.argoproj.io/tracking-id"
+	ARGOCD_INSTANCE_LABEL      = "app.kubernetes.io/instance"
+	FLUX_KUSTOMIZATION_LABEL   = "kustomize.toolkit.fluxcd.io"
+	FLUX_HELMRELEASE_LABEL     = "helm.toolkit.fluxcd.io"
+	ROLLOUT_HASH_LABEL         = "rollouts-pod-template-hash"
+
+	DELIVERY_EVENT_REASON = "PodAnalyzerIncident"
+)
+
+var (
+	argoApplications   = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+	argoRollouts       = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	fluxKustomizations = schema.GroupVersionResource{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Resource: "kustomizations"}
+	fluxHelmReleases   = schema.GroupVersionResource{Group: "helm.toolkit.fluxcd.io", Version: "v2", Resource: "helmreleases"}
+)
+
+// DeliveryConfig sets up the GitOps and progressive delivery integration.
+// What delivers a workload is always looked up and shown; recordEvents adds
+// an Event on the ArgoCD Application, Flux Kustomization or HelmRelease for
+// each alert, and pauseRollouts pauses an Argo Rollout whose canary starts
+// crash looping.
+type DeliveryConfig struct {
+	ArgoCDNamespace string `json:"argocdNamespace"`
+	RecordEvents    bool   `json:"recordEvents"`
+	PauseRollouts   bool   `json:"pauseRollouts"`
+}
+
+// delivery is a GitOps or progressive delivery object managing a workload.
+type delivery struct {
+	Tool       string
+	Resource   schema.GroupVersionResource
+	Kind       string
+	Namespace  string
+	Name       string
+	UID        types.UID
+	Status     string
+	Revision   string
+	Source     string
+	LastChange time.Time
+
+	// Argo Rollouts only: the rollout is progressing, and the pod runs the
+	// new revision rather than the stable one.
+	Progressing bool
+	Canary      bool
+	Paused      bool
+}
+
+func (d *delivery) String() string {
+	s := fmt.Sprintf("%s %s `%s/%s`: %s", d.Tool, d.Kind, d.Namespace, d.Name, d.Status)
+	if d.Revision != "" {
+		s += fmt.Sprintf(", revision `%s`", d.Revision)
+	}
+	if d.Source != "" {
+		s += " from " + d.Source
+	}
+	if !d.LastChange.IsZero() {
+		s += fmt.Sprintf(" (last change %s ago)", humanDuration(time.Since(d.LastChange)))
+	}
+	return s
+}
+
+// deliveriesOf finds what delivers the pod's workload: an Argo Rollout
+// owning its ReplicaSet, the ArgoCD Application tracking the workload, and
+// the Flux Kustomization or HelmRelease that applied it. Tools that are not
+// installed or not allowed are skipped.
+func deliveriesOf(ctx context.Context, clientset kubernetes.Interface, dyn dynamic.Interface, config *Config, pod *corev1.Pod) []*delivery {
+	var found []*delivery
+	meta, _ := workloadMeta(ctx, clientset, pod)
+	if r := rolloutOf(ctx, clientset, dyn, pod); r != nil {
+		found = append(found, r.delivery)
+		meta = r.meta
+	}
+	if meta == nil {
+		return found
+	}
+	if d := argoApplicationOf(ctx, dyn, config, meta); d != nil {
+		found = append(found, d)
+	}
+	if d := fluxObjectOf(ctx, dyn, meta); d != nil {
+		found = append(found, d)
+	}
+	return found
+}
+
+type rollout struct {
+	delivery *delivery
+	meta     *v1.ObjectMeta
+}
+
+func rolloutOf(ctx context.Context, clientset kubernetes.Interface, dyn dynamic.Interface, pod *corev1.Pod) *rollout {
+	kind, rsName := podController(pod)
+	if kind != "ReplicaSet" || !allowed(pod.Namespace, "get", "replicasets.apps") || !allowed(pod.Namespace, "get", "rollouts.argoproj.io") {
+		return nil
+	}
+	rs, err := clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, rsName, v1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	var name string
+	for _, ref := range rs.OwnerReferences {
+		if ref.Kind == "Rollout" && ref.Controller != nil && *ref.Controller {
+			name = ref.Name
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	u, err := dyn.Resource(argoRollouts).Namespace(pod.Namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		log.Printf("⚠️ Failed to get Rollout %s/%s: %v", pod.Namespace, name, err)
+		return nil
+	}
+
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(u.Object, "status", "message")
+	stable, _, _ := unstructured.NestedString(u.Object, "status", "stableRS")
+	step, hasStep, _ := unstructured.NestedInt64(u.Object, "status", "currentStepIndex")
+	steps, _, _ := unstructured.NestedSlice(u.Object, "spec", "strategy", "canary", "steps")
+	paused, _, _ := unstructured.NestedBool(u.Object, "spec", "paused")
+	hash := pod.Labels[ROLLOUT_HASH_LABEL]
+
+	d := &delivery{
+		Tool: DELIVERY_ROLLOUTS, Resource: argoRollouts, Kind: "Rollout",
+		Namespace: pod.Namespace, Name: name, UID: u.GetUID(),
+		Progressing: phase == "Progressing",
+		Canary:      stable != "" && hash != "" && hash != stable,
+		Paused:      paused,
+	}
+	d.Status = phase
+	if d.Status == "" {
+		d.Status = "Unknown"
+	}
+	if hasStep && len(steps) > 0 {
+		d.Status += fmt.Sprintf(", step %d/%d", step, len(steps))
+	}
+	if message != "" {
+		d.Status += " (" + message + ")"
+	}
+	if d.Canary {
+		d.Status += fmt.Sprintf(", pod runs the new revision `%s` (stable `%s`)", hash, stable)
+	} else if hash != "" && hash == stable {
+		d.Status += ", pod runs the stable revision"
+	}
+	return &rollout{delivery: d, meta: &v1.ObjectMeta{Name: u.GetName(), Namespace: u.GetNamespace(), Labels: u.GetLabels(), Annotations: u.GetAnnotations()}}
+}
+
+// argoApplicationOf looks up the Application named by the workload's
+// tracking annotation, or else by its instance label.
+func argoApplicationOf(ctx context.Context, dyn dynamic.Interface, config *Config, meta *v1.ObjectMeta) *delivery {
+	namespace := config.Delivery.ArgoCDNamespace
+	if namespace == "" {
+		namespace = ARGOCD_NAMESPACE
+	}
+	name := meta.Labels[ARGOCD_INSTANCE_LABEL]
+	if id := meta.Annotations[ARGOCD_TRACKING_ANNOTATION]; id != "" {
+		// <app>:<group>/<kind>:<namespace>/<name>, where apps outside the
+		// ArgoCD namespace are <namespace>_<app>.
+		name = strings.SplitN(id, ":", 2)[0]
+		if i := strings.Index(name, "_"); i >= 0 {
+			namespace, name = name[:i], name[i+1:]
+		}
+	}
+	if name == "" || !allowed(namespace, "get", "applications.argoproj.io") {
+		return nil
+	}
+	u, err := dyn.Resource(argoApplications).Namespace(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Printf("⚠️ Failed to get ArgoCD Application %s/%s: %v", namespace, name, err)
+		}
+		return nil
+	}
+
+	sync, _, _ := unstructured.NestedString(u.Object, "status", "sync", "status")
+	health, _, _ := unstructured.NestedString(u.Object, "status", "health", "status")
+	operation, _, _ := unstructured.NestedString(u.Object, "status", "operationState", "phase")
+	finished, _, _ := unstructured.NestedString(u.Object, "status", "operationState", "finishedAt")
+	revision, _, _ := unstructured.NestedString(u.Object, "status", "sync", "revision")
+	if revision == "" {
+		revisions, _, _ := unstructured.NestedStringSlice(u.Object, "status", "sync", "revisions")
+		revision = strings.Join(revisions, ", ")
+	}
+	repo, _, _ := unstructured.NestedString(u.Object, "spec", "source", "repoURL")
+	path, _, _ := unstructured.NestedString(u.Object, "spec", "source", "path")
+
+	d := &delivery{
+		Tool: DELIVERY_ARGOCD, Resource: argoApplications, Kind: "Application",
+		Namespace: namespace, Name: name, UID: u.GetUID(),
+		Status:   fmt.Sprintf("sync %s, health %s", orNone(sync), orNone(health)),
+		Revision: shortRevision(revision),
+		Source:   strings.TrimSuffix(repo+" "+path, " "),
+	}
+	if operation != "" {
+		d.Status += ", last sync " + operation
+	}
+	if t, err := time.Parse(time.RFC3339, finished); err == nil {
+		d.LastChange = t
+	}
+	return d
+}
+
+// fluxObjectOf looks up the Kustomization or HelmRelease named by the labels
+// Flux puts on everything it applies.
+func fluxObjectOf(ctx context.Context, dyn dynamic.Interface, meta *v1.ObjectMeta) *delivery {
+	for _, f := range []struct {
+		label    string
+		kind     string
+		resource schema.GroupVersionResource
+	}{
+		{FLUX_KUSTOMIZATION_LABEL, "Kustomization", fluxKustomizations},
+		{FLUX_HELMRELEASE_LABEL, "HelmRelease", fluxHelmReleases},
+	} {
+		name, namespace := meta.Labels[f.label+"/name"], meta.Labels[f.label+"/namespace"]
+		if name == "" || namespace == "" || !allowed(namespace, "get", f.resource.Resource+"."+f.resource.Group) {
+			continue
+		}
+		u, err := dyn.Resource(f.resource).Namespace(namespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				log.Printf("⚠️ Failed to get Flux %s %s/%s: %v", f.kind, namespace, name, err)
+			}
+			continue
+		}
+
+		d := &delivery{
+			Tool: DELIVERY_FLUX, Resource: f.resource, Kind: f.kind,
+			Namespace: namespace, Name: name, UID: u.GetUID(),
+			Status: "Ready Unknown",
+		}
+		d.Revision, _, _ = unstructured.NestedString(u.Object, "status", "lastAppliedRevision")
+		attempted, _, _ := unstructured.NestedString(u.Object, "status", "lastAttemptedRevision")
+		conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+		for _, c := range conditions {
+			cond, _ := c.(map[string]interface{})
+			if cond["type"] != "Ready" {
+				continue
+			}
+			d.Status = fmt.Sprintf("Ready %v", cond["status"])
+			if reason, _ := cond["reason"].(string); reason != "" {
+				d.Status += " (" + reason + ")"
+			}
+			if t, err := time.Parse(time.RFC3339, fmt.Sprint(cond["lastTransitionTime"])); err == nil {
+				d.LastChange = t
+			}
+		}
+		if attempted != "" && attempted != d.Revision {
+			d.Status += fmt.Sprintf(", revision `%s` not applied yet", attempted)
+		}
+		d.Revision = shortRevision(d.Revision)
+		kind, _, _ := unstructured.NestedString(u.Object, "spec", "sourceRef", "kind")
+		source, _, _ := unstructured.NestedString(u.Object, "spec", "sourceRef", "name")
+		if kind == "" {
+			kind, _, _ = unstructured.NestedString(u.Object, "spec", "chart", "spec", "sourceRef", "kind")
+			source, _, _ = unstructured.NestedString(u.Object, "spec", "chart", "spec", "sourceRef", "name")
+		}
+		if source != "" {
+			d.Source = kind + " " + source
+		}
+		return d
+	}
+	return nil
+}
+
+// shortRevision shortens Git SHAs, also in Flux's "main@sha1:<sha>" form.
+func shortRevision(revision string) string {
+	prefix, sha := "", revision
+	if i := strings.LastIndex(revision, ":"); i >= 0 {
+		prefix, sha = revision[:i+1], revision[i+1:]
+	}
+	if len(sha) == 40 || len(sha) == 64 {
+		sha = sha[:12]
+	}
+	return prefix + sha
+}
+
+// actOnDeliveries records the incident as an Event on each GitOps object,
+// and pauses an Argo Rollout whose new revision started crash looping
+// during a progressive rollout, reporting it in the alert's thread.
+func actOnDeliveries(ctx context.Context, clientset kubernetes.Interface, dyn dynamic.Interface, config *Config, deliveries []*delivery, inc *Incident, crashLooping bool) {
+	for _, d := range deliveries {
+		if config.Delivery.RecordEvents && d.Tool != DELIVERY_ROLLOUTS {
+			recordDeliveryEvent(ctx, clientset, d, inc)
+		}
+		if config.Delivery.PauseRollouts && d.Tool == DELIVERY_ROLLOUTS && crashLooping && d.Canary && d.Progressing && !d.Paused {
+			pauseRollout(ctx, dyn, d, inc)
+		}
+	}
+}
+
+func recordDeliveryEvent(ctx context.Context, clientset kubernetes.Interface, d *delivery, inc *Incident) {
+	if *readOnly || !allowed(d.Namespace, "create", "events") {
+		return
+	}
+	message := fmt.Sprintf("%s %s/%s: %s", incidentTitle(inc.Type), inc.Namespace, inc.Pod, inc.Reason)
+	if summary := summarizeAnalysis(inc.Analysis); summary != "" {
+		message += ". " + summary
+	}
+	message = truncate(message, 500)
+	if *dryRun {
+		log.Printf("🧪 [dry-run] would emit event on %s %s/%s: %s", d.Kind, d.Namespace, d.Name, message)
+		return
+	}
+
+	now := v1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			GenerateName: d.Name + ".",
+			Namespace:    d.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       d.Kind,
+			APIVersion: d.Resource.GroupVersion().String(),
+			Name:       d.Name,
+			Namespace:  d.Namespace,
+			UID:        d.UID,
+		},
+		Reason:              DELIVERY_EVENT_REASON,
+		Message:             message,
+		Type:                corev1.EventTypeWarning,
+		Source:              corev1.EventSource{Component: "pod-analyzer"},
+		ReportingController: "pod-analyzer.io/analyzer",
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	if _, err := clientset.CoreV1().Events(d.Namespace).Create(ctx, event, v1.CreateOptions{}); err != nil {
+		log.Printf("❌ Failed to emit event on %s %s/%s: %v", d.Kind, d.Namespace, d.Name, err)
+	}
+}
+
+func pauseRollout(ctx context.Context, dyn dynamic.Interface, d *delivery, inc *Incident) {
+	if *readOnly || !allowed(d.Namespace, "patch", "rollouts.argoproj.io") {
+		return
+	}
+	if *dryRun {
+		log.Printf("🧪 [dry-run] would pause Rollout %s/%s", d.Namespace, d.Name)
+		return
+	}
+	patch := []byte(`{"spec":{"paused":true}}`)
+	if _, err := dyn.Resource(argoRollouts).Namespace(d.Namespace).Patch(ctx, d.Name, types.MergePatchType, patch, v1.PatchOptions{}); err != nil {
+		log.Printf("❌ Failed to pause Rollout %s/%s: %v", d.Namespace, d.Name, err)
+		return
+	}
+	d.Paused = true
+	log.Printf("⏸️ Paused Rollout %s/%s: its new revision is crash looping (%s)", d.Namespace, d.Name, inc.Pod)
+	if inc.ThreadTS != "" {
+		sendSlackThread(inc.Channel, inc.ThreadTS, fmt.Sprintf("⏸️ *Paused Rollout* `%s/%s`: the new revision is crash looping. Resume with `kubectl argo rollouts promote %s -n %s`, or roll back with `kubectl argo rollouts abort %s -n %s`.",
+			d.Namespace, d.Name, d.Name, d.Namespace, d.Name, d.Namespace))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const DIGEST_TOP_N = 5
+
+type DigestConfig struct {
+	Schedule string      `json:"schedule"`
+	Channel  string      `json:"channel"`
+	Period   v1.Duration `json:"period"`
+}
+
+// runDigests posts each configured digest whenever its cron schedule fires.
+// Schedules are re-read from the config every minute, so digests can be
+// added or changed through a config reload.
+func runDigests() {
+	next := map[string]time.Time{}
+	for {
+		now := time.Now()
+		active := map[string]bool{}
+		for _, d := range cfg().Digests {
+			key := d.Schedule + "|" + d.Channel
+			active[key] = true
+
+			due, scheduled := next[key]
+			if scheduled && now.Before(due) {
+				continue
+			}
+			schedule, err := cron.ParseStandard(d.Schedule)
+			if err != nil {
+				log.Printf("❌ Invalid digest schedule %q: %v", d.Schedule, err)
+				next[key] = now.Add(time.Hour)
+				continue
+			}
+			if scheduled {
+				postDigest(d, now)
+			}
+			next[key] = schedule.Next(now)
+		}
+		for key := range next {
+			if !active[key] {
+				delete(next, key)
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func postDigest(d DigestConfig, now time.Time) {
+	period := d.Period.Duration
+	if period == 0 {
+		period = 24 * time.Hour
+	}
+	config := cfg()
+	channel := d.Channel
+	if channel == "" {
+		channel = config.SlackChannel
+	}
+	list := incidentsSince(now.Add(-period))
+	usage := usageSince(now.Add(-period))
+	// A digest to a tenant's workspace only covers that tenant's incidents.
+	if i := strings.Index(channel, "/"); i >= 0 {
+		var own []*Incident
+		for _, inc := range list {
+			if strings.HasPrefix(inc.Channel, channel[:i+1]) {
+				own = append(own, inc)
+			}
+		}
+		list = own
+		var ownUsage []modelUsage
+		for _, u := range usage {
+			if u.Namespace != "" && tenantFor(config, u.Namespace) == channel[:i] {
+				ownUsage = append(ownUsage, u)
+			}
+		}
+		usage = ownUsage
+	}
+	postToSlack(map[string]interface{}{
+		"channel": channel,
+		"text":    buildDigest(list, period) + feedbackDigest(list) + usageDigest(config, usage),
+	})
+}
+
+func buildDigest(list []*Incident, period time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*📊 Pod incident digest — last %s*\n", humanPeriod(period))
+	if len(list) == 0 {
+		b.WriteString("No incidents. 🎉")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Total incidents: *%d*\n", len(list))
+
+	workloads := map[string]int{}
+	namespaces := map[string]int{}
+	causes := map[string]int{}
+	for _, i := range list {
+		workloads[i.Namespace+"/"+i.Workload]++
+		namespaces[i.Namespace]++
+		causes[i.cause()]++
+	}
+
+	b.WriteString("\n*Top restarting workloads:*\n")
+	for _, kv := range topCounts(workloads, DIGEST_TOP_N) {
+		fmt.Fprintf(&b, "• `%s` — %d\n", kv.key, kv.count)
+	}
+	b.WriteString("\n*By namespace:*\n")
+	for _, kv := range topCounts(namespaces, 0) {
+		fmt.Fprintf(&b, "• `%s` — %d\n", kv.key, kv.count)
+	}
+	b.WriteString("\n*Most common causes:*\n")
+	for _, kv := range topCounts(causes, DIGEST_TOP_N) {
+		fmt.Fprintf(&b, "• %s — %d\n", kv.key, kv.count)
+	}
+	return b.String()
+}
+
+type keyCount struct {
+	key   string
+	count int
+}
+
+func topCounts(counts map[string]int, limit int) []keyCount {
+	var sorted []keyCount
+	for k, c := range counts {
+		sorted = append(sorted, keyCount{k, c})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+func humanPeriod(d time.Duration) string {
+	switch {
+	case d == 7*24*time.Hour:
+		return "week"
+	case d == 24*time.Hour:
+		return "24 hours"
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return d.String()
+}
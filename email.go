@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+const SMTP_PORT = 587
+
+type EmailConfig struct {
+	SMTPHost    string              `json:"smtpHost"`
+	SMTPPort    int                 `json:"smtpPort"`
+	Username    string              `json:"username"`
+	From        string              `json:"from"`
+	To          []string            `json:"to"`
+	NamespaceTo map[string][]string `json:"namespaceTo"`
+}
+
+// EmailNotifier sends each incident as an HTML mail laid out like the Slack
+// thread. The SMTP password is read from SMTP_PASSWORD.
+type EmailNotifier struct {
+	config EmailConfig
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+// recipients prefers the namespace's own list over the global one.
+func (n *EmailNotifier) recipients(namespace string) []string {
+	if to, ok := n.config.NamespaceTo[namespace]; ok {
+		return to
+	}
+	return n.config.To
+}
+
+func (n *EmailNotifier) Notify(inc *Incident) error {
+	to := n.recipients(inc.Namespace)
+	if len(to) == 0 {
+		return nil
+	}
+
+	subject := fmt.Sprintf("[pod-analyzer] %s: %s/%s", incidentTitle(inc.Type), inc.Namespace, inc.Pod)
+	if inc.Reason != "" {
+		subject += " (" + inc.Reason + ")"
+	}
+	html := localized(formatterFor(FORMAT_HTML), inc.Language).Document(viewOf(inc))
+
+	from := n.config.From
+	if from == "" {
+		from = n.config.Username
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.WriteString(html)
+
+	if *dryRun {
+		fmt.Printf("----- [dry-run] email to %s: %s\n", strings.Join(to, ", "), subject)
+		return nil
+	}
+
+	port := n.config.SMTPPort
+	if port == 0 {
+		port = SMTP_PORT
+	}
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, os.Getenv("SMTP_PASSWORD"), n.config.SMTPHost)
+	}
+	// SendMail upgrades to STARTTLS whenever the server offers it.
+	body := outbound("email", strings.Join(to, ", "), msg.Bytes())
+	return smtp.SendMail(fmt.Sprintf("%s:%d", n.config.SMTPHost, port), auth, from, to, body)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podEvents returns the events recorded for a pod since the given time,
+// oldest first.
+func podEvents(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, since time.Time) ([]corev1.Event, error) {
+	if !allowed(namespace, "list", "events") {
+		return nil, nil
+	}
+	ctx, cancel := within(ctx, cfg().Timeouts.Events)
+	defer cancel()
+	return collector.PodEvents(ctx, clientset, namespace, podName, since)
+}
+
+// emitDiagnosisEvent attaches a one-line summary of the analysis to the pod
+// as a Kubernetes Event, so it shows up in `kubectl describe pod`.
+func emitDiagnosisEvent(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, inc *Incident) {
+	summary := summarizeAnalysis(inc.Analysis)
+	if summary == "" || *readOnly || !allowed(pod.Namespace, "create", "events") {
+		return
+	}
+	if *dryRun {
+		log.Printf("🧪 [dry-run] would emit event on %s [%s]: %s", pod.Name, pod.Namespace, summary)
+		return
+	}
+
+	now := v1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			GenerateName: pod.Name + ".",
+			Namespace:    pod.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Pod",
+			APIVersion:      "v1",
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+			FieldPath:       fmt.Sprintf("spec.containers{%s}", inc.Container),
+		},
+		Reason:              collector.DIAGNOSIS_EVENT_REASON,
+		Message:             summary,
+		Type:                corev1.EventTypeWarning,
+		Source:              corev1.EventSource{Component: "pod-analyzer"},
+		ReportingController: "pod-analyzer.io/analyzer",
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	if _, err := clientset.CoreV1().Events(pod.Namespace).Create(ctx, event, v1.CreateOptions{}); err != nil {
+		log.Printf("❌ Failed to emit diagnosis event for %s: %v", pod.Name, err)
+	}
+}
+
+// summarizeAnalysis returns the first line of prose from the model output,
+// without markdown decoration, capped to fit an event message.
+func summarizeAnalysis(analysis string) string {
+	for _, line := range strings.Split(analysis, "\n") {
+		line = strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "#*>-_`"))
+		if len(line) < 10 || strings.HasSuffix(line, ":") {
+			continue
+		}
+		return truncate(line, 500)
+	}
+	return ""
+}
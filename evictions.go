@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	"github.com/ghulevishal/pod-analyzer/internal/detector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const EVICTION_PROMPT = `Pods were evicted by the kubelet on Kubernetes node %s. Evictions mean the node ran out of a resource, so analyze the node's capacity problem rather than the individual applications: which resource is under pressure, which workloads are driving it (compare their requests and limits), and what to change (requests/limits, eviction thresholds, node size, or scheduling).
+
+Node conditions:
+%s
+
+Node capacity:
+%s
+
+Evicted pods:
+%s
+
+Node events:
+%s`
+
+// analyzeEvictions analyzes the pods newly evicted from one node as one
+// capacity incident of the node, with a single model call. Only the routing
+// follows the namespaces: each channel gets the alert for the evicted pods
+// of the namespaces it covers, and each pod's incident goes to its
+// namespace's notifiers.
+func analyzeEvictions(clientset kubernetes.Interface, dyn dynamic.Interface, nodeName string, pods []corev1.Pod) {
+	config := cfg().forIncident(INCIDENT_EVICTION)
+	ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+	defer cancel()
+	ctx = withUsage(ctx, "")
+
+	// Pods evicted during a maintenance window are only recorded.
+	var alerted []corev1.Pod
+	for i := range pods {
+		nsConfig := cfg().forNamespace(pods[i].Namespace).forIncident(INCIDENT_EVICTION)
+		if inc := evictionIncident(&pods[i]); silence(nsConfig, inc) {
+			recordIncident(inc)
+			publishIncident(ctx, dyn, inc)
+		} else {
+			alerted = append(alerted, pods[i])
+		}
+	}
+	if len(alerted) == 0 {
+		return
+	}
+	pods = alerted
+
+	conditions, capacity := "unknown", "unknown"
+	if !allowed("", "get", "nodes") {
+		conditions, capacity = "unknown (the service account may not get nodes)", "unknown"
+	} else if node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, v1.GetOptions{}); err != nil {
+		log.Printf("⚠️ Failed to get node %s: %v", nodeName, err)
+	} else {
+		conditions = formatNodeConditions(node)
+		capacity = fmt.Sprintf("allocatable cpu %s, memory %s, ephemeral-storage %s, pods %s",
+			node.Status.Allocatable.Cpu(), node.Status.Allocatable.Memory(),
+			node.Status.Allocatable.StorageEphemeral(), node.Status.Allocatable.Pods())
+	}
+
+	events := nodeEvents(ctx, clientset, nodeName, time.Now().Add(-config.EventLookback.Duration))
+
+	prompt := fmt.Sprintf(EVICTION_PROMPT, nodeName, conditions, capacity, formatEvicted(pods), collector.FormatEvents(events)) + languageInstruction(config.Language)
+	analysis, err := callModel(ctx, config, prompt)
+	if err != nil {
+		log.Printf("❌ Failed to analyze evictions on %s: %v", nodeName, err)
+		return
+	}
+
+	byChannel := map[string][]corev1.Pod{}
+	var channels []string
+	for _, p := range pods {
+		nsConfig := cfg().forNamespace(p.Namespace).forIncident(INCIDENT_EVICTION)
+		channel := nsConfig.channelFor(ruleFor(p.Namespace).slackChannel(nsConfig))
+		if _, ok := byChannel[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		byChannel[channel] = append(byChannel[channel], p)
+	}
+
+	for _, channel := range channels {
+		evicted := byChannel[channel]
+		var namespaces []string
+		for _, p := range evicted {
+			if !containsString(namespaces, p.Namespace) {
+				namespaces = append(namespaces, p.Namespace)
+			}
+		}
+		threadTS := postToSlack(map[string]interface{}{
+			"channel": channel,
+			"text": "*🧹 Pod Evictions Detected!*\n" +
+				fmt.Sprintf("> *Node:* `%s`\n", nodeName) +
+				fmt.Sprintf("> *Evicted pods:* %d of %d\n", len(evicted), len(pods)) +
+				fmt.Sprintf("> *Namespace:* `%s`", strings.Join(namespaces, "`, `")),
+		})
+		if threadTS != "" {
+			slack := localized(formatterFor(FORMAT_MRKDWN), config.Language)
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🖥️", Title: "Node conditions", Body: conditions + "\n" + capacity}))
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🧹", Title: "Evicted pods", Body: formatEvicted(evicted)}))
+			if len(events) > 0 {
+				sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "📋", Title: "Node events", Body: collector.FormatEvents(events)}))
+			}
+			sendSlackThread(channel, threadTS, slack.Section(analysisSection(analysis)))
+		}
+
+		for i := range evicted {
+			inc := evictionIncident(&evicted[i])
+			inc.Events, inc.Resources = events, conditions
+			inc.Analysis, inc.Language = analysis, config.Language
+			inc.Channel, inc.ThreadTS = channel, threadTS
+			recordIncident(inc)
+			publishIncident(ctx, dyn, inc)
+			notify(cfg().forNamespace(inc.Namespace).forIncident(INCIDENT_EVICTION), inc)
+		}
+	}
+}
+
+func formatEvicted(pods []corev1.Pod) string {
+	var lines []string
+	for _, p := range pods {
+		lines = append(lines, fmt.Sprintf("%s/%s: %s", p.Namespace, p.Name, p.Status.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func evictionIncident(p *corev1.Pod) *Incident {
+	return &Incident{
+		ID:        fmt.Sprintf("%s-%s-evicted", p.Namespace, p.Name),
+		Type:      INCIDENT_EVICTION,
+		Severity:  severityOf(INCIDENT_EVICTION),
+		Namespace: p.Namespace,
+		Pod:       p.Name,
+		Workload:  workloadName(p),
+		Reason:    "Evicted",
+		Signature: signatureOf(p.Namespace, workloadName(p), "Evicted"),
+		Time:      detector.EvictionTime(p),
+	}
+}
+
+func formatNodeConditions(node *corev1.Node) string {
+	var lines []string
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			lines = append(lines, fmt.Sprintf("Ready=%s", c.Status))
+			continue
+		}
+		line := fmt.Sprintf("%s=%s", c.Type, c.Status)
+		if c.Status == corev1.ConditionTrue {
+			line += fmt.Sprintf(" since %s: %s", c.LastTransitionTime.Format("15:04:05"), c.Message)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
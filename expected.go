@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	CAUSE_DRAIN         = "drain"
+	CAUSE_ROLLOUT       = "rollout"
+	CAUSE_PREEMPTION    = "preemption"
+	CAUSE_NODE_SHUTDOWN = "node-shutdown"
+
+	CATEGORY_EXPECTED = "expected"
+
+	// How long after the restart a node's shutdown or reboot event may be
+	// recorded and still explain it; the kubelet reports a reboot once it is
+	// back.
+	NODE_EVENT_GRACE = 5 * time.Minute
+)
+
+var (
+	probeKill      = regexp.MustCompile(`(?i)failed (liveness|startup) probe`)
+	evictedReasons = []string{"Evicted", "TaintManagerEviction"}
+)
+
+// SuppressRule drops the alerts for restarts that routine cluster operations
+// explain: node drains, rollouts scaling down the old pods, preemption and
+// node shutdowns. With record, they are kept as info-level incidents in the
+// incident list and API, without notifying anyone.
+type SuppressRule struct {
+	Name       string   `json:"name"`
+	Causes     []string `json:"causes"`
+	Namespaces []string `json:"namespaces"`
+	Record     bool     `json:"record"`
+}
+
+// matches reports whether the rule covers the cause in the namespace; empty
+// lists cover everything.
+func (r SuppressRule) matches(namespace, cause string) bool {
+	if len(r.Causes) > 0 && !containsString(r.Causes, cause) {
+		return false
+	}
+	return len(r.Namespaces) == 0 || containsString(r.Namespaces, namespace)
+}
+
+// suppressExpected looks for a routine cause of the restart and returns the
+// first suppress rule that covers it, or nil if the incident is to be
+// alerted on. A suppressed incident gets the cause as its analysis.
+func suppressExpected(ctx context.Context, clientset kubernetes.Interface, config *Config, pod *corev1.Pod, inc *Incident) *SuppressRule {
+	if len(config.Suppress) == 0 {
+		return nil
+	}
+	cause, detail := expectedRestart(ctx, clientset, pod, inc.Events, inc.Time, config.EventLookback.Duration)
+	if cause == "" {
+		return nil
+	}
+	for i, r := range config.Suppress {
+		if !r.matches(inc.Namespace, cause) {
+			continue
+		}
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		log.Printf("🔕 Expected restart of %s [%s] (%s), suppressed by rule %s: %s", inc.Pod, inc.Namespace, cause, name, detail)
+		inc.Category, inc.Severity = CATEGORY_EXPECTED, SEVERITY_INFO
+		inc.Analysis = fmt.Sprintf("Expected restart (%s): %s. Not alerted, suppressed by rule %s.", cause, detail, name)
+		return &config.Suppress[i]
+	}
+	return nil
+}
+
+// expectedRestart returns the routine cause of a restart and what shows it,
+// or "" if there is none: a Preempted event, the node shutting down or
+// rebooting, or the kubelet stopping the container (not for a failed probe)
+// because the node is drained or the pod's ReplicaSet is scaled down.
+func expectedRestart(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, events []corev1.Event, restartTime time.Time, lookback time.Duration) (string, string) {
+	for _, e := range events {
+		if e.Reason == "Preempted" || e.Reason == "Preempting" {
+			return CAUSE_PREEMPTION, e.Message
+		}
+	}
+
+	if pod.Status.Reason == "Shutdown" || pod.Status.Reason == "Terminated" || strings.Contains(pod.Status.Message, "node shutdown") {
+		return CAUSE_NODE_SHUTDOWN, pod.Status.Message
+	}
+	if pod.Spec.NodeName != "" && allowed("", "list", "events") {
+		for _, e := range nodeEvents(ctx, clientset, pod.Spec.NodeName, restartTime.Add(-lookback)) {
+			if (e.Reason == "Rebooted" || e.Reason == "Shutdown" || e.Reason == "NodeShutdown") && !collector.EventTime(e).After(restartTime.Add(NODE_EVENT_GRACE)) {
+				return CAUSE_NODE_SHUTDOWN, fmt.Sprintf("node `%s` %s: %s", pod.Spec.NodeName, e.Reason, e.Message)
+			}
+		}
+	}
+
+	var killing *corev1.Event
+	for i, e := range events {
+		if e.Reason == "Killing" && !probeKill.MatchString(e.Message) {
+			killing = &events[i]
+		}
+	}
+	if killing == nil {
+		return "", ""
+	}
+	if strings.Contains(killing.Message, "definition changed") {
+		return CAUSE_ROLLOUT, killing.Message
+	}
+	for _, e := range events {
+		if containsString(evictedReasons, e.Reason) {
+			return CAUSE_DRAIN, e.Message
+		}
+	}
+	if pod.Spec.NodeName != "" && allowed("", "get", "nodes") {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, v1.GetOptions{})
+		if err == nil && node.Spec.Unschedulable {
+			return CAUSE_DRAIN, fmt.Sprintf("node `%s` is cordoned and the kubelet stopped the container (%s)", node.Name, killing.Message)
+		}
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind != "ReplicaSet" || ref.Controller == nil || !*ref.Controller || !allowed(pod.Namespace, "get", "replicasets.apps") {
+			continue
+		}
+		rs, err := clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, v1.GetOptions{})
+		if err == nil && derefInt32(rs.Spec.Replicas, 1) < rs.Status.Replicas {
+			return CAUSE_ROLLOUT, fmt.Sprintf("replicaset `%s` is scaling down from %d to %d replicas", rs.Name, rs.Status.Replicas, derefInt32(rs.Spec.Replicas, 1))
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+)
+
+var fakeModel = flag.Bool("fake-model", false, "answer every prompt with a canned analysis instead of calling the model, to run the pipeline without Ollama or OpenAI")
+
+// cannedModel is a ModelClient that never leaves the process. Together with
+// --dry-run it runs detection, collection and formatting against a cluster
+// with no model endpoint or Slack workspace at hand.
+type cannedModel struct{}
+
+func (cannedModel) Complete(ctx context.Context, config *Config, prompt string) (string, error) {
+	return fmt.Sprintf("Canned analysis (--fake-model): the prompt had %d lines and about %d tokens; no model was called.",
+		strings.Count(prompt, "\n")+1, estimateTokens(config.model(), prompt)), nil
+}
+
+func (m cannedModel) CompleteStructured(ctx context.Context, config *Config, prompt string) (string, error) {
+	text, _ := m.Complete(ctx, config, prompt)
+	raw, err := json.Marshal(analyzer.StructuredAnalysis{
+		RootCause:         "unknown (--fake-model)",
+		Category:          "unknown",
+		Explanation:       text,
+		SuggestedCommands: []string{},
+		NeedsHuman:        true,
+	})
+	return string(raw), err
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+	"github.com/ghulevishal/pod-analyzer/internal/detector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	RETRY_INTERVAL = 2 * time.Minute
+	RETRY_MAX_AGE  = 6 * time.Hour
+	RETRY_BATCH    = 5
+)
+
+var exitCodeCauses = map[int32]string{
+	1:   "the application exited with a generic error; the logs usually name it",
+	2:   "the shell or application rejected its arguments (misuse of a builtin or bad flags)",
+	126: "the entrypoint is not executable (permissions or wrong architecture)",
+	127: "the entrypoint or a command it runs was not found in the image",
+	134: "the process aborted (SIGABRT), often a failed assertion or a runtime panic",
+	137: "the container was killed (SIGKILL), usually by the OOM killer or after the grace period",
+	139: "the process crashed with a segmentation fault (SIGSEGV)",
+	143: "the container was terminated (SIGTERM), e.g. by a failed liveness probe or a rollout",
+}
+
+// pendingAnalysis is an incident that was alerted without the model's
+// analysis and is retried until the model answers.
+type pendingAnalysis struct {
+	Incident *Incident
+	Template *template.Template
+	Data     PromptData
+	Queued   time.Time
+}
+
+var (
+	retryMu    sync.Mutex
+	retryQueue []*pendingAnalysis
+)
+
+// fallbackAnalysis explains what is known without the model: the heuristic
+// diagnosis if one matches, otherwise what the exit code usually means.
+func fallbackAnalysis(pod *corev1.Pod, cs corev1.ContainerStatus, incidentType string, events []corev1.Event, errorLines string, err error) string {
+	cause := "no heuristic matched; check the events and logs below"
+	if class := classify(pod, cs, incidentType, events, errorLines); class != nil {
+		cause = class.String()
+	} else if t := detector.LastTermination(cs); t != nil {
+		if c, ok := exitCodeCauses[t.ExitCode]; ok {
+			cause = fmt.Sprintf("exit code %d: %s", t.ExitCode, c)
+		} else {
+			cause = fmt.Sprintf("exit code %d (%s)", t.ExitCode, t.Reason)
+		}
+	} else if w := cs.State.Waiting; w != nil {
+		cause = fmt.Sprintf("`%s`: %s", w.Reason, w.Message)
+	}
+	if errors.Is(err, errBudgetSpent) {
+		return fmt.Sprintf("⚠️ *AI analysis unavailable* (%v). It will be added to this thread after the budget resets at midnight.\n*Probable cause (heuristics):* %s", err, cause)
+	}
+	return fmt.Sprintf("⚠️ *AI analysis unavailable* (%v). It will be added to this thread once the model is reachable again.\n*Probable cause (heuristics):* %s", err, cause)
+}
+
+func queueAnalysis(inc *Incident, tmpl *template.Template, data PromptData) {
+	retryMu.Lock()
+	retryQueue = append(retryQueue, &pendingAnalysis{Incident: inc, Template: tmpl, Data: data, Queued: time.Now()})
+	retryMu.Unlock()
+}
+
+// retryAnalyses backfills the analysis of incidents alerted while the model
+// was down. A round stops at the first failure, since the model is most
+// likely still unreachable. Incidents refused by the daily token budget wait
+// without calling the model until it resets, and each round backfills at
+// most RETRY_BATCH, so the queue does not drain in one burst at midnight.
+func retryAnalyses(clientset kubernetes.Interface, dyn dynamic.Interface) {
+	for {
+		time.Sleep(RETRY_INTERVAL)
+
+		retryMu.Lock()
+		queue := retryQueue
+		retryQueue = nil
+		retryMu.Unlock()
+
+		var kept []*pendingAnalysis
+		sent := 0
+		for i, p := range queue {
+			inc := p.Incident
+			if time.Since(p.Queued) > RETRY_MAX_AGE {
+				log.Printf("⌛ Giving up on the analysis of %s [%s] after %s", inc.Pod, inc.Namespace, RETRY_MAX_AGE)
+				continue
+			}
+
+			config := cfg().forNamespace(inc.Namespace).forIncident(p.Data.Type)
+			if sent >= RETRY_BATCH || overTokenBudget(config) {
+				kept = append(kept, p)
+				continue
+			}
+			sent++
+			data := p.Data
+			ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+			ctx = withUsage(ctx, inc.Namespace)
+			fitPromptData(ctx, config, p.Template, &data)
+			analysis, structured, err := analyzeWithModel(ctx, config, renderPrompt(p.Template, data))
+			promptTokens, responseTokens := usageOf(ctx)
+			cancel()
+			if errors.Is(err, errBudgetSpent) {
+				kept = append(kept, p)
+				continue
+			}
+			if err != nil {
+				log.Printf("⚠️ Model still unavailable, %d analyses queued: %v", len(kept)+len(queue)-i, err)
+				kept = append(kept, queue[i:]...)
+				break
+			}
+
+			log.Printf("🔁 Backfilled the analysis of %s [%s]", inc.Pod, inc.Namespace)
+			if inc.ThreadTS != "" {
+				sendSlackThread(inc.Channel, inc.ThreadTS, "🔁 The model is reachable again, here is the analysis.")
+				postAnalysis(clientset, inc.Channel, inc, analysis)
+			}
+			recordAnalysis(dyn, config, inc, analysis, structured, promptTokens, responseTokens)
+		}
+
+		retryMu.Lock()
+		retryQueue = append(kept, retryQueue...)
+		retryMu.Unlock()
+	}
+}
+
+// recordAnalysis stores an analysis that arrived after the alert on the
+// incident, its PodIncident and the notifiers that keep a copy of it, so
+// none of them is left with the fallback or quick diagnosis.
+func recordAnalysis(dyn dynamic.Interface, config *Config, inc *Incident, analysis string, structured *analyzer.StructuredAnalysis, promptTokens, responseTokens int) {
+	incidentsMu.Lock()
+	inc.Analysis = analysis
+	inc.PromptVersion = ruleFor(inc.Namespace).promptVersion(config)
+	inc.PromptTokens += promptTokens
+	inc.ResponseTokens += responseTokens
+	if structured != nil {
+		inc.Category, inc.RootCause = structured.Category, structured.RootCause
+		inc.Confidence, inc.NeedsHuman = structured.Confidence, structured.NeedsHuman
+	}
+	incidentsMu.Unlock()
+
+	if !isRecorded(inc) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	updateIncidentAnalysis(ctx, dyn, inc)
+	notifyUpdate(config, inc)
+}
+
+// postAnalysis posts the model's analysis into the incident thread, followed
+// by the kubectl commands it suggests after a dry-run check.
+func postAnalysis(clientset kubernetes.Interface, channel string, inc *Incident, analysis string) {
+	ts := postToSlack(map[string]interface{}{
+		"channel":   channel,
+		"text":      localized(formatterFor(FORMAT_MRKDWN), inc.Language).Section(analysisSection(analysis)),
+		"thread_ts": inc.ThreadTS,
+	})
+	incidentsMu.Lock()
+	inc.AnalysisTS = ts
+	incidentsMu.Unlock()
+	if commands := extractKubectlCommands(analysis); len(commands) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		sendSlackThread(channel, inc.ThreadTS, formatRemediation(validateCommands(ctx, clientset, inc.Namespace, commands)))
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	FEEDBACK_UP   = 1
+	FEEDBACK_DOWN = -1
+
+	// PROMPT_HEURISTICS is the prompt version of diagnoses made without the
+	// model.
+	PROMPT_HEURISTICS = "heuristics"
+)
+
+// feedbackReactions maps Slack reaction names to votes; skin tones are
+// stripped before the lookup.
+var feedbackReactions = map[string]int{
+	"+1":         FEEDBACK_UP,
+	"thumbsup":   FEEDBACK_UP,
+	"-1":         FEEDBACK_DOWN,
+	"thumbsdown": FEEDBACK_DOWN,
+}
+
+// feedbackTally counts the votes on the analyses made with one prompt
+// version.
+type feedbackTally struct {
+	Up   int
+	Down int
+}
+
+// accuracy is the share of helpful votes, or -1 without votes.
+func (t feedbackTally) accuracy() float64 {
+	if t.Up+t.Down == 0 {
+		return -1
+	}
+	return float64(t.Up) / float64(t.Up+t.Down)
+}
+
+// promptVersion identifies the prompt an analysis was made with, so feedback
+// can be compared before and after a prompt change: the rule that supplied
+// the template, or "global", and a short hash of its text.
+func (r *Rule) promptVersion(config *Config) string {
+	source, owner := config.PromptTemplate, "global"
+	if r != nil && r.prompt != nil {
+		source, owner = r.PromptTemplate, "rule-"+r.Name
+	}
+	sum := sha256.Sum256([]byte(source))
+	return owner + "-" + hex.EncodeToString(sum[:4])
+}
+
+// handleReaction records a 👍 or 👎 on an alert or its analysis as feedback
+// on the incident. Removing the reaction withdraws the vote; each user has
+// one vote per incident.
+func handleReaction(dyn dynamic.Interface, channel, ts, user, reaction string, added bool) {
+	vote, ok := feedbackReactions[strings.SplitN(reaction, "::", 2)[0]]
+	if !ok {
+		return
+	}
+	incidentsMu.Lock()
+	inc := incidentForMessage(channel, ts)
+	if inc == nil || inc.PromptVersion == "" {
+		incidentsMu.Unlock()
+		return
+	}
+	if inc.Votes == nil {
+		inc.Votes = map[string]int{}
+	}
+	switch {
+	case added:
+		inc.Votes[user] = vote
+	case inc.Votes[user] == vote:
+		delete(inc.Votes, user)
+	}
+	tally := inc.tally()
+	incidentsMu.Unlock()
+
+	log.Printf("🗳️ Feedback on %s [%s] from %s: 👍 %d · 👎 %d (prompt %s)", inc.Pod, inc.Namespace, user, tally.Up, tally.Down, inc.PromptVersion)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	recordFeedback(ctx, dyn, inc, tally)
+}
+
+// incidentForMessage finds the incident an alert or analysis message belongs
+// to, preferring the analysis message itself since repeated restarts share
+// one thread. It must be called with incidentsMu held.
+func incidentForMessage(channel, ts string) *Incident {
+	var thread *Incident
+	for i := len(incidents) - 1; i >= 0; i-- {
+		inc := incidents[i]
+		if inc.Channel != channel {
+			continue
+		}
+		if inc.AnalysisTS == ts {
+			return inc
+		}
+		if inc.ThreadTS == ts && thread == nil {
+			thread = inc
+		}
+	}
+	return thread
+}
+
+// tally must be called with incidentsMu held.
+func (i *Incident) tally() feedbackTally {
+	var t feedbackTally
+	for _, vote := range i.Votes {
+		if vote > 0 {
+			t.Up++
+		} else {
+			t.Down++
+		}
+	}
+	return t
+}
+
+// feedbackByPrompt sums up the votes on the incidents per prompt version.
+func feedbackByPrompt(list []*Incident) map[string]feedbackTally {
+	incidentsMu.Lock()
+	defer incidentsMu.Unlock()
+	tallies := map[string]feedbackTally{}
+	for _, inc := range list {
+		t := inc.tally()
+		if inc.PromptVersion == "" || t.Up+t.Down == 0 {
+			continue
+		}
+		sum := tallies[inc.PromptVersion]
+		sum.Up += t.Up
+		sum.Down += t.Down
+		tallies[inc.PromptVersion] = sum
+	}
+	return tallies
+}
+
+// recordFeedback writes the votes into the incident's PodIncident, which
+// outlives the analyzer's in-memory incident list.
+func recordFeedback(ctx context.Context, dyn dynamic.Interface, inc *Incident, t feedbackTally) {
+	if !incidentCRDInstalled || *dryRun {
+		return
+	}
+	client := dyn.Resource(incidentResource).Namespace(inc.Namespace)
+	obj, err := client.Get(ctx, podIncidentName(inc), v1.GetOptions{})
+	if err != nil {
+		log.Printf("⚠️ Failed to get PodIncident %s/%s: %v", inc.Namespace, podIncidentName(inc), err)
+		return
+	}
+	status, _ := obj.Object["status"].(map[string]interface{})
+	if status == nil {
+		status = map[string]interface{}{}
+	}
+	status["feedback"] = map[string]interface{}{
+		"up":   int64(t.Up),
+		"down": int64(t.Down),
+	}
+	obj.Object["status"] = status
+	if _, err := client.UpdateStatus(ctx, obj, v1.UpdateOptions{}); err != nil {
+		log.Printf("❌ Failed to write status of PodIncident %s/%s: %v", inc.Namespace, obj.GetName(), err)
+	}
+}
+
+// feedbackDigest is the digest's paragraph on analysis quality: the votes
+// per prompt version, so a prompt change can be judged by its results.
+func feedbackDigest(list []*Incident) string {
+	tallies := feedbackByPrompt(list)
+	if len(tallies) == 0 {
+		return ""
+	}
+	versions := make([]string, 0, len(tallies))
+	total := feedbackTally{}
+	for v, t := range tallies {
+		versions = append(versions, v)
+		total.Up += t.Up
+		total.Down += t.Down
+	}
+	sort.Strings(versions)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n*Analysis feedback:* 👍 %d · 👎 %d (%.0f%% helpful)\n", total.Up, total.Down, total.accuracy()*100)
+	for _, v := range versions {
+		t := tallies[v]
+		fmt.Fprintf(&b, "• `%s` — 👍 %d · 👎 %d (%.0f%%)\n", v, t.Up, t.Down, t.accuracy()*100)
+	}
+	return b.String()
+}
+
+// writeFeedbackMetrics adds the votes and accuracy per prompt version over
+// the retained incidents to the metrics.
+func writeFeedbackMetrics(b *strings.Builder) {
+	tallies := feedbackByPrompt(incidentsSince(time.Time{}))
+	versions := make([]string, 0, len(tallies))
+	for v := range tallies {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	b.WriteString("# HELP pod_analyzer_feedback_votes Votes on analyses from Slack reactions, by prompt version.\n")
+	b.WriteString("# TYPE pod_analyzer_feedback_votes gauge\n")
+	for _, v := range versions {
+		fmt.Fprintf(b, "pod_analyzer_feedback_votes{prompt_version=%q,vote=\"up\"} %d\n", v, tallies[v].Up)
+		fmt.Fprintf(b, "pod_analyzer_feedback_votes{prompt_version=%q,vote=\"down\"} %d\n", v, tallies[v].Down)
+	}
+	b.WriteString("# HELP pod_analyzer_analysis_accuracy Share of helpful votes on analyses, by prompt version.\n")
+	b.WriteString("# TYPE pod_analyzer_analysis_accuracy gauge\n")
+	for _, v := range versions {
+		fmt.Fprintf(b, "pod_analyzer_analysis_accuracy{prompt_version=%q} %g\n", v, tallies[v].accuracy())
+	}
+}
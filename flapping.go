@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	FLAPPING_THRESHOLD = 5
+	FLAPPING_WINDOW    = 1 * time.Hour
+)
+
+type FlappingConfig struct {
+	Threshold    int         `json:"threshold"`
+	Window       v1.Duration `json:"window"`
+	SlackChannel string      `json:"slackChannel"`
+}
+
+type containerRestarts struct {
+	count    int32
+	lastSeen time.Time
+}
+
+var (
+	restartsMu sync.Mutex
+	// Restart timestamps per namespace/workload, pruned to the window.
+	restartHistory = map[string][]time.Time{}
+	// Last seen restart count per pod container, to turn counts into events.
+	restartCounts = map[string]*containerRestarts{}
+	// The flapping alert currently open per namespace/workload.
+	flappingAlerts = map[string]*Incident{}
+)
+
+// observeRestarts records the restarts a container went through since the
+// previous poll. Restarts that happened before the analyzer first saw the
+// container are not counted, so a restart of the analyzer doesn't report
+// every long-running crash loop as flapping.
+func observeRestarts(pod *corev1.Pod, cs corev1.ContainerStatus) {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	now := time.Now()
+	key := fmt.Sprintf("%s/%s", pod.UID, cs.Name)
+	seen, ok := restartCounts[key]
+	if !ok {
+		restartCounts[key] = &containerRestarts{count: cs.RestartCount, lastSeen: now}
+		return
+	}
+	seen.lastSeen = now
+	if cs.RestartCount <= seen.count {
+		seen.count = cs.RestartCount
+		return
+	}
+
+	at := now
+	if t := cs.LastTerminationState.Terminated; t != nil && !t.FinishedAt.IsZero() {
+		at = t.FinishedAt.Time
+	}
+	workload := pod.Namespace + "/" + workloadName(pod)
+	for i := seen.count; i < cs.RestartCount; i++ {
+		restartHistory[workload] = append(restartHistory[workload], at)
+	}
+	seen.count = cs.RestartCount
+
+	window := cfg().Flapping.Window.Duration
+	for k, c := range restartCounts {
+		if now.Sub(c.lastSeen) > window {
+			delete(restartCounts, k)
+		}
+	}
+}
+
+// workloadRestarts counts the workload's restarts within the flapping window.
+func workloadRestarts(namespace, workload string) int {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+	return pruneRestarts(namespace+"/"+workload, time.Now().Add(-cfg().Flapping.Window.Duration))
+}
+
+func pruneRestarts(key string, since time.Time) int {
+	history := restartHistory[key]
+	kept := history[:0]
+	for _, t := range history {
+		if t.After(since) {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		delete(restartHistory, key)
+		return 0
+	}
+	restartHistory[key] = kept
+	return len(kept)
+}
+
+// restartRates returns the restarts within the window for every workload
+// that restarted recently, keyed by namespace/workload.
+func restartRates() map[string]int {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	since := time.Now().Add(-cfg().Flapping.Window.Duration)
+	rates := map[string]int{}
+	for key := range restartHistory {
+		if n := pruneRestarts(key, since); n > 0 {
+			rates[key] = n
+		}
+	}
+	return rates
+}
+
+// openFlappingAlert returns the flapping alert still open for the workload,
+// forgetting it once the workload has calmed down below the threshold.
+func openFlappingAlert(config *Config, namespace, workload string, restarts int) *Incident {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	key := namespace + "/" + workload
+	if restarts <= config.Flapping.Threshold {
+		delete(flappingAlerts, key)
+		return nil
+	}
+	return flappingAlerts[key]
+}
+
+func setFlappingAlert(inc *Incident) {
+	restartsMu.Lock()
+	flappingAlerts[inc.Namespace+"/"+inc.Workload] = inc
+	restartsMu.Unlock()
+}
+
+func (c *Config) flappingChannel(rule *Rule) string {
+	if c.Flapping.SlackChannel != "" {
+		return c.Flapping.SlackChannel
+	}
+	return rule.slackChannel(c)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	FORMAT_MRKDWN   = "mrkdwn"
+	FORMAT_MARKDOWN = "markdown"
+	FORMAT_TEXT     = "text"
+	FORMAT_HTML     = "html"
+
+	SLACK_SECTION_LIMIT = 2000
+	SLACK_PROSE_LIMIT   = 3000
+	DOCUMENT_LOG_LIMIT  = 4000
+)
+
+var incidentTitles = map[string]string{
+	INCIDENT_RESTART:         "Pod Restart Detected",
+	INCIDENT_PROBE_FAILURE:   "Liveness/Readiness Probe Failed",
+	INCIDENT_START_FAILURE:   "Container Failed to Start",
+	INCIDENT_EVICTION:        "Pod Evicted",
+	INCIDENT_JOB_FAILURE:     "Job Failed",
+	INCIDENT_FLAPPING:        "Workload Flapping",
+	INCIDENT_NODE_NOT_READY:  "Node NotReady",
+	INCIDENT_KUBELET_RESTART: "Kubelet Restarted",
+	INCIDENT_ADMISSION:       "Pod Admission Denied",
+}
+
+var incidentEmojis = map[string]string{
+	INCIDENT_RESTART:         "🚨",
+	INCIDENT_PROBE_FAILURE:   "🩺",
+	INCIDENT_START_FAILURE:   "⛔",
+	INCIDENT_EVICTION:        "🧹",
+	INCIDENT_JOB_FAILURE:     "💥",
+	INCIDENT_FLAPPING:        "🔁",
+	INCIDENT_NODE_NOT_READY:  "🖥️",
+	INCIDENT_KUBELET_RESTART: "🖥️",
+	INCIDENT_ADMISSION:       "🛡️",
+}
+
+// incidentView is an incident laid out independently of any markup: its
+// title, the key facts and the sections of the Slack thread. Formatters turn
+// it into Slack mrkdwn, GitHub Markdown, plain text or HTML.
+type incidentView struct {
+	Emoji    string
+	Title    string
+	Fields   []viewField
+	Sections []viewSection
+}
+
+// viewField is one fact of the header. A field without a value is a note,
+// such as "needs human review".
+type viewField struct {
+	Emoji  string
+	Label  string
+	Value  string
+	Code   bool
+	Suffix string
+	URL    string
+}
+
+// viewSection is preformatted text, such as events and logs, or the model's
+// prose when Prose is set. Rows, if any, are the same content as a table
+// with a header row for formats that can show one. Tail keeps the end of
+// long text instead of the start.
+type viewSection struct {
+	Emoji string
+	Title string
+	Body  string
+	Rows  [][]string
+	Prose bool
+	Tail  bool
+}
+
+// Formatter renders incident views for one kind of destination.
+type Formatter interface {
+	Header(v *incidentView) string
+	Section(s viewSection) string
+	Document(v *incidentView) string
+}
+
+var formatters = map[string]Formatter{
+	FORMAT_MRKDWN:   mrkdwnFormatter{},
+	FORMAT_MARKDOWN: markdownFormatter{},
+	FORMAT_TEXT:     textFormatter{},
+	FORMAT_HTML:     htmlFormatter{},
+}
+
+// formatterFor returns the named formatter, or nil if there is none.
+func formatterFor(name string) Formatter {
+	return formatters[name]
+}
+
+func incidentTitle(incidentType string) string {
+	if title := incidentTitles[incidentType]; title != "" {
+		return title
+	}
+	return "Incident: " + incidentType
+}
+
+// viewOf lays out an incident with everything collected for it.
+func viewOf(inc *Incident) *incidentView {
+	v := &incidentView{Emoji: incidentEmojis[inc.Type], Title: incidentTitle(inc.Type)}
+	if v.Emoji == "" {
+		v.Emoji = "🚨"
+	}
+
+	subject, timeLabel := "Pod", "Restart Time"
+	switch inc.Type {
+	case INCIDENT_START_FAILURE, INCIDENT_EVICTION:
+		timeLabel = "Detected At"
+	case INCIDENT_FLAPPING:
+		timeLabel = "Last Restart"
+	case INCIDENT_JOB_FAILURE:
+		subject, timeLabel = "Job", "Failed At"
+	case INCIDENT_NODE_NOT_READY, INCIDENT_KUBELET_RESTART:
+		subject, timeLabel = "Node", "Detected At"
+	case INCIDENT_ADMISSION:
+		subject, timeLabel = "Controller", "Detected At"
+	}
+	v.Fields = append(v.Fields, viewField{Label: subject, Value: inc.Pod, Code: true})
+	if inc.Namespace != "" {
+		v.Fields = append(v.Fields, viewField{Label: "Namespace", Value: inc.Namespace, Code: true})
+	}
+	v.Fields = append(v.Fields, viewField{Label: timeLabel, Value: inc.Time.Format("2006-01-02 15:04:05"), Code: true})
+	if inc.Type == INCIDENT_FLAPPING {
+		v.Fields = append(v.Fields, viewField{Label: "Workload", Value: inc.Workload, Code: true,
+			Suffix: fmt.Sprintf(" restarted %d times in the last %s", inc.Restarts, cfg().Flapping.Window.Duration)})
+	} else if inc.Workload != "" && inc.Workload != inc.Pod && subject != "Node" {
+		v.Fields = append(v.Fields, viewField{Label: "Workload", Value: inc.Workload, Code: true})
+	}
+	if inc.Reason != "" {
+		f := viewField{Label: "Reason", Value: inc.Reason, Code: subject != "Node"}
+		if inc.ExitCode != 0 {
+			f.Suffix = fmt.Sprintf(" (exit code %d)", inc.ExitCode)
+		}
+		v.Fields = append(v.Fields, f)
+	}
+	if inc.Category != "" {
+		v.Fields = append(v.Fields, viewField{Label: "Diagnosis", Value: inc.Category, Code: true})
+	}
+	if inc.NeedsHuman {
+		v.Fields = append(v.Fields, viewField{Emoji: "🙋", Label: "Needs human review"})
+	}
+	if inc.Registry != "" {
+		v.Fields = append(v.Fields, viewField{Emoji: "📦", Label: "Registry", Value: inc.Registry})
+	}
+	for _, d := range inc.Delivery {
+		v.Fields = append(v.Fields, viewField{Emoji: "🚢", Label: "Delivery", Value: d})
+	}
+	for _, c := range inc.Changes {
+		v.Fields = append(v.Fields, viewField{Emoji: "⚠️", Label: "Recent change", Value: c})
+	}
+	for _, s := range inc.Scaling {
+		v.Fields = append(v.Fields, viewField{Emoji: "⚖️", Label: "Autoscaling", Value: s})
+	}
+	for _, r := range inc.Runbooks {
+		v.Fields = append(v.Fields, viewField{Emoji: "📘", Label: "Runbook", Value: r.name(), URL: r.URL})
+	}
+
+	v.Sections = append(v.Sections, eventsSection(inc.Events))
+	if inc.Resources != "" {
+		v.Sections = append(v.Sections, viewSection{Emoji: "📈", Title: "Resources", Body: inc.Resources})
+	}
+	if inc.Logs != "" {
+		v.Sections = append(v.Sections, logsSection(inc.Logs))
+	}
+	if inc.Analysis != "" {
+		v.Sections = append(v.Sections, analysisSection(inc.Analysis))
+	}
+	return v
+}
+
+func eventsSection(events []corev1.Event) viewSection {
+	s := viewSection{Emoji: "📋", Title: "Events", Body: collector.FormatEvents(events)}
+	if len(events) > 0 {
+		s.Rows = [][]string{{"Time", "Type", "Reason", "Message"}}
+		for _, e := range events {
+			reason := e.Reason
+			if e.Count > 1 {
+				reason += fmt.Sprintf(" (x%d)", e.Count)
+			}
+			s.Rows = append(s.Rows, []string{collector.EventTime(e).Format("15:04:05"), e.Type, reason, e.Message})
+		}
+	}
+	return s
+}
+
+func logsSection(logs string) viewSection {
+	return viewSection{Emoji: "📦", Title: "Logs", Body: logs, Tail: true}
+}
+
+func analysisSection(analysis string) viewSection {
+	return viewSection{Emoji: "🤖", Title: "Analysis", Body: analysis, Prose: true}
+}
+
+// limit shortens a section's text from the end or, for Tail sections, from
+// the start. Empty sections read "(none)" rather than an empty block.
+func (s viewSection) limit(n int) string {
+	if strings.TrimSpace(s.Body) == "" {
+		return "(none)"
+	}
+	if s.Tail {
+		return tail(s.Body, n)
+	}
+	return truncate(s.Body, n)
+}
+
+var (
+	markdownBold    = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	markdownHeading = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+	markdownFence   = regexp.MustCompile("(?m)^```[a-z]*\\s*$")
+	inlineCode      = regexp.MustCompile("`([^`\n]+)`")
+	slackBold       = regexp.MustCompile(`\*([^*\n]+)\*`)
+)
+
+// mrkdwnFormatter renders for Slack: quoted header fields, sections as code
+// blocks, and the model's Markdown with Slack's single-asterisk bold.
+type mrkdwnFormatter struct{}
+
+func (mrkdwnFormatter) Header(v *incidentView) string {
+	lines := []string{fmt.Sprintf("*%s %s!*", v.Emoji, v.Title)}
+	for _, f := range v.Fields {
+		line := "> "
+		if f.Emoji != "" {
+			line += f.Emoji + " "
+		}
+		if f.Value == "" {
+			lines = append(lines, line+"*"+f.Label+"*")
+			continue
+		}
+		value := f.Value
+		if f.Code {
+			value = "`" + value + "`"
+		}
+		if f.URL != "" {
+			value = "<" + f.URL + "|" + value + ">"
+		}
+		lines = append(lines, line+"*"+f.Label+":* "+value+f.Suffix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (mrkdwnFormatter) Section(s viewSection) string {
+	title := fmt.Sprintf("%s *%s:*\n", s.Emoji, s.Title)
+	if s.Prose {
+		text := markdownBold.ReplaceAllString(truncate(s.Body, SLACK_PROSE_LIMIT), "*$1*")
+		text = markdownHeading.ReplaceAllString(text, "*$1*")
+		return title + formatCodeBlocks(text)
+	}
+	return title + "```" + s.limit(SLACK_SECTION_LIMIT) + "```"
+}
+
+func (f mrkdwnFormatter) Document(v *incidentView) string {
+	parts := []string{f.Header(v)}
+	for _, s := range v.Sections {
+		parts = append(parts, f.Section(s))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// markdownFormatter renders GitHub-flavored Markdown, for issues.
+type markdownFormatter struct{}
+
+func (markdownFormatter) Header(v *incidentView) string {
+	lines := []string{fmt.Sprintf("## %s %s", v.Emoji, v.Title), ""}
+	for _, f := range v.Fields {
+		line := "- "
+		if f.Emoji != "" {
+			line += f.Emoji + " "
+		}
+		if f.Value == "" {
+			lines = append(lines, line+"**"+f.Label+"**")
+			continue
+		}
+		value := f.Value
+		if f.Code {
+			value = "`" + value + "`"
+		}
+		if f.URL != "" {
+			value = "[" + value + "](" + f.URL + ")"
+		}
+		lines = append(lines, line+"**"+f.Label+":** "+value+f.Suffix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (markdownFormatter) Section(s viewSection) string {
+	title := fmt.Sprintf("### %s %s\n\n", s.Emoji, s.Title)
+	if s.Prose {
+		return title + formatCodeBlocks(s.Body)
+	}
+	return title + "```\n" + s.limit(DOCUMENT_LOG_LIMIT) + "\n```"
+}
+
+func (f markdownFormatter) Document(v *incidentView) string {
+	parts := []string{f.Header(v)}
+	for _, s := range v.Sections {
+		parts = append(parts, f.Section(s))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// textFormatter renders plain text, for email-like destinations and paging
+// tools that show text as-is.
+type textFormatter struct{}
+
+func (textFormatter) Header(v *incidentView) string {
+	lines := []string{v.Title}
+	for _, f := range v.Fields {
+		if f.Value == "" {
+			lines = append(lines, f.Label)
+			continue
+		}
+		value := f.Value
+		if f.URL != "" {
+			value += " <" + f.URL + ">"
+		}
+		lines = append(lines, f.Label+": "+value+f.Suffix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (textFormatter) Section(s viewSection) string {
+	if s.Prose {
+		text := markdownBold.ReplaceAllString(s.Body, "$1")
+		text = markdownHeading.ReplaceAllString(text, "$1")
+		text = markdownFence.ReplaceAllString(text, "")
+		return s.Title + ":\n" + strings.TrimSpace(text)
+	}
+	return s.Title + ":\n" + s.limit(DOCUMENT_LOG_LIMIT)
+}
+
+func (f textFormatter) Document(v *incidentView) string {
+	parts := []string{f.Header(v)}
+	for _, s := range v.Sections {
+		parts = append(parts, f.Section(s))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// htmlFormatter renders a standalone HTML page, for email and the API.
+type htmlFormatter struct{}
+
+const (
+	HTML_BODY_STYLE = "font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; font-size: 14px; color: #1d1c1d;"
+	HTML_PRE_STYLE  = "background: #f8f8f8; padding: 8px; white-space: pre-wrap; font-size: 12px;"
+	HTML_CELL_STYLE = "padding: 4px 8px;"
+)
+
+func (htmlFormatter) Header(v *incidentView) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h2 style=\"margin-bottom: 8px;\">%s %s</h2>\n", v.Emoji, html.EscapeString(v.Title))
+	b.WriteString("<table style=\"border-left: 4px solid #ddd; padding-left: 8px; margin-bottom: 16px;\">\n")
+	for _, f := range v.Fields {
+		label := html.EscapeString(f.Label)
+		if f.Emoji != "" {
+			label = f.Emoji + " " + label
+		}
+		if f.Value == "" {
+			fmt.Fprintf(&b, "<tr><td colspan=\"2\"><b>%s</b></td></tr>\n", label)
+			continue
+		}
+		value := html.EscapeString(f.Value)
+		if f.Code {
+			value = "<code>" + value + "</code>"
+		} else {
+			value = inlineCode.ReplaceAllString(value, "<code>$1</code>")
+		}
+		if f.URL != "" {
+			value = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(f.URL), value)
+		}
+		fmt.Fprintf(&b, "<tr><td><b>%s:</b></td><td>%s%s</td></tr>\n", label, value, html.EscapeString(f.Suffix))
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
+
+func (htmlFormatter) Section(s viewSection) string {
+	title := fmt.Sprintf("<h3>%s %s</h3>\n", s.Emoji, html.EscapeString(s.Title))
+	switch {
+	case s.Prose:
+		return title + proseHTML(s.Body)
+	case len(s.Rows) > 0:
+		var b strings.Builder
+		b.WriteString(title + "<table style=\"border-collapse: collapse; font-size: 13px;\">\n")
+		for i, row := range s.Rows {
+			cell, style := "td", "border-top: 1px solid #eee;"
+			if i == 0 {
+				cell, style = "th", "background: #f4f4f4;"
+			}
+			fmt.Fprintf(&b, "<tr style=\"%s\">", style)
+			for _, c := range row {
+				fmt.Fprintf(&b, "<%s align=\"left\" style=\"%s\">%s</%s>", cell, HTML_CELL_STYLE, html.EscapeString(c), cell)
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</table>")
+		return b.String()
+	case s.Body == "":
+		return title + "<p>None recorded.</p>"
+	}
+	return title + fmt.Sprintf("<pre style=\"%s\">%s</pre>", HTML_PRE_STYLE, html.EscapeString(s.limit(DOCUMENT_LOG_LIMIT)))
+}
+
+func (f htmlFormatter) Document(v *incidentView) string {
+	parts := []string{fmt.Sprintf("<html><body style=\"%s\">", HTML_BODY_STYLE), f.Header(v)}
+	for _, s := range v.Sections {
+		parts = append(parts, f.Section(s))
+	}
+	parts = append(parts, "</body></html>")
+	return strings.Join(parts, "\n")
+}
+
+// proseHTML renders the model's Markdown: fenced and kubectl lines as code
+// blocks, inline code and bold, everything else as wrapped text.
+func proseHTML(text string) string {
+	var b strings.Builder
+	for i, block := range strings.Split(formatCodeBlocks(text), "```") {
+		if i%2 == 1 {
+			// Drop the language tag of the fence.
+			code := block
+			if j := strings.Index(code, "\n"); j >= 0 && !strings.Contains(code[:j], " ") {
+				code = code[j+1:]
+			}
+			fmt.Fprintf(&b, "<pre style=\"%s\">%s</pre>", HTML_PRE_STYLE, html.EscapeString(strings.Trim(code, "\n")))
+			continue
+		}
+		escaped := html.EscapeString(strings.Trim(block, "\n"))
+		if escaped == "" {
+			continue
+		}
+		escaped = markdownHeading.ReplaceAllString(escaped, "<b>$1</b>")
+		escaped = markdownBold.ReplaceAllString(escaped, "<b>$1</b>")
+		escaped = slackBold.ReplaceAllString(escaped, "<b>$1</b>")
+		escaped = inlineCode.ReplaceAllString(escaped, "<code>$1</code>")
+		fmt.Fprintf(&b, "<div style=\"white-space: pre-wrap;\">%s</div>", escaped)
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	HISTORY_WINDOW    = INCIDENT_RETENTION
+	HISTORY_INCIDENTS = 5
+	HISTORY_GIST      = 300
+)
+
+// workloadHistory summarizes the earlier incidents of a workload and what
+// was suggested for them, so the model can tell a recurrence from a new
+// failure and escalate when the previous fix did not help.
+func workloadHistory(config *Config, namespace, workload string, before time.Time) string {
+	if config.HistoryWindow.Duration <= 0 || workload == "" {
+		return ""
+	}
+	since := before.Add(-config.HistoryWindow.Duration)
+	incidentsMu.Lock()
+	var past []Incident
+	for _, i := range incidents {
+		if i.Namespace == namespace && i.Workload == workload && i.Time.After(since) && i.Time.Before(before) {
+			past = append(past, *i)
+		}
+	}
+	incidentsMu.Unlock()
+	if len(past) == 0 {
+		return ""
+	}
+	sort.Slice(past, func(i, j int) bool { return past[i].Time.After(past[j].Time) })
+
+	causes := map[string]int{}
+	for _, i := range past {
+		causes[i.cause()]++
+	}
+	var counts []string
+	for _, kv := range topCounts(causes, 0) {
+		counts = append(counts, fmt.Sprintf("%s ×%d", kv.key, kv.count))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d incident(s) in the last %s: %s\n", len(past), humanPeriod(config.HistoryWindow.Duration), strings.Join(counts, ", "))
+
+	limit := config.HistoryIncidents
+	if limit <= 0 {
+		limit = HISTORY_INCIDENTS
+	}
+	for n, i := range past {
+		if n == limit {
+			fmt.Fprintf(&b, "…and %d earlier\n", len(past)-n)
+			break
+		}
+		fmt.Fprintf(&b, "- %s %s", i.Time.Format("2006-01-02 15:04"), i.cause())
+		if i.ExitCode != 0 {
+			fmt.Fprintf(&b, " (exit code %d)", i.ExitCode)
+		}
+		if !i.Resolved.IsZero() {
+			fmt.Fprintf(&b, ", recovered after %s", i.Resolved.Sub(i.Time).Round(time.Minute))
+		}
+		if gist := analysisGist(&i); gist != "" {
+			fmt.Fprintf(&b, ". Previous analysis: %s", gist)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// analysisGist is the root cause of an earlier analysis, or its first lines
+// when the model answered in prose. Placeholders of analyses that never ran
+// are left out.
+func analysisGist(inc *Incident) string {
+	if inc.RootCause != "" {
+		return inc.RootCause
+	}
+	text := strings.TrimSpace(inc.Analysis)
+	if text == "" || strings.HasPrefix(text, "⚠️ *AI analysis unavailable*") || strings.HasPrefix(text, "Correlated with incident") {
+		return ""
+	}
+	text = strings.Join(strings.Fields(strings.NewReplacer("*", "", "`", "", "#", "").Replace(text)), " ")
+	return truncate(text, HISTORY_GIST)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	HOOK_TIMEOUT      = 10 * time.Second
+	HOOK_OUTPUT_LIMIT = 8000
+
+	HOOK_ENRICH   = "enrich"
+	HOOK_ALERTED  = "alerted"
+	HOOK_RESOLVED = "resolved"
+)
+
+// HooksConfig lists external commands that extend the pipeline without a
+// fork: enrichers add context to the prompt before the analysis, sinks
+// receive the finished incident like any other notifier.
+type HooksConfig struct {
+	Enrichers []HookConfig `json:"enrichers"`
+	Sinks     []HookConfig `json:"sinks"`
+}
+
+type HookConfig struct {
+	Name       string            `json:"name"`
+	Command    []string          `json:"command"`
+	Timeout    v1.Duration       `json:"timeout"`
+	Types      []string          `json:"types"`
+	Namespaces []string          `json:"namespaces"`
+	Env        map[string]string `json:"env"`
+}
+
+// hookInput is what a hook reads on stdin.
+type hookInput struct {
+	Event    string         `json:"event"`
+	Incident incidentDetail `json:"incident"`
+}
+
+// Enricher adds site-specific context to an incident before it is analyzed,
+// e.g. the owning team, recent deploys from CI or an internal runbook.
+type Enricher interface {
+	Name() string
+	Enrich(ctx context.Context, inc *Incident) (string, error)
+}
+
+// enrichers returns the enrichers configured for an incident, so they
+// follow config reloads.
+func enrichers(config *Config, inc *Incident) []Enricher {
+	var list []Enricher
+	for _, h := range config.Hooks.Enrichers {
+		if h.applies(inc) {
+			list = append(list, &ExecHook{config: h})
+		}
+	}
+	return list
+}
+
+// enrich runs the enrichers and returns their output, one block per
+// enricher. A failing enricher is logged and left out.
+func enrich(ctx context.Context, config *Config, inc *Incident) string {
+	var blocks []string
+	for _, e := range enrichers(config, inc) {
+		text, err := e.Enrich(ctx, inc)
+		if err != nil {
+			log.Printf("⚠️ Enricher %s failed for %s [%s]: %v", e.Name(), inc.Pod, inc.Namespace, err)
+			continue
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			blocks = append(blocks, fmt.Sprintf("[%s]\n%s", e.Name(), text))
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// ExecHook runs a command with the incident as JSON on stdin and its
+// details in the environment (INCIDENT_ID, INCIDENT_TYPE, NAMESPACE, POD,
+// WORKLOAD, HOOK_EVENT). The analyzer's own environment holds its tokens,
+// so the command only inherits PATH and HOME besides its configured env.
+// As an enricher, its stdout is the added context; as a sink, a non-zero
+// exit is reported as a failed notification.
+type ExecHook struct {
+	config HookConfig
+}
+
+func (h *ExecHook) Name() string {
+	if h.config.Name != "" {
+		return h.config.Name
+	}
+	if len(h.config.Command) > 0 {
+		return h.config.Command[0]
+	}
+	return "hook"
+}
+
+func (h *ExecHook) Enrich(ctx context.Context, inc *Incident) (string, error) {
+	out, err := h.run(ctx, HOOK_ENRICH, inc)
+	return truncate(out, HOOK_OUTPUT_LIMIT), err
+}
+
+func (h *ExecHook) Notify(inc *Incident) error {
+	return h.sink(HOOK_ALERTED, inc)
+}
+
+func (h *ExecHook) Resolve(inc *Incident) error {
+	return h.sink(HOOK_RESOLVED, inc)
+}
+
+func (h *ExecHook) sink(event string, inc *Incident) error {
+	if !h.config.applies(inc) {
+		return nil
+	}
+	if *dryRun {
+		fmt.Printf("----- [dry-run] %s hook %s for %s/%s\n", event, h.Name(), inc.Namespace, inc.Pod)
+		return nil
+	}
+	_, err := h.run(context.Background(), event, inc)
+	return err
+}
+
+func (h *ExecHook) run(ctx context.Context, event string, inc *Incident) (string, error) {
+	if len(h.config.Command) == 0 {
+		return "", fmt.Errorf("no command configured")
+	}
+	timeout := h.config.Timeout
+	if timeout.Duration <= 0 {
+		timeout.Duration = HOOK_TIMEOUT
+	}
+	ctx, cancel := within(ctx, timeout)
+	defer cancel()
+
+	incidentsMu.Lock()
+	input, err := json.Marshal(hookInput{Event: event, Incident: detailOf(inc)})
+	incidentsMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, h.config.Command[0], h.config.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(outbound("hook", h.Name(), input))
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME")}
+	for k, v := range h.config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Env = append(cmd.Env,
+		"HOOK_EVENT="+event,
+		"INCIDENT_ID="+inc.ID,
+		"INCIDENT_TYPE="+inc.Type,
+		"NAMESPACE="+inc.Namespace,
+		"POD="+inc.Pod,
+		"WORKLOAD="+inc.Workload,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, truncate(msg, 500))
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// applies reports whether the hook is selected for the incident's type and
+// namespace; empty lists select everything.
+func (h HookConfig) applies(inc *Incident) bool {
+	if len(h.Types) > 0 && !containsString(h.Types, inc.Type) {
+		return false
+	}
+	return len(h.Namespaces) == 0 || containsString(h.Namespaces, inc.Namespace)
+}
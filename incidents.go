@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	INCIDENT_RETENTION = 7 * 24 * time.Hour
+
+	INCIDENT_RESTART       = "restart"
+	INCIDENT_PROBE_FAILURE = "probe-failure"
+	INCIDENT_EVICTION      = "eviction"
+	INCIDENT_JOB_FAILURE   = "job-failure"
+	INCIDENT_START_FAILURE = "start-failure"
+	INCIDENT_FLAPPING      = "flapping"
+)
+
+type Incident struct {
+	ID        string
+	Type      string
+	Severity  string
+	Namespace string
+	Pod       string
+	Workload  string
+	Container string
+	Reason    string
+	ExitCode  int32
+	Category  string
+	Restarts  int
+	Changes   []string
+	Registry  string
+	Delivery  []string
+	Scaling   []string
+	Runbooks  []Runbook
+	Signature string
+	Time      time.Time
+	Events    []corev1.Event
+	Logs      string
+	Resources string
+	Analysis  string
+	Channel   string
+	ThreadTS  string
+	Resolved  time.Time
+	GroupID   string
+	Language  string
+
+	// The prompt the analysis was made with, the ts of the analysis message
+	// and the 👍/👎 votes on it by Slack user.
+	PromptVersion string
+	AnalysisTS    string
+	Votes         map[string]int
+
+	// Filled from structured model output.
+	RootCause  string
+	Confidence float64
+	NeedsHuman bool
+
+	// Model tokens spent on the analysis, including backfills and deep
+	// analyses.
+	PromptTokens   int
+	ResponseTokens int
+}
+
+var (
+	incidentsMu sync.Mutex
+	incidents   []*Incident
+)
+
+func recordIncident(inc *Incident) {
+	incidentsMu.Lock()
+	defer incidentsMu.Unlock()
+
+	cutoff := time.Now().Add(-INCIDENT_RETENTION)
+	kept := incidents[:0]
+	for _, i := range incidents {
+		if i.Time.After(cutoff) {
+			kept = append(kept, i)
+		}
+	}
+	incidents = append(kept, inc)
+	countIncident(inc)
+}
+
+// isRecorded reports whether the incident is in the store; analyses asked
+// for on demand never are.
+func isRecorded(inc *Incident) bool {
+	incidentsMu.Lock()
+	defer incidentsMu.Unlock()
+	for _, i := range incidents {
+		if i == inc {
+			return true
+		}
+	}
+	return false
+}
+
+func incidentsSince(since time.Time) []*Incident {
+	incidentsMu.Lock()
+	defer incidentsMu.Unlock()
+
+	var matched []*Incident
+	for _, i := range incidents {
+		if i.Time.After(since) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+func incidentsBySignature(signature string, since time.Time) []*Incident {
+	incidentsMu.Lock()
+	defer incidentsMu.Unlock()
+
+	var matched []*Incident
+	for _, i := range incidents {
+		if i.Signature == signature && i.Time.After(since) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+// cause is the best available one-word explanation of an incident, used to
+// group incidents in reports and to title paging alerts: the category from
+// the heuristics or the model, else the type or termination reason.
+func (i *Incident) cause() string {
+	if i.Category != "" && i.Category != "unknown" {
+		return i.Category
+	}
+	if i.Type != INCIDENT_RESTART {
+		return i.Type
+	}
+	if i.Reason != "" {
+		return i.Reason
+	}
+	return "Unknown"
+}
+
+// workloadName resolves the controller that owns a pod, stripping the
+// pod-template-hash so every ReplicaSet of a Deployment maps to one name.
+func workloadName(pod *corev1.Pod) string {
+	_, name := podController(pod)
+	return name
+}
+
+// podController returns the kind and name of the workload managing a pod,
+// reporting Deployment for pods created through a Deployment's ReplicaSet.
+func podController(pod *corev1.Pod) (string, string) {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "ReplicaSet" {
+			if hash, ok := pod.Labels["pod-template-hash"]; ok {
+				return "Deployment", strings.TrimSuffix(ref.Name, "-"+hash)
+			}
+		}
+		return ref.Kind, ref.Name
+	}
+	return "Pod", pod.Name
+}
+
+func crashSignature(namespace, workload string, cs corev1.ContainerStatus) string {
+	reason, exitCode := "Unknown", int32(0)
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		reason, exitCode = t.Reason, t.ExitCode
+	} else if w := cs.State.Waiting; w != nil {
+		reason = w.Reason
+	}
+	return signatureOf(namespace, workload, cs.Name, reason, fmt.Sprint(exitCode))
+}
+
+func signatureOf(parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(sum[:])[:12]
+}
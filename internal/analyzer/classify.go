@@ -0,0 +1,226 @@
+// Package analyzer turns what the collector gathered into a diagnosis. The
+// heuristics here recognize common failures without a model; the model's
+// structured answers are parsed and rendered here as well.
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	"github.com/ghulevishal/pod-analyzer/internal/detector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	CATEGORY_OOM           = "oom"
+	CATEGORY_IMAGE_PULL    = "image-pull"
+	CATEGORY_PROBE_FAILURE = "probe-failure"
+	CATEGORY_CONFIG_ERROR  = "config-error"
+)
+
+var (
+	missingRefPattern = regexp.MustCompile(`(configmap|secret) "[^"]+" not found|couldn't find key \S+ in (ConfigMap|Secret) \S+`)
+	configLogPattern  = regexp.MustCompile(`(?i)((missing|invalid|required|unknown) (config|configuration|setting|environment variable|env var|option)|config(uration)? (file )?(not found|error|invalid))`)
+
+	// A missing file is only a configuration problem when it is a config
+	// file or lives where ConfigMaps and Secrets are mounted; elsewhere it is
+	// as likely a bug or an unset data directory.
+	missingFilePattern = regexp.MustCompile(`(?i)no such file or directory`)
+	configPathPattern  = regexp.MustCompile(`(?i)(/etc/|/config/|/conf/|/secrets?/|/run/secrets/|\.(ya?ml|json|toml|conf|cfg|ini|properties|env|pem|crt|key)\b)`)
+)
+
+// Classification is a diagnosis reached from status fields, events and log
+// patterns alone, without asking the model.
+type Classification struct {
+	Category string
+	Summary  string
+	Fix      string
+}
+
+func (c *Classification) String() string {
+	return c.Summary + "\n\nSuggested fix: " + c.Fix
+}
+
+// Options is what Classify needs to know beyond the container itself.
+type Options struct {
+	// ProbeFailure is set for probe-failure incidents: the probes, not the
+	// exit code, explain those.
+	ProbeFailure bool
+	// ReadinessTimeout is how long a container may fail its readiness probe
+	// before it counts as stuck.
+	ReadinessTimeout time.Duration
+}
+
+// Classify recognizes the failures that don't need a model to explain them:
+// OOM kills, image pull errors, probe failures and configuration
+// errors. It returns nil for anything else.
+func Classify(pod *corev1.Pod, cs corev1.ContainerStatus, events []corev1.Event, errorLines string, opts Options) *Classification {
+	if w := cs.State.Waiting; w != nil {
+		switch {
+		case contains(detector.ImagePullReasons, w.Reason):
+			return classifyImagePull(cs, w, events)
+		case contains(detector.ConfigErrorReasons, w.Reason):
+			return classifyConfigError(cs.Name, w.Reason, w.Message)
+		}
+	}
+
+	if t := detector.LastTermination(cs); t != nil {
+		switch {
+		case t.Reason == "OOMKilled":
+			return classifyOOM(pod, cs.Name)
+		case t.ExitCode == 126 || t.ExitCode == 127:
+			return &Classification{
+				Category: CATEGORY_CONFIG_ERROR,
+				Summary:  fmt.Sprintf("Container `%s` exited with code %d: its command was not found or is not executable.", cs.Name, t.ExitCode),
+				Fix:      "Check `command`/`args` in the pod spec against the image's entrypoint and make sure the binary exists in the image and has the executable bit set.",
+			}
+		}
+	}
+
+	if opts.ProbeFailure {
+		return classifyProbeFailure(pod, cs, events, opts.ReadinessTimeout)
+	}
+
+	for _, e := range events {
+		if e.Reason == "FailedMount" && missingRefPattern.MatchString(e.Message) {
+			return classifyConfigError(cs.Name, e.Reason, e.Message)
+		}
+	}
+	// Applications exit with 1 after rejecting their configuration; other
+	// codes point elsewhere.
+	if t := detector.LastTermination(cs); t == nil || t.ExitCode != 1 {
+		return nil
+	}
+	for _, line := range strings.Split(errorLines, "\n") {
+		if configLogPattern.MatchString(line) || missingFilePattern.MatchString(line) && configPathPattern.MatchString(line) {
+			return &Classification{
+				Category: CATEGORY_CONFIG_ERROR,
+				Summary:  fmt.Sprintf("Container `%s` stopped after reporting a configuration problem: `%s`", cs.Name, truncate(strings.TrimSpace(line), 300)),
+				Fix:      "Check the environment variables, ConfigMaps, Secrets and mounted files the application reads at startup against what it expects.",
+			}
+		}
+	}
+	return nil
+}
+
+func classifyOOM(pod *corev1.Pod, container string) *Classification {
+	limit := MemoryLimit(pod, container)
+	if limit.IsZero() {
+		return &Classification{
+			Category: CATEGORY_OOM,
+			Summary:  fmt.Sprintf("Container `%s` was OOMKilled without a memory limit: the node itself ran out of memory.", container),
+			Fix:      "Set memory requests and limits that match the container's real usage so the scheduler can place it on a node with room, and look for a leak if usage keeps growing.",
+		}
+	}
+	return &Classification{
+		Category: CATEGORY_OOM,
+		Summary:  fmt.Sprintf("Container `%s` was OOMKilled: it exceeded its memory limit of %s.", container, limit.String()),
+		Fix:      "Compare peak usage in the Resources section with the limit. Raise the limit if the workload legitimately needs more, otherwise look for a memory leak or an unbounded cache.",
+	}
+}
+
+func classifyImagePull(cs corev1.ContainerStatus, w *corev1.ContainerStateWaiting, events []corev1.Event) *Classification {
+	message := w.Message
+	for _, e := range events {
+		if e.Reason == "Failed" && strings.Contains(e.Message, "pull") {
+			message = e.Message
+		}
+	}
+	lower := strings.ToLower(message)
+
+	c := &Classification{Category: CATEGORY_IMAGE_PULL}
+	switch {
+	case w.Reason == "InvalidImageName":
+		c.Summary = fmt.Sprintf("Image reference `%s` of container `%s` is not a valid image name.", cs.Image, cs.Name)
+		c.Fix = "Correct the image reference in the pod spec (registry/repository:tag or @sha256 digest)."
+	case w.Reason == "ErrImageNeverPull":
+		c.Summary = fmt.Sprintf("Image `%s` is not present on the node and `imagePullPolicy: Never` forbids pulling it.", cs.Image)
+		c.Fix = "Pre-load the image on every node or change imagePullPolicy to IfNotPresent."
+	case strings.Contains(lower, "unauthorized") || strings.Contains(lower, "denied") || strings.Contains(lower, "authentication required") || strings.Contains(lower, "403 forbidden"):
+		c.Summary = fmt.Sprintf("The registry refused to serve `%s` to the node: missing or invalid credentials.", cs.Image)
+		c.Fix = "Check the pod's imagePullSecrets (or its service account's) and that the credentials still have pull access to the repository."
+	case strings.Contains(lower, "not found") || strings.Contains(lower, "manifest unknown") || strings.Contains(lower, "does not exist"):
+		c.Summary = fmt.Sprintf("Image `%s` does not exist in the registry.", cs.Image)
+		c.Fix = "Check the repository name and tag for typos, and that the image was actually pushed by the build."
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "no such host") || strings.Contains(lower, "connection refused"):
+		c.Summary = fmt.Sprintf("The node could not reach the registry for `%s`.", cs.Image)
+		c.Fix = "Check DNS and egress from the nodes to the registry (firewall rules, proxy settings, registry status)."
+	default:
+		c.Summary = fmt.Sprintf("The node failed to pull image `%s` (%s).", cs.Image, w.Reason)
+		c.Fix = "See the pull error in the events for the exact cause."
+	}
+	if message != "" {
+		c.Summary += "\n> " + truncate(message, 500)
+	}
+	return c
+}
+
+func classifyConfigError(container, reason, message string) *Classification {
+	c := &Classification{
+		Category: CATEGORY_CONFIG_ERROR,
+		Summary:  fmt.Sprintf("Container `%s` cannot start (%s): %s", container, reason, truncate(message, 500)),
+		Fix:      "Fix the container's command, working directory or mounts so the runtime can start it.",
+	}
+	if missingRefPattern.MatchString(message) {
+		c.Fix = "Create the missing ConfigMap/Secret or key in the pod's namespace, or mark the reference `optional: true` if the application can run without it."
+	}
+	return c
+}
+
+func classifyProbeFailure(pod *corev1.Pod, cs corev1.ContainerStatus, events []corev1.Event, readinessTimeout time.Duration) *Classification {
+	var summary, fix string
+	if detector.StuckUnready(pod, cs, readinessTimeout) {
+		failure := detector.ProbeFailure(events, cs.Name, "Readiness")
+		if failure == "" {
+			failure = "no failure was recorded in the events"
+		}
+		summary = fmt.Sprintf("Container `%s` has not passed its readiness probe since %s, so the pod gets no traffic: %s",
+			cs.Name, detector.UnreadySince(pod, cs).UTC().Format("15:04:05"), truncate(failure, 500))
+		fix = "Check that the probe's path and port match what the application serves. If the application waits for a dependency before reporting ready, the logs show which one; if it is only slow to start, raise initialDelaySeconds or failureThreshold."
+	} else {
+		failure := detector.ProbeFailure(events, cs.Name, "Liveness")
+		if failure == "" {
+			failure = "the kubelet restarted the container after repeated failures"
+		}
+		summary = fmt.Sprintf("Liveness probe of container `%s` failed: %s", cs.Name, truncate(failure, 500))
+		fix = "If the application is healthy but slow (startup, GC pauses, load), raise timeoutSeconds/failureThreshold or add a startupProbe. If the endpoint really fails, the logs before the restart show why."
+	}
+	if probes := collector.DescribeProbes(pod, cs.Name); probes != "" {
+		summary += "\n```" + probes + "```"
+	}
+	return &Classification{
+		Category: CATEGORY_PROBE_FAILURE,
+		Summary:  summary,
+		Fix:      fix,
+	}
+}
+
+// MemoryLimit is the container's memory limit, zero if it has none.
+func MemoryLimit(pod *corev1.Pod, container string) *resource.Quantity {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return c.Resources.Limits.Memory()
+		}
+	}
+	return &resource.Quantity{}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "... (truncated)"
+}
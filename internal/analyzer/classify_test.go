@@ -0,0 +1,117 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podWith(container corev1.Container) *corev1.Pod {
+	return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{container}}}
+}
+
+func terminated(exitCode int32, reason string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:                 "app",
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason}},
+	}
+}
+
+func waiting(reason, message string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:  "app",
+		Image: "registry.example.com/shop/api:1.2.3",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+	}
+}
+
+func TestClassifyOOM(t *testing.T) {
+	limited := podWith(corev1.Container{Name: "app", Resources: corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+	}})
+	c := Classify(limited, terminated(137, "OOMKilled"), nil, "", Options{})
+	if c == nil || c.Category != CATEGORY_OOM || !strings.Contains(c.Summary, "256Mi") {
+		t.Errorf("Classify = %+v, want an OOM naming the 256Mi limit", c)
+	}
+
+	c = Classify(podWith(corev1.Container{Name: "app"}), terminated(137, "OOMKilled"), nil, "", Options{})
+	if c == nil || !strings.Contains(c.Summary, "without a memory limit") {
+		t.Errorf("Classify = %+v, want an OOM without a memory limit", c)
+	}
+}
+
+func TestClassifyImagePull(t *testing.T) {
+	tests := []struct {
+		reason, message, want string
+	}{
+		{"ImagePullBackOff", "pull access denied, repository does not exist or may require authorization", "refused"},
+		{"ErrImagePull", "manifest unknown", "does not exist"},
+		{"ErrImagePull", "dial tcp: lookup registry.example.com: no such host", "could not reach"},
+		{"InvalidImageName", "", "not a valid image name"},
+	}
+	for _, tt := range tests {
+		c := Classify(podWith(corev1.Container{Name: "app"}), waiting(tt.reason, tt.message), nil, "", Options{})
+		if c == nil || c.Category != CATEGORY_IMAGE_PULL || !strings.Contains(c.Summary, tt.want) {
+			t.Errorf("%s %q: Classify = %+v, want a summary containing %q", tt.reason, tt.message, c, tt.want)
+		}
+	}
+}
+
+func TestClassifyConfigError(t *testing.T) {
+	c := Classify(podWith(corev1.Container{Name: "app"}), waiting("CreateContainerConfigError", `secret "db-credentials" not found`), nil, "", Options{})
+	if c == nil || c.Category != CATEGORY_CONFIG_ERROR || !strings.Contains(c.Fix, "Create the missing ConfigMap/Secret") {
+		t.Errorf("missing secret: Classify = %+v", c)
+	}
+
+	c = Classify(podWith(corev1.Container{Name: "app"}), terminated(127, "Error"), nil, "", Options{})
+	if c == nil || c.Category != CATEGORY_CONFIG_ERROR || !strings.Contains(c.Summary, "not found or is not executable") {
+		t.Errorf("exit 127: Classify = %+v", c)
+	}
+
+	logs := "open /etc/app/config.yaml: no such file or directory"
+	if c := Classify(podWith(corev1.Container{Name: "app"}), terminated(1, "Error"), nil, logs, Options{}); c == nil || c.Category != CATEGORY_CONFIG_ERROR {
+		t.Errorf("missing config file, exit 1: Classify = %+v, want a config error", c)
+	}
+	if c := Classify(podWith(corev1.Container{Name: "app"}), terminated(2, "Error"), nil, logs, Options{}); c != nil {
+		t.Errorf("missing config file, exit 2: Classify = %+v, want nil", c)
+	}
+	logs = "open /data/cache.db: no such file or directory"
+	if c := Classify(podWith(corev1.Container{Name: "app"}), terminated(1, "Error"), nil, logs, Options{}); c != nil {
+		t.Errorf("missing data file: Classify = %+v, want nil", c)
+	}
+}
+
+func TestClassifyProbeFailure(t *testing.T) {
+	pod := podWith(corev1.Container{Name: "app", LivenessProbe: &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"cat", "/tmp/healthy"}}},
+	}})
+	events := []corev1.Event{{
+		InvolvedObject: corev1.ObjectReference{FieldPath: "spec.containers{app}"},
+		Reason:         "Unhealthy",
+		Message:        "Liveness probe failed: cat: /tmp/healthy: No such file or directory",
+	}}
+	c := Classify(pod, terminated(137, "Error"), events, "", Options{ProbeFailure: true})
+	if c == nil || c.Category != CATEGORY_PROBE_FAILURE || !strings.Contains(c.Summary, "/tmp/healthy: No such file") || !strings.Contains(c.Summary, `exec "cat /tmp/healthy"`) {
+		t.Errorf("liveness: Classify = %+v", c)
+	}
+
+	pod = podWith(corev1.Container{Name: "app", ReadinessProbe: &corev1.Probe{}})
+	cs := corev1.ContainerStatus{
+		Name:  "app",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: v1.NewTime(time.Now().Add(-time.Hour))}},
+	}
+	c = Classify(pod, cs, nil, "", Options{ProbeFailure: true, ReadinessTimeout: 10 * time.Minute})
+	if c == nil || !strings.Contains(c.Summary, "has not passed its readiness probe") {
+		t.Errorf("readiness: Classify = %+v", c)
+	}
+}
+
+func TestClassifyUnknown(t *testing.T) {
+	if c := Classify(podWith(corev1.Container{Name: "app"}), terminated(1, "Error"), nil, "ERROR something went wrong", Options{}); c != nil {
+		t.Errorf("Classify = %+v, want nil for an application error", c)
+	}
+}
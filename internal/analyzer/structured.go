@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StructuredAnalysis is the analysis as fields instead of prose, requested
+// through a JSON schema so routing, the API and metrics can rely on it.
+type StructuredAnalysis struct {
+	RootCause         string   `json:"root_cause"`
+	Category          string   `json:"category"`
+	Confidence        float64  `json:"confidence"`
+	Explanation       string   `json:"explanation"`
+	SuggestedCommands []string `json:"suggested_commands"`
+	NeedsHuman        bool     `json:"needs_human"`
+}
+
+// AnalysisSchema is the JSON schema of StructuredAnalysis, as the model is
+// asked to follow it.
+var AnalysisSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"root_cause": map[string]interface{}{"type": "string", "description": "One sentence naming the most likely root cause."},
+		"category": map[string]interface{}{
+			"type": "string",
+			"enum": []string{"oom", "image-pull", "probe-failure", "config-error", "application-error", "dependency", "resource-pressure", "storage", "network", "unknown"},
+		},
+		"confidence":         map[string]interface{}{"type": "number", "description": "0 to 1."},
+		"explanation":        map[string]interface{}{"type": "string", "description": "Short reasoning and the suggested fix."},
+		"suggested_commands": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "kubectl commands that help diagnose or fix the issue."},
+		"needs_human":        map[string]interface{}{"type": "boolean", "description": "True if the fix needs a human decision or the cause is unclear."},
+	},
+	"required":             []string{"root_cause", "category", "confidence", "explanation", "suggested_commands", "needs_human"},
+	"additionalProperties": false,
+}
+
+// ParseStructured reads a model answer given for AnalysisSchema. It returns
+// nil for a model that ignored the schema, whose answer is then used as
+// plain text.
+func ParseStructured(raw string) *StructuredAnalysis {
+	var s StructuredAnalysis
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &s); err != nil || s.RootCause == "" {
+		return nil
+	}
+	return &s
+}
+
+// Text renders the fields the way the plain-text analysis reads in Slack,
+// with commands on their own lines so they get code blocks and validation.
+func (s *StructuredAnalysis) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Root cause:* %s\n", s.RootCause)
+	fmt.Fprintf(&b, "*Category:* `%s` · *Confidence:* %.0f%%", s.Category, s.Confidence*100)
+	if s.NeedsHuman {
+		b.WriteString(" · 🙋 needs human review")
+	}
+	b.WriteString("\n\n" + s.Explanation)
+	if len(s.SuggestedCommands) > 0 {
+		b.WriteString("\n\n")
+		b.WriteString(strings.Join(s.SuggestedCommands, "\n"))
+	}
+	return b.String()
+}
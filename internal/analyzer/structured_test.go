@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStructured(t *testing.T) {
+	raw := `
+	{"root_cause": "The database password is wrong.", "category": "config-error", "confidence": 0.8,
+	 "explanation": "The app exits after authentication fails.", "suggested_commands": ["kubectl -n shop get secret db"], "needs_human": true}`
+
+	s := ParseStructured(raw)
+	if s == nil {
+		t.Fatal("ParseStructured rejected a valid answer")
+	}
+	text := s.Text()
+	for _, want := range []string{
+		"*Root cause:* The database password is wrong.",
+		"`config-error` · *Confidence:* 80%",
+		"needs human review",
+		"\n\nkubectl -n shop get secret db",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text() is missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestParseStructuredPlainText(t *testing.T) {
+	for _, raw := range []string{
+		"The container ran out of memory.",
+		`{"category": "oom"}`,
+	} {
+		if s := ParseStructured(raw); s != nil {
+			t.Errorf("ParseStructured(%q) = %+v, want nil", raw, s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package collector gathers the context of an incident from the cluster:
+// the pod's events and logs, and descriptions of its probes. It trims what
+// it collects to what helps a diagnosis, but leaves permissions, timeouts
+// and configuration to the caller.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DIAGNOSIS_EVENT_REASON marks the events the analyzer attaches to pods
+// itself; they are not context for the next analysis.
+const DIAGNOSIS_EVENT_REASON = "PodAnalyzerDiagnosis"
+
+// PodEvents returns the events recorded for a pod since the given time,
+// oldest first.
+func PodEvents(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, since time.Time) ([]corev1.Event, error) {
+	eventList, err := clientset.CoreV1().Events(namespace).List(ctx, v1.ListOptions{
+		FieldSelector: "involvedObject.name=" + podName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []corev1.Event
+	for _, e := range eventList.Items {
+		if e.Reason != DIAGNOSIS_EVENT_REASON && EventTime(e).After(since) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return EventTime(events[i]).Before(EventTime(events[j]))
+	})
+	return events, nil
+}
+
+// EventTime picks the most recent timestamp an event carries; events created
+// through events.k8s.io only set EventTime.
+func EventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+func FormatEvents(events []corev1.Event) string {
+	var lines []string
+	for _, e := range events {
+		source := e.Source.Component
+		if source == "" {
+			source = e.ReportingController
+		}
+		count := e.Count
+		if count == 0 {
+			count = 1
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s (x%d, %s): %s", EventTime(e).Format("15:04:05"), e.Type, e.Reason, count, source, e.Message))
+	}
+	return strings.Join(lines, "\n")
+}
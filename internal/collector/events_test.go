@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func event(name, reason string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     v1.ObjectMeta{Name: name, Namespace: "shop"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "api-0", Namespace: "shop"},
+		Reason:         reason,
+		Type:           corev1.EventTypeWarning,
+		LastTimestamp:  v1.NewTime(at),
+	}
+}
+
+func TestPodEvents(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	clientset := fake.NewSimpleClientset(
+		event("backoff", "BackOff", now.Add(-time.Minute)),
+		event("pulled", "Pulled", now.Add(-3*time.Minute)),
+		event("stale", "Scheduled", now.Add(-time.Hour)),
+		event("diagnosis", DIAGNOSIS_EVENT_REASON, now),
+	)
+	var selector string
+	clientset.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector = action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+		return false, nil, nil
+	})
+
+	events, err := PodEvents(context.Background(), clientset, "shop", "api-0", now.Add(-10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selector != "involvedObject.name=api-0" {
+		t.Errorf("field selector = %q, want involvedObject.name=api-0", selector)
+	}
+	var reasons []string
+	for _, e := range events {
+		reasons = append(reasons, e.Reason)
+	}
+	if got, want := strings.Join(reasons, ","), "Pulled,BackOff"; got != want {
+		t.Errorf("events = %s, want %s (oldest first, without stale or diagnosis events)", got, want)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	last := first.Add(time.Minute)
+
+	e := corev1.Event{FirstTimestamp: v1.NewTime(first), LastTimestamp: v1.NewTime(last)}
+	if got := EventTime(e); !got.Equal(last) {
+		t.Errorf("EventTime = %v, want LastTimestamp %v", got, last)
+	}
+	e = corev1.Event{EventTime: v1.NewMicroTime(first)}
+	if got := EventTime(e); !got.Equal(first) {
+		t.Errorf("EventTime for an events.k8s.io event = %v, want EventTime %v", got, first)
+	}
+}
+
+func TestFormatEvents(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 5, 0, time.UTC)
+	e := *event("backoff", "BackOff", at)
+	e.Message = "Back-off restarting failed container"
+	e.ReportingController = "kubelet"
+
+	want := "12:30:05 Warning BackOff (x1, kubelet): Back-off restarting failed container"
+	if got := FormatEvents([]corev1.Event{e}); got != want {
+		t.Errorf("FormatEvents = %q, want %q", got, want)
+	}
+}
+
+func TestContainerLogs(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "api-0", Namespace: "shop"}})
+	logs, err := ContainerLogs(context.Background(), clientset, "shop", "api-0", &corev1.PodLogOptions{Container: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake clientset serves a fixed body for every log request.
+	if logs != "fake logs" {
+		t.Errorf("ContainerLogs = %q, want the fake clientset's logs", logs)
+	}
+}
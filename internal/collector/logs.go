@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const STACK_BLOCK_LINES = 40
+
+var (
+	// Lines that open a multi-line crash report worth keeping whole.
+	stackStartPattern = regexp.MustCompile(`^(panic: |fatal error: |Traceback \(most recent call last\)|Exception in thread |Caused by: |\S+(Exception|Error): )`)
+	// Lines that continue a stack trace: indented frames, goroutine headers,
+	// Go function frames, Java "... N more" markers and the closing
+	// exception line of a Python traceback.
+	stackContinuePattern = regexp.MustCompile(`^(\s+\S|goroutine \d+ |\S+\(.*\)$|Caused by: |created by |\S+(Exception|Error)(: |$))`)
+	levelPattern         = regexp.MustCompile(`(?i)("level"\s*:\s*"(error|fatal|panic|critical)"|level=(error|fatal|panic)|\b(ERROR|FATAL|CRITICAL|SEVERE)\b|^[EF]\d{4} )`)
+)
+
+// ContainerLogs reads a container's logs from the kubelet, through the API
+// server.
+func ContainerLogs(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, opts *corev1.PodLogOptions) (string, error) {
+	raw, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, opts).DoRaw(ctx)
+	return string(raw), err
+}
+
+// ExtractErrors pulls the diagnostic signal out of noisy logs: complete
+// panic/stack trace blocks and error-level lines, with repeated lines
+// collapsed. The result is capped to maxBytes, keeping the latest blocks.
+func ExtractErrors(logs string, patterns []*regexp.Regexp, maxBytes int) string {
+	lines := strings.Split(logs, "\n")
+
+	var blocks []string
+	counts := map[string]int{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if stackStartPattern.MatchString(line) {
+			block := []string{line}
+			for i+1 < len(lines) && len(block) < STACK_BLOCK_LINES {
+				next := lines[i+1]
+				// Go separates the panic message from the goroutine dump
+				// with a blank line.
+				blankThenFrame := next == "" && i+2 < len(lines) && stackContinuePattern.MatchString(lines[i+2])
+				if !blankThenFrame && !stackContinuePattern.MatchString(next) {
+					break
+				}
+				i++
+				block = append(block, next)
+			}
+			if len(block) > 1 {
+				blocks = append(blocks, strings.Join(block, "\n"))
+				continue
+			}
+		}
+		if levelPattern.MatchString(line) || MatchesAny(line, patterns) {
+			key := strings.TrimSpace(line)
+			if counts[key] == 0 {
+				blocks = append(blocks, key)
+			}
+			counts[key]++
+		}
+	}
+
+	for i, b := range blocks {
+		if n := counts[b]; n > 1 {
+			blocks[i] = fmt.Sprintf("%s  (repeated %d times)", b, n)
+		}
+	}
+
+	// Walk backwards so the most recent errors survive the byte cap.
+	var kept []string
+	used := 0
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if maxBytes > 0 && used+len(blocks[i])+1 > maxBytes {
+			break
+		}
+		kept = append([]string{blocks[i]}, kept...)
+		used += len(blocks[i]) + 1
+	}
+	return strings.Join(kept, "\n")
+}
+
+// SmartTruncate shrinks logs to maxBytes while keeping what matters for a
+// diagnosis: the most recent lines, plus earlier lines matching an error
+// pattern (up to a third of the budget).
+func SmartTruncate(logs string, maxBytes int, patterns []*regexp.Regexp) string {
+	if maxBytes <= 0 || len(logs) <= maxBytes {
+		return logs
+	}
+	lines := strings.Split(logs, "\n")
+
+	tailBudget := maxBytes * 2 / 3
+	start, used := len(lines), 0
+	for start > 0 && used+len(lines[start-1])+1 <= tailBudget {
+		start--
+		used += len(lines[start]) + 1
+	}
+	if start == len(lines) {
+		return "(truncated) ..." + logs[len(logs)-maxBytes:]
+	}
+
+	errorBudget := maxBytes - used
+	var errorLines []string
+	for i := start - 1; i >= 0 && errorBudget > 0; i-- {
+		if !MatchesAny(lines[i], patterns) {
+			continue
+		}
+		if len(lines[i])+1 > errorBudget {
+			break
+		}
+		errorLines = append([]string{lines[i]}, errorLines...)
+		errorBudget -= len(lines[i]) + 1
+	}
+
+	var b strings.Builder
+	if len(errorLines) > 0 {
+		fmt.Fprintf(&b, "[... %d earlier lines omitted, %d error lines kept ...]\n", start-len(errorLines), len(errorLines))
+		b.WriteString(strings.Join(errorLines, "\n"))
+		b.WriteString("\n[... last lines ...]\n")
+	} else {
+		fmt.Fprintf(&b, "[... %d earlier lines omitted ...]\n", start)
+	}
+	b.WriteString(strings.Join(lines[start:], "\n"))
+	return b.String()
+}
+
+func MatchesAny(line string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestExtractErrorsKeepsStackTraces(t *testing.T) {
+	logs := strings.Join([]string{
+		"level=info msg=\"starting server\"",
+		"panic: runtime error: invalid memory address or nil pointer dereference",
+		"",
+		"goroutine 1 [running]:",
+		"main.handler(0x0)",
+		"\t/app/main.go:42 +0x1d",
+		"level=info msg=\"unrelated\"",
+	}, "\n")
+
+	got := ExtractErrors(logs, nil, 0)
+	if !strings.HasPrefix(got, "panic: runtime error") || !strings.Contains(got, "/app/main.go:42") {
+		t.Errorf("ExtractErrors lost the panic block:\n%s", got)
+	}
+	if strings.Contains(got, "level=info") {
+		t.Errorf("ExtractErrors kept info lines:\n%s", got)
+	}
+}
+
+func TestExtractErrorsCollapsesRepeats(t *testing.T) {
+	logs := strings.Repeat("ERROR connection refused\n", 3) + "level=info ok\nupstream timed out"
+	patterns := []*regexp.Regexp{regexp.MustCompile(`timed out`)}
+
+	want := "ERROR connection refused  (repeated 3 times)\nupstream timed out"
+	if got := ExtractErrors(logs, patterns, 0); got != want {
+		t.Errorf("ExtractErrors = %q, want %q", got, want)
+	}
+	if got := ExtractErrors(logs, patterns, 30); got != "upstream timed out" {
+		t.Errorf("ExtractErrors under a byte cap = %q, want only the latest error", got)
+	}
+}
+
+func TestSmartTruncate(t *testing.T) {
+	var lines []string
+	lines = append(lines, "ERROR database unreachable")
+	for i := 0; i < 50; i++ {
+		lines = append(lines, "info line padding padding")
+	}
+	lines = append(lines, "last line")
+	logs := strings.Join(lines, "\n")
+	patterns := []*regexp.Regexp{regexp.MustCompile(`ERROR`)}
+
+	if got := SmartTruncate(logs, len(logs), patterns); got != logs {
+		t.Error("SmartTruncate changed logs that fit")
+	}
+	got := SmartTruncate(logs, 300, patterns)
+	if !strings.Contains(got, "ERROR database unreachable") || !strings.HasSuffix(got, "last line") {
+		t.Errorf("SmartTruncate dropped the early error or the tail:\n%s", got)
+	}
+	if !strings.Contains(got, "error lines kept") {
+		t.Errorf("SmartTruncate did not mark the omitted lines:\n%s", got)
+	}
+}
+
+func TestDescribeProbes(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "app",
+		LivenessProbe: &corev1.Probe{
+			ProbeHandler:     corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(8080)}},
+			PeriodSeconds:    10,
+			TimeoutSeconds:   1,
+			FailureThreshold: 3,
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("http")}},
+		},
+	}}}}
+
+	want := "liveness: httpGet /healthz port 8080, initialDelay=0s timeout=1s period=10s failureThreshold=3\n" +
+		"readiness: tcpSocket port http, initialDelay=0s timeout=0s period=0s failureThreshold=0"
+	if got := DescribeProbes(pod, "app"); got != want {
+		t.Errorf("DescribeProbes =\n%s\nwant\n%s", got, want)
+	}
+	if got := DescribeProbes(pod, "sidecar"); got != "" {
+		t.Errorf("DescribeProbes for an unknown container = %q, want empty", got)
+	}
+}
@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DescribeProbes lists the container's liveness, readiness and startup
+// probes, one per line.
+func DescribeProbes(pod *corev1.Pod, container string) string {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != container {
+			continue
+		}
+		var lines []string
+		for _, p := range []struct {
+			kind  string
+			probe *corev1.Probe
+		}{{"liveness", c.LivenessProbe}, {"readiness", c.ReadinessProbe}, {"startup", c.StartupProbe}} {
+			if p.probe != nil {
+				lines = append(lines, p.kind+": "+DescribeProbe(p.probe))
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return ""
+}
+
+func DescribeProbe(p *corev1.Probe) string {
+	var handler string
+	switch {
+	case p.HTTPGet != nil:
+		handler = fmt.Sprintf("httpGet %s port %s", p.HTTPGet.Path, p.HTTPGet.Port.String())
+	case p.TCPSocket != nil:
+		handler = fmt.Sprintf("tcpSocket port %s", p.TCPSocket.Port.String())
+	case p.GRPC != nil:
+		handler = fmt.Sprintf("grpc port %d", p.GRPC.Port)
+	case p.Exec != nil:
+		handler = fmt.Sprintf("exec %q", strings.Join(p.Exec.Command, " "))
+	}
+	return fmt.Sprintf("%s, initialDelay=%ds timeout=%ds period=%ds failureThreshold=%d",
+		handler, p.InitialDelaySeconds, p.TimeoutSeconds, p.PeriodSeconds, p.FailureThreshold)
+}
@@ -0,0 +1,57 @@
+// Package detector recognizes failing containers from the pod status and
+// the events the kubelet records: terminations, containers that never start
+// or never become ready, and evictions. It only reads the objects it is
+// given; fetching them is up to the caller.
+package detector
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	ImagePullReasons   = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"}
+	ConfigErrorReasons = []string{"CreateContainerConfigError", "CreateContainerError", "RunContainerError"}
+)
+
+// LastTermination is the most recent termination of a container: the
+// previous instance once it has restarted, or the current one before that.
+func LastTermination(cs corev1.ContainerStatus) *corev1.ContainerStateTerminated {
+	if cs.LastTerminationState.Terminated != nil {
+		return cs.LastTerminationState.Terminated
+	}
+	return cs.State.Terminated
+}
+
+// StuckWaiting reports whether a container is waiting for a reason that will
+// not clear without a change to the pod, so it never starts and never shows
+// up as a restart.
+func StuckWaiting(cs corev1.ContainerStatus) bool {
+	w := cs.State.Waiting
+	return w != nil && (contains(ImagePullReasons, w.Reason) || contains(ConfigErrorReasons, w.Reason))
+}
+
+func IsEvicted(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodFailed && pod.Status.Reason == "Evicted"
+}
+
+// EvictionTime uses the DisruptionTarget condition the kubelet sets on
+// evicted pods, falling back to now for older clusters.
+func EvictionTime(pod *corev1.Pod) time.Time {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.DisruptionTarget && !c.LastTransitionTime.IsZero() {
+			return c.LastTransitionTime.Time
+		}
+	}
+	return time.Now()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
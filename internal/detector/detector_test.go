@@ -0,0 +1,78 @@
+package detector
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLastTermination(t *testing.T) {
+	previous := &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}
+	current := &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}
+
+	cs := corev1.ContainerStatus{State: corev1.ContainerState{Terminated: current}}
+	if got := LastTermination(cs); got != current {
+		t.Errorf("before a restart: got %v, want the current termination", got)
+	}
+
+	cs.LastTerminationState.Terminated = previous
+	if got := LastTermination(cs); got != previous {
+		t.Errorf("after a restart: got %v, want the previous termination", got)
+	}
+
+	if got := LastTermination(corev1.ContainerStatus{}); got != nil {
+		t.Errorf("running container: got %v, want nil", got)
+	}
+}
+
+func TestStuckWaiting(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   bool
+	}{
+		{"ImagePullBackOff", true},
+		{"ErrImagePull", true},
+		{"CreateContainerConfigError", true},
+		{"ContainerCreating", false},
+		{"CrashLoopBackOff", false},
+	}
+	for _, tt := range tests {
+		cs := corev1.ContainerStatus{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: tt.reason}}}
+		if got := StuckWaiting(cs); got != tt.want {
+			t.Errorf("StuckWaiting(%s) = %v, want %v", tt.reason, got, tt.want)
+		}
+	}
+	if StuckWaiting(corev1.ContainerStatus{}) {
+		t.Error("StuckWaiting reported a container that is not waiting")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	evictedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	pod := &corev1.Pod{Status: corev1.PodStatus{
+		Phase:  corev1.PodFailed,
+		Reason: "Evicted",
+		Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, LastTransitionTime: v1.NewTime(evictedAt.Add(-time.Hour))},
+			{Type: corev1.DisruptionTarget, LastTransitionTime: v1.NewTime(evictedAt)},
+		},
+	}}
+	if !IsEvicted(pod) {
+		t.Fatal("IsEvicted = false for a failed pod with reason Evicted")
+	}
+	if got := EvictionTime(pod); !got.Equal(evictedAt) {
+		t.Errorf("EvictionTime = %v, want %v", got, evictedAt)
+	}
+
+	pod.Status.Conditions = nil
+	if got := EvictionTime(pod); time.Since(got) > time.Minute {
+		t.Errorf("EvictionTime without a DisruptionTarget condition = %v, want now", got)
+	}
+
+	pod.Status.Reason = "Error"
+	if IsEvicted(pod) {
+		t.Error("IsEvicted = true for a pod that failed for another reason")
+	}
+}
@@ -0,0 +1,86 @@
+package detector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LivenessProbeFailed reports whether the kubelet killed the container
+// because its liveness probe failed, based on the Unhealthy/Killing events
+// it records against the container's field path.
+func LivenessProbeFailed(events []corev1.Event, container string) bool {
+	fieldPath := fmt.Sprintf("spec.containers{%s}", container)
+	for _, e := range events {
+		if e.InvolvedObject.FieldPath != "" && e.InvolvedObject.FieldPath != fieldPath {
+			continue
+		}
+		switch {
+		case e.Reason == "Unhealthy" && strings.HasPrefix(e.Message, "Liveness probe failed"):
+			return true
+		case e.Reason == "Killing" && strings.Contains(e.Message, "failed liveness probe"):
+			return true
+		}
+	}
+	return false
+}
+
+// UnreadySince returns since when a running container with a readiness
+// probe has been failing it: the later of its start and the pod's Ready
+// condition turning false. It is zero for containers that are ready, not
+// running or have no readiness probe.
+func UnreadySince(pod *corev1.Pod, cs corev1.ContainerStatus) time.Time {
+	r := cs.State.Running
+	if r == nil || cs.Ready || r.StartedAt.IsZero() || !hasReadinessProbe(pod, cs.Name) {
+		return time.Time{}
+	}
+	since := r.StartedAt.Time
+	for _, c := range pod.Status.Conditions {
+		if c.Type != corev1.PodReady {
+			continue
+		}
+		if c.Status == corev1.ConditionTrue {
+			return time.Time{}
+		}
+		if c.LastTransitionTime.After(since) {
+			since = c.LastTransitionTime.Time
+		}
+	}
+	return since
+}
+
+// StuckUnready reports whether a container has been failing its readiness
+// probe for longer than timeout. It gets no traffic, but never restarts
+// either, so a restart watch cannot see it. A short dependency blip of a
+// long-running container clears well before the timeout.
+func StuckUnready(pod *corev1.Pod, cs corev1.ContainerStatus, timeout time.Duration) bool {
+	since := UnreadySince(pod, cs)
+	return timeout > 0 && !since.IsZero() && time.Since(since) >= timeout
+}
+
+// ProbeFailure returns the latest failure the kubelet recorded for a probe
+// of the container ("Liveness", "Readiness" or "Startup"), or "".
+func ProbeFailure(events []corev1.Event, container, kind string) string {
+	fieldPath := fmt.Sprintf("spec.containers{%s}", container)
+	failure := ""
+	for _, e := range events {
+		if e.InvolvedObject.FieldPath != "" && e.InvolvedObject.FieldPath != fieldPath {
+			continue
+		}
+		if e.Reason == "Unhealthy" && strings.HasPrefix(e.Message, kind+" probe failed") {
+			failure = e.Message
+		}
+	}
+	return failure
+}
+
+func hasReadinessProbe(pod *corev1.Pod, container string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return c.ReadinessProbe != nil
+		}
+	}
+	return false
+}
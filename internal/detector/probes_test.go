@@ -0,0 +1,111 @@
+package detector
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func probeEvent(container, reason, message string) corev1.Event {
+	return corev1.Event{
+		InvolvedObject: corev1.ObjectReference{FieldPath: "spec.containers{" + container + "}"},
+		Reason:         reason,
+		Message:        message,
+	}
+}
+
+func TestLivenessProbeFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []corev1.Event
+		want   bool
+	}{
+		{"unhealthy", []corev1.Event{probeEvent("app", "Unhealthy", "Liveness probe failed: HTTP probe failed with statuscode: 500")}, true},
+		{"killing", []corev1.Event{probeEvent("app", "Killing", "Container app failed liveness probe, will be restarted")}, true},
+		{"readiness only", []corev1.Event{probeEvent("app", "Unhealthy", "Readiness probe failed: connection refused")}, false},
+		{"other container", []corev1.Event{probeEvent("sidecar", "Unhealthy", "Liveness probe failed: timeout")}, false},
+		{"no events", nil, false},
+	}
+	for _, tt := range tests {
+		if got := LivenessProbeFailed(tt.events, "app"); got != tt.want {
+			t.Errorf("%s: LivenessProbeFailed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProbeFailure(t *testing.T) {
+	events := []corev1.Event{
+		probeEvent("app", "Unhealthy", "Readiness probe failed: connection refused"),
+		probeEvent("app", "Unhealthy", "Liveness probe failed: timeout"),
+		probeEvent("app", "Unhealthy", "Readiness probe failed: HTTP probe failed with statuscode: 503"),
+		probeEvent("sidecar", "Unhealthy", "Readiness probe failed: sidecar"),
+	}
+	if got, want := ProbeFailure(events, "app", "Readiness"), "Readiness probe failed: HTTP probe failed with statuscode: 503"; got != want {
+		t.Errorf("ProbeFailure(Readiness) = %q, want %q", got, want)
+	}
+	if got := ProbeFailure(events, "app", "Startup"); got != "" {
+		t.Errorf("ProbeFailure(Startup) = %q, want none", got)
+	}
+}
+
+func unreadyPod(startedAt, readyChanged time.Time, probe bool) (*corev1.Pod, corev1.ContainerStatus) {
+	container := corev1.Container{Name: "app"}
+	if probe {
+		container.ReadinessProbe = &corev1.Probe{}
+	}
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{container}},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+			Type:               corev1.PodReady,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: v1.NewTime(readyChanged),
+		}}},
+	}
+	cs := corev1.ContainerStatus{
+		Name:  "app",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: v1.NewTime(startedAt)}},
+	}
+	return pod, cs
+}
+
+func TestUnreadySince(t *testing.T) {
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	changed := time.Now().Add(-5 * time.Minute).Truncate(time.Second)
+
+	pod, cs := unreadyPod(started, changed, true)
+	if got := UnreadySince(pod, cs); !got.Equal(changed) {
+		t.Errorf("UnreadySince = %v, want the Ready condition change %v", got, changed)
+	}
+
+	pod, cs = unreadyPod(started, started.Add(-time.Minute), true)
+	if got := UnreadySince(pod, cs); !got.Equal(started) {
+		t.Errorf("UnreadySince = %v, want the container start %v", got, started)
+	}
+
+	pod, cs = unreadyPod(started, changed, false)
+	if got := UnreadySince(pod, cs); !got.IsZero() {
+		t.Errorf("UnreadySince without a readiness probe = %v, want zero", got)
+	}
+
+	pod, cs = unreadyPod(started, changed, true)
+	cs.Ready = true
+	if got := UnreadySince(pod, cs); !got.IsZero() {
+		t.Errorf("UnreadySince for a ready container = %v, want zero", got)
+	}
+}
+
+func TestStuckUnready(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+	pod, cs := unreadyPod(started, time.Now().Add(-15*time.Minute), true)
+	if !StuckUnready(pod, cs, 10*time.Minute) {
+		t.Error("StuckUnready = false for a container unready for 15m with a 10m timeout")
+	}
+	if StuckUnready(pod, cs, 30*time.Minute) {
+		t.Error("StuckUnready = true before the timeout")
+	}
+	if StuckUnready(pod, cs, 0) {
+		t.Error("StuckUnready = true with the check disabled")
+	}
+}
@@ -0,0 +1,79 @@
+// Package notifier talks to the places incidents are delivered to: the
+// Slack Web API, paging tools and issue trackers. It knows their wire
+// formats and endpoints; what an incident says, and who gets it, is decided
+// by the caller.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Client sends JSON requests and decodes JSON answers.
+type Client struct {
+	// HTTP defaults to http.DefaultClient.
+	HTTP *http.Client
+	// Outbound sees every request body before it is sent, so it can be
+	// redacted and audited. Nil sends bodies unchanged.
+	Outbound func(target string, body []byte) []byte
+}
+
+// Request sends the payload as JSON, authenticated by auth, and returns the
+// decoded answer. Non-2xx answers are errors that quote the response.
+func (c *Client) Request(ctx context.Context, method, endpoint string, payload interface{}, auth func(*http.Request)) (map[string]interface{}, error) {
+	reqBody := &bytes.Buffer{}
+	if payload != nil {
+		jsonData, _ := json.Marshal(payload)
+		if c.Outbound != nil {
+			jsonData = c.Outbound(endpoint, jsonData)
+		}
+		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, truncate(string(respBody), 200))
+	}
+
+	var parsed map[string]interface{}
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &parsed); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c == nil || c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "... (truncated)"
+}
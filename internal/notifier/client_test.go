@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// request is what a test server received.
+type request struct {
+	Method, Path, Query string
+	Header              http.Header
+	Body                map[string]interface{}
+}
+
+// recorder starts a server that records each request and answers with
+// status and body.
+func recorder(t *testing.T, status int, body string) (*httptest.Server, *[]request) {
+	var got []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		req := request{Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.RawQuery, Header: r.Header}
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &req.Body); err != nil {
+				t.Errorf("request body is not JSON: %s", raw)
+			}
+		}
+		got = append(got, req)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestClientRequest(t *testing.T) {
+	srv, got := recorder(t, http.StatusCreated, `{"id": 42}`)
+	client := &Client{Outbound: func(target string, body []byte) []byte {
+		return []byte(strings.ReplaceAll(string(body), "hunter2", "[REDACTED]"))
+	}}
+
+	parsed, err := client.Request(context.Background(), "POST", srv.URL+"/issues", map[string]interface{}{"body": "password=hunter2"}, func(req *http.Request) {
+		req.Header.Set("Authorization", "token secret")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed["id"] != float64(42) {
+		t.Errorf("answer = %v, want id 42", parsed)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("server got %d requests, want 1", len(*got))
+	}
+	req := (*got)[0]
+	if req.Header.Get("Authorization") != "token secret" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", req.Header)
+	}
+	if req.Body["body"] != "password=[REDACTED]" {
+		t.Errorf("body = %v, want it redacted by Outbound", req.Body)
+	}
+}
+
+func TestClientRequestError(t *testing.T) {
+	srv, _ := recorder(t, http.StatusUnauthorized, `{"message": "Bad credentials"}`)
+	_, err := (&Client{}).Request(context.Background(), "GET", srv.URL+"/user", nil, func(*http.Request) {})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("error = %v, want the status and response quoted", err)
+	}
+}
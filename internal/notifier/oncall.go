@@ -0,0 +1,33 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const ONCALL_API = "https://alert.victorops.com/integrations/generic/20131114/alert"
+
+// OnCall sends alerts to Splunk On-Call (VictorOps) through the REST
+// endpoint integration. Alerts with the same entity_id fold into one
+// incident, which a RECOVERY message for the entity_id resolves.
+type OnCall struct {
+	// BaseURL defaults to ONCALL_API.
+	BaseURL    string
+	APIKey     string
+	RoutingKey string
+	Client     *Client
+}
+
+// Send posts one alert message; its message_type says whether it raises or
+// resolves the incident.
+func (o *OnCall) Send(ctx context.Context, alert map[string]interface{}) error {
+	base := ONCALL_API
+	if o.BaseURL != "" {
+		base = strings.TrimSuffix(o.BaseURL, "/")
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s", base, o.APIKey, o.RoutingKey)
+	_, err := o.Client.Request(ctx, "POST", endpoint, alert, func(req *http.Request) {})
+	return err
+}
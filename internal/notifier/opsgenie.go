@@ -0,0 +1,45 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const OPSGENIE_API = "https://api.opsgenie.com"
+
+// Opsgenie opens and closes alerts through the Opsgenie Alert API. Alerts
+// are addressed by their alias, so opening one again bumps the count of the
+// open alert instead of paging again.
+type Opsgenie struct {
+	// BaseURL defaults to OPSGENIE_API; the EU instance has its own.
+	BaseURL string
+	APIKey  string
+	Client  *Client
+}
+
+// Open creates the alert, or adds to the open one with the same alias.
+func (o *Opsgenie) Open(ctx context.Context, alert map[string]interface{}) error {
+	_, err := o.request(ctx, "/v2/alerts", alert)
+	return err
+}
+
+// Close closes the alert with the alias, adding the note to it.
+func (o *Opsgenie) Close(ctx context.Context, alias, note string) error {
+	_, err := o.request(ctx, "/v2/alerts/"+url.PathEscape(alias)+"/close?identifierType=alias", map[string]interface{}{
+		"source": "pod-analyzer",
+		"note":   note,
+	})
+	return err
+}
+
+func (o *Opsgenie) request(ctx context.Context, path string, payload interface{}) (map[string]interface{}, error) {
+	base := OPSGENIE_API
+	if o.BaseURL != "" {
+		base = strings.TrimSuffix(o.BaseURL, "/")
+	}
+	return o.Client.Request(ctx, "POST", base+path, payload, func(req *http.Request) {
+		req.Header.Set("Authorization", "GenieKey "+o.APIKey)
+	})
+}
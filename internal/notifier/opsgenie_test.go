@@ -0,0 +1,51 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestOpsgenie(t *testing.T) {
+	srv, got := recorder(t, http.StatusAccepted, `{"result": "Request will be processed"}`)
+	og := &Opsgenie{BaseURL: srv.URL + "/", APIKey: "key", Client: &Client{}}
+
+	ctx := context.Background()
+	if err := og.Open(ctx, map[string]interface{}{"alias": "shop/api", "message": "api is crash looping"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := og.Close(ctx, "shop/api", "recovered"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*got) != 2 {
+		t.Fatalf("server got %d requests, want 2", len(*got))
+	}
+	open, closed := (*got)[0], (*got)[1]
+	if open.Path != "/v2/alerts" || open.Body["alias"] != "shop/api" {
+		t.Errorf("open: %s %v", open.Path, open.Body)
+	}
+	if closed.Path != "/v2/alerts/shop%2Fapi/close" || closed.Query != "identifierType=alias" || closed.Body["note"] != "recovered" {
+		t.Errorf("close: %s?%s %v", closed.Path, closed.Query, closed.Body)
+	}
+	for _, req := range *got {
+		if req.Header.Get("Authorization") != "GenieKey key" {
+			t.Errorf("Authorization = %q", req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestOnCall(t *testing.T) {
+	srv, got := recorder(t, http.StatusOK, `{"result": "success", "entity_id": "shop/api"}`)
+	oc := &OnCall{BaseURL: srv.URL, APIKey: "key", RoutingKey: "platform", Client: &Client{}}
+
+	if err := oc.Send(context.Background(), map[string]interface{}{"message_type": "CRITICAL", "entity_id": "shop/api"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("server got %d requests, want 1", len(*got))
+	}
+	if req := (*got)[0]; req.Path != "/key/platform" || req.Body["message_type"] != "CRITICAL" {
+		t.Errorf("send: %s %v", req.Path, req.Body)
+	}
+}
@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const SLACK_API = "https://slack.com/api"
+
+// Slack calls methods of the Slack Web API with a bot token.
+type Slack struct {
+	// BaseURL defaults to SLACK_API.
+	BaseURL string
+	// HTTP defaults to http.DefaultClient.
+	HTTP *http.Client
+}
+
+// Call posts the JSON body to the method and returns the ts of the message
+// it posted or updated, if any. Slack answers failed calls with ok=false and
+// an error code, which is returned as the error.
+func (s *Slack) Call(ctx context.Context, token, method string, body []byte) (string, error) {
+	base := SLACK_API
+	if s.BaseURL != "" {
+		base = strings.TrimSuffix(s.BaseURL, "/")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/"+method, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := s.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("%s: %s", resp.Status, truncate(string(respBody), 200))
+	}
+	if !result.OK {
+		if result.Error == "" {
+			return "", errors.New("unknown_error")
+		}
+		return "", errors.New(result.Error)
+	}
+	return result.TS, nil
+}
@@ -0,0 +1,36 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestSlackCall(t *testing.T) {
+	srv, got := recorder(t, http.StatusOK, `{"ok": true, "ts": "1700000000.000100"}`)
+	slack := &Slack{BaseURL: srv.URL}
+
+	ts, err := slack.Call(context.Background(), "xoxb-token", "chat.postMessage", []byte(`{"channel": "#alerts", "text": "hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts != "1700000000.000100" {
+		t.Errorf("ts = %q", ts)
+	}
+	req := (*got)[0]
+	if req.Path != "/chat.postMessage" || req.Header.Get("Authorization") != "Bearer xoxb-token" || req.Body["channel"] != "#alerts" {
+		t.Errorf("request: %s %v %v", req.Path, req.Header, req.Body)
+	}
+}
+
+func TestSlackCallError(t *testing.T) {
+	srv, _ := recorder(t, http.StatusOK, `{"ok": false, "error": "channel_not_found"}`)
+	if _, err := (&Slack{BaseURL: srv.URL}).Call(context.Background(), "xoxb-token", "chat.postMessage", []byte(`{}`)); err == nil || err.Error() != "channel_not_found" {
+		t.Errorf("error = %v, want channel_not_found", err)
+	}
+
+	srv, _ = recorder(t, http.StatusBadGateway, `<html>Bad Gateway</html>`)
+	if _, err := (&Slack{BaseURL: srv.URL}).Call(context.Background(), "xoxb-token", "chat.postMessage", []byte(`{}`)); err == nil {
+		t.Error("Call succeeded on a non-JSON answer")
+	}
+}
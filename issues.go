@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/notifier"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	GITHUB_API   = "https://api.github.com"
+	ISSUES_KEY   = "issues.json"
+	ISSUE_EXPIRE = 30 * 24 * time.Hour
+)
+
+// trackedIssue is the tracker issue filed for a crash signature. The
+// trackers' search indexes lag behind, so recurrences close together would
+// otherwise each find nothing and open a duplicate.
+type trackedIssue struct {
+	GitHub  int       `json:"github,omitempty"`
+	Jira    string    `json:"jira,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+var (
+	issuesMu      sync.Mutex
+	trackedIssues = map[string]*trackedIssue{}
+)
+
+// loadIssues restores the issue mapping saved next to the Slack threads.
+func loadIssues(cm *corev1.ConfigMap) {
+	if cm.Data[ISSUES_KEY] == "" {
+		return
+	}
+	restored := map[string]*trackedIssue{}
+	if err := json.Unmarshal([]byte(cm.Data[ISSUES_KEY]), &restored); err != nil {
+		log.Printf("⚠️ Invalid tracker issues in ConfigMap %s: %v", cm.Name, err)
+		return
+	}
+	issuesMu.Lock()
+	trackedIssues = restored
+	issuesMu.Unlock()
+}
+
+func saveIssues(config *Config) {
+	name := config.Threads.ConfigMap
+	if name == "" || threadStore == nil || *dryRun || *readOnly {
+		return
+	}
+	issuesMu.Lock()
+	data, _ := json.Marshal(trackedIssues)
+	issuesMu.Unlock()
+
+	if err := storeInConfigMap(name, ISSUES_KEY, data); err != nil {
+		log.Printf("⚠️ Failed to save tracker issues to ConfigMap %s: %v", name, err)
+	}
+}
+
+// trackIssue returns the signature's mapping, creating it if needed. The
+// caller holds issuesMu.
+func trackIssue(signature string) *trackedIssue {
+	now := time.Now()
+	for sig, t := range trackedIssues {
+		if now.Sub(t.Updated) > ISSUE_EXPIRE {
+			delete(trackedIssues, sig)
+		}
+	}
+	t, ok := trackedIssues[signature]
+	if !ok {
+		t = &trackedIssue{}
+		trackedIssues[signature] = t
+	}
+	t.Updated = now
+	return t
+}
+
+// fileRecurringIssue opens or updates one tracker issue per crash signature
+// on every configured tracker and returns the issue links, and whether any
+// issue was newly opened. An open issue gets a comment when the crash
+// starts recurring again (comment), and otherwise only has its description
+// brought up to date, so a crash loop does not add a comment per restart.
+func fileRecurringIssue(config *Config, inc *Incident, recent []*Incident, comment bool) ([]string, bool) {
+	title := fmt.Sprintf("Recurring crash: %s/%s (%s)", inc.Namespace, inc.Workload, inc.Container)
+	body := issueBody(inc, recent)
+	if *dryRun {
+		fmt.Printf("----- [dry-run] issue %q\n%s\n", title, body)
+		return nil, false
+	}
+
+	// Held across the tracker calls, so concurrent recurrences of a
+	// signature wait for the first one's issue instead of opening their own.
+	issuesMu.Lock()
+	var before trackedIssue
+	if t := trackedIssues[inc.Signature]; t != nil {
+		before = *t
+	}
+	var links []string
+	opened := false
+	if os.Getenv("GITHUB_TOKEN") != "" && os.Getenv("GITHUB_REPO") != "" {
+		link, created, err := upsertGitHubIssue(inc.Signature, title, body, comment)
+		if err != nil {
+			log.Printf("❌ Failed to file GitHub issue for %s: %v", inc.Signature, err)
+		} else {
+			links = append(links, link)
+			opened = opened || created
+		}
+	}
+	if os.Getenv("JIRA_URL") != "" && os.Getenv("JIRA_PROJECT") != "" {
+		link, created, err := upsertJiraIssue(inc.Signature, title, body, comment)
+		if err != nil {
+			log.Printf("❌ Failed to file Jira issue for %s: %v", inc.Signature, err)
+		} else {
+			links = append(links, link)
+			opened = opened || created
+		}
+	}
+	after := trackedIssues[inc.Signature]
+	changed := after != nil && (after.GitHub != before.GitHub || after.Jira != before.Jira)
+	issuesMu.Unlock()
+
+	if changed {
+		saveIssues(config)
+	}
+	return links, opened
+}
+
+func issueBody(inc *Incident, recent []*Incident) string {
+	md := formatterFor(FORMAT_MARKDOWN)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Workload `%s/%s` (container `%s`) crashed %d times in the last %s.\n\n", inc.Namespace, inc.Workload, inc.Container, len(recent), cfg().IssueWindow.Duration)
+	b.WriteString(md.Header(viewOf(inc)) + "\n\n")
+	b.WriteString("### 🕘 Occurrences\n\n")
+	for _, i := range recent {
+		fmt.Fprintf(&b, "- %s `%s`\n", i.Time.Format("2006-01-02 15:04:05"), i.Pod)
+	}
+	fmt.Fprintf(&b, "\n%s\n\n", md.Section(analysisSection(truncate(inc.Analysis, 3000))))
+	fmt.Fprintf(&b, "pod-analyzer-signature: %s\n", inc.Signature)
+	return b.String()
+}
+
+// upsertGitHubIssue updates the signature's open issue, looked up in the
+// mapping first and by search otherwise, or opens one. The caller holds
+// issuesMu.
+func upsertGitHubIssue(signature, title, body string, comment bool) (string, bool, error) {
+	repo := os.Getenv("GITHUB_REPO")
+	var issue map[string]interface{}
+	if t := trackedIssues[signature]; t != nil && t.GitHub != 0 {
+		// A closed or deleted issue falls through to the search, and then to
+		// a new issue.
+		got, err := githubRequest("GET", fmt.Sprintf("/repos/%s/issues/%d", repo, t.GitHub), nil)
+		if state, _ := got["state"].(string); err == nil && state == "open" {
+			issue = got
+		}
+	}
+	if issue == nil {
+		query := url.QueryEscape(fmt.Sprintf(`repo:%s is:issue is:open "pod-analyzer-signature: %s"`, repo, signature))
+		found, err := githubRequest("GET", "/search/issues?q="+query, nil)
+		if err != nil {
+			return "", false, err
+		}
+		if items, _ := found["items"].([]interface{}); len(items) > 0 {
+			issue, _ = items[0].(map[string]interface{})
+		}
+	}
+
+	if issue != nil {
+		number, _ := issue["number"].(float64)
+		link, _ := issue["html_url"].(string)
+		trackIssue(signature).GitHub = int(number)
+		if !comment {
+			_, err := githubRequest("PATCH", fmt.Sprintf("/repos/%s/issues/%d", repo, int(number)), map[string]interface{}{
+				"body": body,
+			})
+			return link, false, err
+		}
+		_, err := githubRequest("POST", fmt.Sprintf("/repos/%s/issues/%d/comments", repo, int(number)), map[string]interface{}{
+			"body": body,
+		})
+		return link, false, err
+	}
+
+	created, err := githubRequest("POST", fmt.Sprintf("/repos/%s/issues", repo), map[string]interface{}{
+		"title":  title,
+		"body":   body,
+		"labels": []string{"pod-analyzer"},
+	})
+	if err != nil {
+		return "", false, err
+	}
+	number, _ := created["number"].(float64)
+	trackIssue(signature).GitHub = int(number)
+	link, _ := created["html_url"].(string)
+	return link, true, nil
+}
+
+func githubRequest(method, path string, payload interface{}) (map[string]interface{}, error) {
+	return trackerRequest(method, GITHUB_API+path, payload, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+os.Getenv("GITHUB_TOKEN"))
+		req.Header.Set("Accept", "application/vnd.github+json")
+	})
+}
+
+// upsertJiraIssue is upsertGitHubIssue for Jira. The caller holds issuesMu.
+func upsertJiraIssue(signature, title, body string, comment bool) (string, bool, error) {
+	label := "crash-" + signature
+	var key string
+	if t := trackedIssues[signature]; t != nil && t.Jira != "" {
+		got, err := jiraRequest("GET", "/rest/api/2/issue/"+t.Jira+"?fields=status", nil)
+		if err == nil && jiraStatusCategory(got) != "done" {
+			key = t.Jira
+		}
+	}
+	if key == "" {
+		jql := fmt.Sprintf(`project = "%s" AND labels = "%s" AND statusCategory != Done`, os.Getenv("JIRA_PROJECT"), label)
+		found, err := jiraRequest("GET", "/rest/api/2/search?fields=key&jql="+url.QueryEscape(jql), nil)
+		if err != nil {
+			return "", false, err
+		}
+		if issues, _ := found["issues"].([]interface{}); len(issues) > 0 {
+			issue, _ := issues[0].(map[string]interface{})
+			key, _ = issue["key"].(string)
+		}
+	}
+
+	if key != "" {
+		trackIssue(signature).Jira = key
+		if !comment {
+			_, err := jiraRequest("PUT", "/rest/api/2/issue/"+key, map[string]interface{}{
+				"fields": map[string]interface{}{"description": body},
+			})
+			return jiraBrowseURL(key), false, err
+		}
+		_, err := jiraRequest("POST", "/rest/api/2/issue/"+key+"/comment", map[string]interface{}{
+			"body": body,
+		})
+		return jiraBrowseURL(key), false, err
+	}
+
+	created, err := jiraRequest("POST", "/rest/api/2/issue", map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": os.Getenv("JIRA_PROJECT")},
+			"summary":     title,
+			"description": body,
+			"issuetype":   map[string]string{"name": "Bug"},
+			"labels":      []string{"pod-analyzer", label},
+		},
+	})
+	if err != nil {
+		return "", false, err
+	}
+	key, _ = created["key"].(string)
+	trackIssue(signature).Jira = key
+	return jiraBrowseURL(key), true, nil
+}
+
+func jiraStatusCategory(issue map[string]interface{}) string {
+	fields, _ := issue["fields"].(map[string]interface{})
+	status, _ := fields["status"].(map[string]interface{})
+	category, _ := status["statusCategory"].(map[string]interface{})
+	key, _ := category["key"].(string)
+	return key
+}
+
+func jiraRequest(method, path string, payload interface{}) (map[string]interface{}, error) {
+	return trackerRequest(method, strings.TrimSuffix(os.Getenv("JIRA_URL"), "/")+path, payload, func(req *http.Request) {
+		req.SetBasicAuth(os.Getenv("JIRA_USER"), os.Getenv("JIRA_API_TOKEN"))
+	})
+}
+
+func jiraBrowseURL(key string) string {
+	return strings.TrimSuffix(os.Getenv("JIRA_URL"), "/") + "/browse/" + key
+}
+
+// trackers sends the requests to issue trackers, paging tools and log
+// stores, through the redaction and audit of outbound().
+var trackers = &notifier.Client{Outbound: func(target string, body []byte) []byte {
+	return outbound("tracker", target, body)
+}}
+
+func trackerRequest(method, endpoint string, payload interface{}, auth func(*http.Request)) (map[string]interface{}, error) {
+	return trackers.Request(context.Background(), method, endpoint, payload, auth)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	"github.com/ghulevishal/pod-analyzer/internal/detector"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	JOB_FAILED_PODS = 3
+	JOB_HISTORY     = 10
+
+	JOB_PROMPT = `A Kubernetes Job failed (%s). Help me identify why the batch run failed and suggest a fix. Use the schedule and run history to tell a one-off failure from a recurring one, and consider backoffLimit and activeDeadlineSeconds if the job was cut short.
+
+Job:
+%s
+
+Run history:
+%s
+
+Events:
+%s
+
+Key errors and stack traces (extracted from the full logs):
+%s
+
+Logs of failed pods:
+%s`
+)
+
+// jobFailure returns the Failed condition of a job, if it has one.
+func jobFailure(job *batchv1.Job) *batchv1.JobCondition {
+	for i, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func analyzeJob(clientset kubernetes.Interface, dyn dynamic.Interface, job batchv1.Job) {
+	config := cfg().forNamespace(job.Namespace).forIncident(INCIDENT_JOB_FAILURE)
+	ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+	defer cancel()
+	ctx = withUsage(ctx, job.Namespace)
+	failure := jobFailure(&job)
+	namespace := job.Namespace
+
+	workload, cronJob := job.Name, ""
+	for _, ref := range job.OwnerReferences {
+		if ref.Kind == "CronJob" {
+			workload, cronJob = ref.Name, ref.Name
+		}
+	}
+
+	spec := fmt.Sprintf("name=%s completions=%d parallelism=%d backoffLimit=%d activeDeadlineSeconds=%s succeeded=%d failed=%d",
+		job.Name, derefInt32(job.Spec.Completions, 1), derefInt32(job.Spec.Parallelism, 1), derefInt32(job.Spec.BackoffLimit, 6),
+		formatOptionalSeconds(job.Spec.ActiveDeadlineSeconds), job.Status.Succeeded, job.Status.Failed)
+	history := "not part of a CronJob"
+	if cronJob != "" {
+		spec += "\n" + describeCronJob(ctx, clientset, namespace, cronJob)
+		history = cronJobHistory(ctx, clientset, namespace, cronJob)
+	}
+
+	events, err := podEvents(ctx, clientset, namespace, job.Name, failure.LastTransitionTime.Add(-config.EventLookback.Duration))
+	if err != nil {
+		log.Printf("⚠️ Failed to get events for job %s: %v", job.Name, err)
+	}
+
+	lc := config.logConfigFor(namespace)
+	logs, errorLines := prepareLogs(failedJobPodLogs(ctx, clientset, &job, lc), lc)
+
+	inc := &Incident{
+		ID:        fmt.Sprintf("%s-%s-%d", namespace, job.Name, failure.LastTransitionTime.Unix()),
+		Type:      INCIDENT_JOB_FAILURE,
+		Severity:  severityOf(INCIDENT_JOB_FAILURE),
+		Namespace: namespace,
+		Pod:       job.Name,
+		Workload:  workload,
+		Reason:    failure.Reason,
+		Signature: signatureOf(namespace, workload, failure.Reason),
+		Time:      failure.LastTransitionTime.Time,
+		Events:    events,
+		Logs:      logs,
+		Resources: spec,
+		Language:  config.languageFor(namespace, ruleFor(namespace).slackChannel(config)),
+	}
+	if silence(config, inc) {
+		recordIncident(inc)
+		publishIncident(ctx, dyn, inc)
+		return
+	}
+
+	eventStr := collector.FormatEvents(events)
+	overhead := estimateTokens(config.model(), fmt.Sprintf(JOB_PROMPT, failure.Reason, "", "", "", "", ""))
+	budgetSections(ctx, config, overhead, []promptSection{
+		{name: "job spec", text: &spec, weight: 1, keepHead: true},
+		{name: "run history", text: &history, weight: 1, keepHead: true},
+		{name: "events", text: &eventStr, weight: 2},
+		{name: "error lines and stack traces", text: &errorLines, weight: 3},
+		{name: "container logs", text: &logs, weight: 4},
+	})
+	prompt := fmt.Sprintf(JOB_PROMPT, failure.Reason, spec, history, eventStr, errorLines, logs) + languageInstruction(inc.Language)
+	analysis, err := callModel(ctx, config, prompt)
+	if err != nil {
+		log.Printf("❌ Failed to analyze job %s: %v", job.Name, err)
+		return
+	}
+
+	channel := config.channelFor(ruleFor(namespace).slackChannel(config))
+	summary := "*💥 Job Failed!*\n" +
+		fmt.Sprintf("> *Job:* `%s`\n", job.Name) +
+		fmt.Sprintf("> *Namespace:* `%s`\n", namespace) +
+		fmt.Sprintf("> *Reason:* `%s` — %s\n", failure.Reason, failure.Message)
+	if cronJob != "" {
+		summary += fmt.Sprintf("> *CronJob:* `%s`\n", cronJob)
+	}
+	summary += fmt.Sprintf("> *Failed At:* `%s`", failure.LastTransitionTime.Format("2006-01-02 15:04:05"))
+	threadTS := postToSlack(map[string]interface{}{"channel": channel, "text": summary})
+	if threadTS != "" {
+		slack := localized(formatterFor(FORMAT_MRKDWN), inc.Language)
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🗓️", Title: "Job & schedule", Body: spec}))
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🕘", Title: "Run history", Body: history}))
+		sendSlackThread(channel, threadTS, slack.Section(eventsSection(events)))
+		sendSlackThread(channel, threadTS, slack.Section(logsSection(logs)))
+		sendSlackThread(channel, threadTS, slack.Section(analysisSection(analysis)))
+	}
+
+	inc.Analysis, inc.ThreadTS = analysis, threadTS
+	inc.PromptTokens, inc.ResponseTokens = usageOf(ctx)
+	recordIncident(inc)
+	publishIncident(ctx, dyn, inc)
+	notify(config, inc)
+}
+
+func failedJobPodLogs(ctx context.Context, clientset kubernetes.Interface, job *batchv1.Job, lc LogConfig) string {
+	ctx, cancel := within(ctx, cfg().Timeouts.Logs)
+	defer cancel()
+	selector, err := v1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return ""
+	}
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, v1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		log.Printf("⚠️ Failed to list pods of job %s: %v", job.Name, err)
+		return ""
+	}
+
+	var failed []corev1.Pod
+	for _, p := range pods.Items {
+		if p.Status.Phase == corev1.PodFailed {
+			failed = append(failed, p)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].CreationTimestamp.After(failed[j].CreationTimestamp.Time)
+	})
+	if len(failed) > JOB_FAILED_PODS {
+		failed = failed[:JOB_FAILED_PODS]
+	}
+
+	var sections []string
+	for _, p := range failed {
+		if len(p.Spec.Containers) > 0 {
+			finished := time.Now()
+			for _, cs := range p.Status.ContainerStatuses {
+				if t := detector.LastTermination(cs); t != nil && !t.FinishedAt.IsZero() {
+					finished = t.FinishedAt.Time
+				}
+			}
+			if logs := sourceLogs(ctx, cfg(), job.Namespace, p.Name, p.Spec.Containers[0].Name, finished, lc); logs != "" {
+				sections = append(sections, fmt.Sprintf("--- %s ---\n%s", p.Name, logs))
+				continue
+			}
+		}
+		if !allowed(job.Namespace, "get", "pods/log") {
+			sections = append(sections, fmt.Sprintf("--- %s ---\n(logs skipped: the service account may not get pods/log)", p.Name))
+			continue
+		}
+		logs, err := clientset.CoreV1().Pods(job.Namespace).GetLogs(p.Name, lc.options("", false)).DoRaw(ctx)
+		if err != nil {
+			logs = []byte(fmt.Sprintf("(logs unavailable: %v)", err))
+		}
+		sections = append(sections, fmt.Sprintf("--- %s ---\n%s", p.Name, string(logs)))
+	}
+	return strings.Join(sections, "\n")
+}
+
+func describeCronJob(ctx context.Context, clientset kubernetes.Interface, namespace, name string) string {
+	cj, err := clientset.BatchV1().CronJobs(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return fmt.Sprintf("cronjob %s: %v", name, err)
+	}
+	s := fmt.Sprintf("cronjob=%s schedule=%q concurrencyPolicy=%s suspended=%t", name, cj.Spec.Schedule, cj.Spec.ConcurrencyPolicy, cj.Spec.Suspend != nil && *cj.Spec.Suspend)
+	if cj.Spec.TimeZone != nil {
+		s += " timeZone=" + *cj.Spec.TimeZone
+	}
+	if cj.Status.LastSuccessfulTime != nil {
+		s += " lastSuccess=" + cj.Status.LastSuccessfulTime.Format("2006-01-02 15:04:05")
+	}
+	return s
+}
+
+// cronJobHistory lists the most recent runs still kept by the CronJob,
+// newest first.
+func cronJobHistory(ctx context.Context, clientset kubernetes.Interface, namespace, cronJob string) string {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Sprintf("unavailable: %v", err)
+	}
+
+	var runs []batchv1.Job
+	for _, j := range jobs.Items {
+		for _, ref := range j.OwnerReferences {
+			if ref.Kind == "CronJob" && ref.Name == cronJob {
+				runs = append(runs, j)
+			}
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreationTimestamp.After(runs[j].CreationTimestamp.Time)
+	})
+	if len(runs) > JOB_HISTORY {
+		runs = runs[:JOB_HISTORY]
+	}
+
+	var lines []string
+	for _, j := range runs {
+		status := "running"
+		if f := jobFailure(&j); f != nil {
+			status = "failed (" + f.Reason + ")"
+		} else if j.Status.CompletionTime != nil {
+			status = fmt.Sprintf("succeeded in %s", j.Status.CompletionTime.Sub(j.CreationTimestamp.Time).Round(time.Second))
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s", j.CreationTimestamp.Format("2006-01-02 15:04"), j.Name, status))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func derefInt32(p *int32, def int32) int32 {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+func formatOptionalSeconds(p *int64) string {
+	if p == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%ds", *p)
+}
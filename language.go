@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// languageNames maps the language codes accepted in the config to the name
+// the model is asked to write in. Other values are passed to the model as
+// they are, with the fixed message strings left in English.
+var languageNames = map[string]string{
+	"en": "English",
+	"ja": "Japanese",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"pt": "Portuguese",
+	"it": "Italian",
+	"nl": "Dutch",
+	"ko": "Korean",
+	"zh": "Chinese",
+}
+
+// translations localizes the fixed strings of Slack messages: incident
+// titles, field labels, section titles and the follow-up messages. Strings
+// missing here stay in English.
+var translations = map[string]map[string]string{
+	"ja": {
+		"Pod Restart Detected":            "Podの再起動を検知",
+		"Liveness/Readiness Probe Failed": "Liveness/Readinessプローブの失敗を検知",
+		"Container Failed to Start":       "コンテナの起動に失敗",
+		"Pod Evicted":                     "Podが退避されました",
+		"Job Failed":                      "Jobが失敗しました",
+		"Workload Flapping":               "ワークロードが再起動を繰り返しています",
+		"Node NotReady":                   "ノードがNotReady",
+		"Kubelet Restarted":               "kubeletが再起動しました",
+		"Pod Admission Denied":            "Podのアドミッションが拒否されました",
+
+		"Node":               "ノード",
+		"Controller":         "コントローラー",
+		"Restart Time":       "再起動時刻",
+		"Detected At":        "検知時刻",
+		"Last Restart":       "最終再起動",
+		"Failed At":          "失敗時刻",
+		"Workload":           "ワークロード",
+		"Reason":             "理由",
+		"Diagnosis":          "診断",
+		"Needs human review": "人による確認が必要",
+		"Recent change":      "直近の変更",
+		"Delivery":           "デリバリー",
+		"Runbook":            "ランブック",
+		"Autoscaling":        "オートスケーリング",
+		"Registry":           "レジストリ",
+		"Ongoing":            "継続中",
+
+		"Events":                "イベント",
+		"Resources":             "リソース",
+		"Logs":                  "ログ",
+		"Analysis":              "分析",
+		"Probes":                "プローブ",
+		"Storage":               "ストレージ",
+		"Network":               "ネットワーク",
+		"Healthy replica":       "正常なレプリカ",
+		"Autoscaler":            "オートスケーラー",
+		"Context":               "コンテキスト",
+		"Denial":                "拒否内容",
+		"Pod template security": "Podテンプレートのセキュリティ設定",
+		"Job & schedule":        "Jobとスケジュール",
+		"Run history":           "実行履歴",
+		"Evicted pods":          "退避されたPod",
+		"Node conditions":       "ノードの状態",
+		"Node events":           "ノードのイベント",
+		"Pods not ready":        "ReadyでないPod",
+		"(none)":                "(なし)",
+
+		"🔁 *Restarted again* at %s (restart count %d), updated analysis below.":    "🔁 *再び再起動しました* %s(再起動回数 %d)。更新した分析を以下に示します。",
+		"✅ *Resolved:* `%s` has been healthy for %s since the last failure at %s.": "✅ *解決:* `%s` は %s の間正常に稼働しています(最後の失敗: %s)。",
+	},
+	"de": {
+		"Pod Restart Detected":            "Pod-Neustart erkannt",
+		"Liveness/Readiness Probe Failed": "Liveness-/Readiness-Probe fehlgeschlagen",
+		"Container Failed to Start":       "Container konnte nicht starten",
+		"Pod Evicted":                     "Pod verdrängt",
+		"Job Failed":                      "Job fehlgeschlagen",
+		"Workload Flapping":               "Workload startet wiederholt neu",
+		"Kubelet Restarted":               "Kubelet neu gestartet",
+		"Pod Admission Denied":            "Pod-Admission abgelehnt",
+
+		"Restart Time":       "Neustartzeit",
+		"Detected At":        "Erkannt um",
+		"Last Restart":       "Letzter Neustart",
+		"Failed At":          "Fehlgeschlagen um",
+		"Reason":             "Grund",
+		"Diagnosis":          "Diagnose",
+		"Needs human review": "Manuelle Prüfung nötig",
+		"Recent change":      "Kürzliche Änderung",
+		"Delivery":           "Auslieferung",
+		"Ongoing":            "Andauernd",
+
+		"Events":                "Ereignisse",
+		"Resources":             "Ressourcen",
+		"Analysis":              "Analyse",
+		"Storage":               "Speicher",
+		"Network":               "Netzwerk",
+		"Healthy replica":       "Gesunde Replika",
+		"Context":               "Kontext",
+		"Denial":                "Ablehnung",
+		"Pod template security": "Sicherheitseinstellungen des Pod-Templates",
+		"Job & schedule":        "Job & Zeitplan",
+		"Run history":           "Ausführungsverlauf",
+		"Evicted pods":          "Verdrängte Pods",
+		"Node conditions":       "Node-Zustände",
+		"Node events":           "Node-Ereignisse",
+		"Pods not ready":        "Nicht bereite Pods",
+		"(none)":                "(keine)",
+
+		"🔁 *Restarted again* at %s (restart count %d), updated analysis below.":    "🔁 *Erneut neu gestartet* um %s (Neustartzähler %d), aktualisierte Analyse unten.",
+		"✅ *Resolved:* `%s` has been healthy for %s since the last failure at %s.": "✅ *Behoben:* `%s` läuft seit %s stabil, letzter Fehler um %s.",
+	},
+	"fr": {
+		"Pod Restart Detected":            "Redémarrage de pod détecté",
+		"Liveness/Readiness Probe Failed": "Échec de la sonde liveness/readiness",
+		"Container Failed to Start":       "Échec du démarrage du conteneur",
+		"Pod Evicted":                     "Pod évincé",
+		"Job Failed":                      "Échec du job",
+		"Workload Flapping":               "Workload instable (redémarrages répétés)",
+		"Node NotReady":                   "Nœud NotReady",
+		"Kubelet Restarted":               "Kubelet redémarré",
+		"Pod Admission Denied":            "Admission du pod refusée",
+
+		"Node":               "Nœud",
+		"Controller":         "Contrôleur",
+		"Restart Time":       "Heure du redémarrage",
+		"Detected At":        "Détecté à",
+		"Last Restart":       "Dernier redémarrage",
+		"Failed At":          "Échec à",
+		"Reason":             "Raison",
+		"Diagnosis":          "Diagnostic",
+		"Needs human review": "Vérification humaine requise",
+		"Recent change":      "Changement récent",
+		"Delivery":           "Déploiement",
+		"Runbook":            "Procédure",
+		"Registry":           "Registre",
+		"Ongoing":            "En cours",
+
+		"Events":                "Événements",
+		"Resources":             "Ressources",
+		"Logs":                  "Journaux",
+		"Analysis":              "Analyse",
+		"Probes":                "Sondes",
+		"Storage":               "Stockage",
+		"Network":               "Réseau",
+		"Healthy replica":       "Réplica saine",
+		"Context":               "Contexte",
+		"Denial":                "Refus",
+		"Pod template security": "Sécurité du modèle de pod",
+		"Job & schedule":        "Job et planification",
+		"Run history":           "Historique des exécutions",
+		"Evicted pods":          "Pods évincés",
+		"Node conditions":       "État du nœud",
+		"Node events":           "Événements du nœud",
+		"Pods not ready":        "Pods non prêts",
+		"(none)":                "(aucun)",
+
+		"🔁 *Restarted again* at %s (restart count %d), updated analysis below.":    "🔁 *Nouveau redémarrage* à %s (nombre de redémarrages %d), analyse mise à jour ci-dessous.",
+		"✅ *Resolved:* `%s` has been healthy for %s since the last failure at %s.": "✅ *Résolu :* `%s` est sain depuis %s, dernier échec à %s.",
+	},
+	"es": {
+		"Pod Restart Detected":            "Reinicio de pod detectado",
+		"Liveness/Readiness Probe Failed": "Fallo de la sonda liveness/readiness",
+		"Container Failed to Start":       "El contenedor no pudo iniciarse",
+		"Pod Evicted":                     "Pod desalojado",
+		"Job Failed":                      "Job fallido",
+		"Workload Flapping":               "Workload inestable (reinicios repetidos)",
+		"Node NotReady":                   "Nodo NotReady",
+		"Kubelet Restarted":               "Kubelet reiniciado",
+		"Pod Admission Denied":            "Admisión del pod denegada",
+
+		"Node":               "Nodo",
+		"Controller":         "Controlador",
+		"Restart Time":       "Hora del reinicio",
+		"Detected At":        "Detectado a las",
+		"Last Restart":       "Último reinicio",
+		"Failed At":          "Falló a las",
+		"Reason":             "Motivo",
+		"Diagnosis":          "Diagnóstico",
+		"Needs human review": "Requiere revisión humana",
+		"Recent change":      "Cambio reciente",
+		"Delivery":           "Despliegue",
+		"Runbook":            "Procedimiento",
+		"Autoscaling":        "Autoescalado",
+		"Registry":           "Registro",
+		"Ongoing":            "En curso",
+
+		"Events":                "Eventos",
+		"Resources":             "Recursos",
+		"Analysis":              "Análisis",
+		"Probes":                "Sondas",
+		"Storage":               "Almacenamiento",
+		"Network":               "Red",
+		"Healthy replica":       "Réplica sana",
+		"Context":               "Contexto",
+		"Denial":                "Denegación",
+		"Pod template security": "Seguridad de la plantilla del pod",
+		"Job & schedule":        "Job y programación",
+		"Run history":           "Historial de ejecuciones",
+		"Evicted pods":          "Pods desalojados",
+		"Node conditions":       "Condiciones del nodo",
+		"Node events":           "Eventos del nodo",
+		"Pods not ready":        "Pods no listos",
+		"(none)":                "(ninguno)",
+
+		"🔁 *Restarted again* at %s (restart count %d), updated analysis below.":    "🔁 *Reiniciado de nuevo* a las %s (contador de reinicios %d), análisis actualizado abajo.",
+		"✅ *Resolved:* `%s` has been healthy for %s since the last failure at %s.": "✅ *Resuelto:* `%s` lleva %s estable, último fallo a las %s.",
+	},
+}
+
+// languageFor picks the output language for a namespace's alerts: its
+// PodAnalyzerRule, then `languages` by namespace, then by Slack channel,
+// then the global `language`. "" means English.
+func (c *Config) languageFor(namespace, channel string) string {
+	if r := ruleFor(namespace); r != nil && r.Language != "" {
+		return r.Language
+	}
+	if l := c.Languages[namespace]; l != "" {
+		return l
+	}
+	if l := c.Languages[channel]; l != "" {
+		return l
+	}
+	return c.Language
+}
+
+func languageName(lang string) string {
+	if name, ok := languageNames[strings.ToLower(lang)]; ok {
+		return name
+	}
+	return lang
+}
+
+// promptLanguage is the language the model is asked to answer in, or "" to
+// leave the prompt as it is for English.
+func promptLanguage(lang string) string {
+	if lang == "" || languageName(lang) == "English" {
+		return ""
+	}
+	return languageName(lang)
+}
+
+// languageInstruction is appended to prompts that are not templated, so
+// their answer follows the configured language too.
+func languageInstruction(lang string) string {
+	if promptLanguage(lang) == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\nWrite your entire answer in %s. Keep Kubernetes object names, field names, commands and log lines as they are.", promptLanguage(lang))
+}
+
+func translate(lang, s string) string {
+	if t, ok := translations[strings.ToLower(lang)][s]; ok {
+		return t
+	}
+	return s
+}
+
+// localizedFormatter renders through another formatter with the fixed
+// strings of the view translated.
+type localizedFormatter struct {
+	Formatter
+	lang string
+}
+
+func localized(f Formatter, lang string) Formatter {
+	if translations[strings.ToLower(lang)] == nil {
+		return f
+	}
+	return localizedFormatter{Formatter: f, lang: lang}
+}
+
+func (f localizedFormatter) Header(v *incidentView) string {
+	return f.Formatter.Header(f.view(v))
+}
+
+func (f localizedFormatter) Section(s viewSection) string {
+	return f.Formatter.Section(f.section(s))
+}
+
+func (f localizedFormatter) Document(v *incidentView) string {
+	return f.Formatter.Document(f.view(v))
+}
+
+func (f localizedFormatter) view(v *incidentView) *incidentView {
+	copied := *v
+	copied.Title = translate(f.lang, v.Title)
+	copied.Fields = make([]viewField, len(v.Fields))
+	for i, field := range v.Fields {
+		field.Label = translate(f.lang, field.Label)
+		copied.Fields[i] = field
+	}
+	copied.Sections = make([]viewSection, len(v.Sections))
+	for i, s := range v.Sections {
+		copied.Sections[i] = f.section(s)
+	}
+	return &copied
+}
+
+func (f localizedFormatter) section(s viewSection) viewSection {
+	s.Title = translate(f.lang, s.Title)
+	if strings.TrimSpace(s.Body) == "" && len(s.Rows) <= 1 {
+		s.Body = translate(f.lang, "(none)")
+	}
+	return s
+}
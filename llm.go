@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+)
+
+const (
+	PROVIDER_OLLAMA = "ollama"
+	PROVIDER_OPENAI = "openai"
+
+	OPENAI_API   = "https://api.openai.com/v1/chat/completions"
+	OPENAI_MODEL = "gpt-4o-mini"
+
+	ANALYSIS_FUNCTION = "report_analysis"
+)
+
+// ModelParams are passed to the model as-is; unset values keep the
+// provider's defaults.
+type ModelParams struct {
+	Temperature  *float64 `json:"temperature"`
+	TopP         *float64 `json:"topP"`
+	MaxTokens    int      `json:"maxTokens"`
+	SystemPrompt string   `json:"systemPrompt"`
+}
+
+func (c *Config) model() string {
+	if c.Provider == PROVIDER_OPENAI {
+		return c.OpenAIModel
+	}
+	return c.OllamaModel
+}
+
+// forIncident returns the config to analyze an incident type with: a copy
+// using the model incidentModels maps the type to, or the config itself.
+func (c *Config) forIncident(incidentType string) *Config {
+	model := c.IncidentModels[incidentType]
+	if model == "" {
+		return c
+	}
+	copied := *c
+	if c.Provider == PROVIDER_OPENAI {
+		copied.OpenAIModel = model
+	} else {
+		copied.OllamaModel = model
+	}
+	return &copied
+}
+
+// ModelClient is a model provider. Every prompt goes through one, so a fake
+// can stand in for the model.
+type ModelClient interface {
+	// Complete returns the plain-text answer to a prompt.
+	Complete(ctx context.Context, config *Config, prompt string) (string, error)
+	// CompleteStructured returns the answer as the JSON of AnalysisSchema,
+	// or as text if the model ignored the schema.
+	CompleteStructured(ctx context.Context, config *Config, prompt string) (string, error)
+}
+
+type ollamaClient struct{}
+
+func (ollamaClient) Complete(ctx context.Context, config *Config, prompt string) (string, error) {
+	return callOllama(ctx, config, prompt, nil)
+}
+
+func (ollamaClient) CompleteStructured(ctx context.Context, config *Config, prompt string) (string, error) {
+	return callOllama(ctx, config, prompt, analyzer.AnalysisSchema)
+}
+
+type openAIClient struct{}
+
+func (openAIClient) Complete(ctx context.Context, config *Config, prompt string) (string, error) {
+	message, err := callOpenAI(ctx, config, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	return message.Content, nil
+}
+
+func (openAIClient) CompleteStructured(ctx context.Context, config *Config, prompt string) (string, error) {
+	message, err := callOpenAI(ctx, config, prompt, true)
+	if err != nil {
+		return "", err
+	}
+	if len(message.ToolCalls) > 0 {
+		return message.ToolCalls[0].Function.Arguments, nil
+	}
+	return message.Content, nil
+}
+
+// modelOverride replaces the configured provider when set, e.g. with
+// --fake-model.
+var modelOverride ModelClient
+
+func modelClient(config *Config) ModelClient {
+	var client ModelClient = ollamaClient{}
+	switch {
+	case modelOverride != nil:
+		client = modelOverride
+	case config.Provider == PROVIDER_OPENAI:
+		client = openAIClient{}
+	}
+	return observedModel{client}
+}
+
+// callModel sends a prompt to the configured provider and returns the
+// plain-text answer.
+func callModel(ctx context.Context, config *Config, prompt string) (string, error) {
+	return modelClient(config).Complete(ctx, config, prompt)
+}
+
+// analyzeWithModel returns the analysis text and, with structuredOutput
+// enabled, the fields it was rendered from. A model that ignores the schema
+// still yields its raw answer as text.
+func analyzeWithModel(ctx context.Context, config *Config, prompt string) (string, *analyzer.StructuredAnalysis, error) {
+	if !config.StructuredOutput {
+		text, err := callModel(ctx, config, prompt)
+		return text, nil, err
+	}
+
+	raw, err := modelClient(config).CompleteStructured(ctx, config, prompt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s := analyzer.ParseStructured(raw)
+	if s == nil {
+		return raw, nil, nil
+	}
+	return s.Text(), s, nil
+}
+
+type chatMessage struct {
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// callOpenAI talks to any OpenAI-compatible chat completions endpoint. The
+// key is read from OPENAI_API_KEY; local servers that need none can leave it
+// unset.
+func callOpenAI(ctx context.Context, config *Config, prompt string, structured bool) (*chatMessage, error) {
+	if err := checkTokenBudget(config); err != nil {
+		return nil, err
+	}
+	messages := []map[string]string{{"role": "user", "content": prompt}}
+	if system := config.ModelParams.SystemPrompt; system != "" {
+		messages = append([]map[string]string{{"role": "system", "content": system}}, messages...)
+	}
+	body := map[string]interface{}{
+		"model":      config.OpenAIModel,
+		"messages":   messages,
+		"max_tokens": config.responseTokens(),
+	}
+	if config.ModelParams.Temperature != nil {
+		body["temperature"] = *config.ModelParams.Temperature
+	}
+	if config.ModelParams.TopP != nil {
+		body["top_p"] = *config.ModelParams.TopP
+	}
+	if structured {
+		body["tools"] = []interface{}{map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        ANALYSIS_FUNCTION,
+				"description": "Report the root-cause analysis of the Kubernetes incident.",
+				"parameters":  analyzer.AnalysisSchema,
+			},
+		}}
+		body["tool_choice"] = map[string]interface{}{"type": "function", "function": map[string]string{"name": ANALYSIS_FUNCTION}}
+	}
+	jsonData, _ := json.Marshal(body)
+	jsonData = outbound("model", config.OpenAIAPI, jsonData)
+
+	ctx, cancel := within(ctx, config.Timeouts.Model)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", config.OpenAIAPI, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := config.openAIKey(); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, truncate(string(respBody), 200))
+	}
+
+	var parsed struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, err
+	}
+	answer := ""
+	if len(parsed.Choices) > 0 {
+		answer = parsed.Choices[0].Message.Content
+		for _, call := range parsed.Choices[0].Message.ToolCalls {
+			answer += call.Function.Arguments
+		}
+	}
+	recordUsage(ctx, config, prompt, answer, parsed.Usage.PromptTokens, parsed.Usage.CompletionTokens)
+	if len(parsed.Choices) == 0 {
+		return &chatMessage{Content: "No response from model"}, nil
+	}
+	return &parsed.Choices[0].Message, nil
+}
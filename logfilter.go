@@ -0,0 +1,16 @@
+package main
+
+import "github.com/ghulevishal/pod-analyzer/internal/collector"
+
+// prepareLogs splits the log budget between the extracted errors and the
+// truncated raw logs, so stack traces far above the tail still reach the
+// model.
+func prepareLogs(raw string, lc LogConfig) (string, string) {
+	patterns := lc.errorPatterns()
+	errors := collector.ExtractErrors(raw, patterns, lc.MaxBytes/3)
+	budget := lc.MaxBytes
+	if budget > 0 {
+		budget -= len(errors)
+	}
+	return collector.SmartTruncate(raw, budget, patterns), errors
+}
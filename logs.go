@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	LOG_MAX_BYTES       = 12000
+	DEFAULT_ERROR_REGEX = `(?i)\b(error|err|exception|fatal|panic|fail(ed|ure)?|traceback|oom|killed|refused|timeout)\b`
+)
+
+type LogConfig struct {
+	TailLines     int64    `json:"tailLines"`
+	SinceSeconds  int64    `json:"sinceSeconds"`
+	AllContainers *bool    `json:"allContainers"`
+	MaxBytes      int      `json:"maxBytes"`
+	ErrorPatterns []string `json:"errorPatterns"`
+}
+
+// logConfigFor applies the namespace override on top of the global log
+// settings; unset fields keep the global value.
+func (c *Config) logConfigFor(namespace string) LogConfig {
+	lc := c.Logs
+	if o, ok := c.NamespaceLogs[namespace]; ok {
+		if o.TailLines > 0 {
+			lc.TailLines = o.TailLines
+		}
+		if o.SinceSeconds > 0 {
+			lc.SinceSeconds = o.SinceSeconds
+		}
+		if o.AllContainers != nil {
+			lc.AllContainers = o.AllContainers
+		}
+		if o.MaxBytes > 0 {
+			lc.MaxBytes = o.MaxBytes
+		}
+		if len(o.ErrorPatterns) > 0 {
+			lc.ErrorPatterns = o.ErrorPatterns
+		}
+	}
+	return lc
+}
+
+func (lc LogConfig) options(container string, previous bool) *corev1.PodLogOptions {
+	opts := &corev1.PodLogOptions{Container: container, Previous: previous}
+	if lc.TailLines > 0 {
+		opts.TailLines = int64Ptr(lc.TailLines)
+	}
+	if lc.SinceSeconds > 0 {
+		opts.SinceSeconds = int64Ptr(lc.SinceSeconds)
+	}
+	return opts
+}
+
+func (lc LogConfig) errorPatterns() []*regexp.Regexp {
+	patterns := lc.ErrorPatterns
+	if len(patterns) == 0 {
+		patterns = []string{DEFAULT_ERROR_REGEX}
+	}
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+	return compiled
+}
+
+// collectLogs fetches the output of the crashed container's previous
+// instance (what it printed before dying) and, if configured, the current
+// logs of every other container in the pod. A configured log store is asked
+// first for the crashed container, since it keeps what the kubelet has
+// already rotated away.
+func collectLogs(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, crashed string, crash time.Time, lc LogConfig) string {
+	ctx, cancel := within(ctx, cfg().Timeouts.Logs)
+	defer cancel()
+	fetch := func(container string, previous bool) (string, error) {
+		if !allowed(pod.Namespace, "get", "pods/log") {
+			return "", fmt.Errorf("the service account may not get pods/log")
+		}
+		return collector.ContainerLogs(ctx, clientset, pod.Namespace, pod.Name, lc.options(container, previous))
+	}
+
+	var sections []string
+	out := sourceLogs(ctx, cfg(), pod.Namespace, pod.Name, crashed, crash, lc)
+	if out == "" {
+		var err error
+		out, err = fetch(crashed, true)
+		if err != nil {
+			out, err = fetch(crashed, false)
+		}
+		if err != nil {
+			out = fmt.Sprintf("(logs unavailable: %v)", err)
+		}
+	}
+	sections = append(sections, out)
+
+	if lc.AllContainers != nil && *lc.AllContainers {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == crashed {
+				continue
+			}
+			other, err := fetch(c.Name, false)
+			if err != nil {
+				other = fmt.Sprintf("(logs unavailable: %v)", err)
+			}
+			sections = append(sections, fmt.Sprintf("--- container %s ---\n%s", c.Name, other))
+		}
+	}
+	return strings.Join(sections, "\n")
+}
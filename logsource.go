@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	LOG_SOURCE_KUBERNETES    = "kubernetes"
+	LOG_SOURCE_LOKI          = "loki"
+	LOG_SOURCE_ELASTICSEARCH = "elasticsearch"
+
+	LOG_SOURCE_LOOKBACK = 15 * time.Minute
+	LOKI_QUERY          = `{namespace="$namespace", pod="$pod", container="$container"}`
+	ELASTICSEARCH_INDEX = "logs-*"
+)
+
+// LogSource fetches a container's logs for a time range from a log store
+// that outlives the pod, unlike pods/log.
+type LogSource interface {
+	Name() string
+	Logs(ctx context.Context, namespace, pod, container string, from, to time.Time, limit int) (string, error)
+}
+
+// LogSourceConfig selects where logs come from. The API server is the
+// default; with Loki or Elasticsearch configured it is only used when the
+// store has nothing for the container.
+type LogSourceConfig struct {
+	Type     string            `json:"type"`
+	URL      string            `json:"url"`
+	Lookback v1.Duration       `json:"lookback"`
+	Tenant   string            `json:"tenant"`
+	Query    string            `json:"query"`
+	Index    string            `json:"index"`
+	Fields   ElasticsearchKeys `json:"fields"`
+}
+
+// ElasticsearchKeys are the document fields logs are matched and read by;
+// the defaults follow Filebeat's ECS layout.
+type ElasticsearchKeys struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+func logSource(config *Config) LogSource {
+	lsc := config.LogSource
+	switch lsc.Type {
+	case LOG_SOURCE_LOKI:
+		if lsc.Query == "" {
+			lsc.Query = LOKI_QUERY
+		}
+		return &LokiSource{config: lsc}
+	case LOG_SOURCE_ELASTICSEARCH:
+		if lsc.Index == "" {
+			lsc.Index = ELASTICSEARCH_INDEX
+		}
+		return &ElasticsearchSource{config: lsc, fields: lsc.Fields.withDefaults()}
+	}
+	return nil
+}
+
+// sourceLogs reads the container's logs from the configured log store for
+// the lookback window before the crash. It returns "" if no store is
+// configured or it has nothing, so callers fall back to pods/log.
+func sourceLogs(ctx context.Context, config *Config, namespace, pod, container string, crash time.Time, lc LogConfig) string {
+	source := logSource(config)
+	if source == nil {
+		return ""
+	}
+	lookback := config.LogSource.Lookback.Duration
+	if lookback <= 0 {
+		lookback = LOG_SOURCE_LOOKBACK
+	}
+	limit := int(lc.TailLines)
+	if limit <= 0 {
+		limit = LOG_LINES
+	}
+	logs, err := source.Logs(ctx, namespace, pod, container, crash.Add(-lookback), crash.Add(time.Minute), limit)
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch logs of %s/%s from %s, using the API server: %v", namespace, pod, source.Name(), err)
+		return ""
+	}
+	return logs
+}
+
+// logSourceAuth sets a bearer token from LOG_SOURCE_TOKEN, or basic auth
+// from LOG_SOURCE_USERNAME and LOG_SOURCE_PASSWORD.
+func logSourceAuth(req *http.Request) {
+	if token := os.Getenv("LOG_SOURCE_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if user := os.Getenv("LOG_SOURCE_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("LOG_SOURCE_PASSWORD"))
+	}
+}
+
+type LokiSource struct {
+	config LogSourceConfig
+}
+
+func (l *LokiSource) Name() string { return "Loki" }
+
+func (l *LokiSource) Logs(ctx context.Context, namespace, pod, container string, from, to time.Time, limit int) (string, error) {
+	query := strings.NewReplacer("$namespace", namespace, "$pod", pod, "$container", container).Replace(l.config.Query)
+	params := url.Values{
+		"query":     {query},
+		"start":     {strconv.FormatInt(from.UnixNano(), 10)},
+		"end":       {strconv.FormatInt(to.UnixNano(), 10)},
+		"limit":     {strconv.Itoa(limit)},
+		"direction": {"backward"},
+	}
+	endpoint := strings.TrimSuffix(l.config.URL, "/") + "/loki/api/v1/query_range?" + params.Encode()
+	resp, err := trackers.Request(ctx, "GET", endpoint, nil, func(req *http.Request) {
+		logSourceAuth(req)
+		if l.config.Tenant != "" {
+			req.Header.Set("X-Scope-OrgID", l.config.Tenant)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	type entry struct {
+		ts   int64
+		line string
+	}
+	var entries []entry
+	data, _ := resp["data"].(map[string]interface{})
+	streams, _ := data["result"].([]interface{})
+	for _, s := range streams {
+		stream, _ := s.(map[string]interface{})
+		values, _ := stream["values"].([]interface{})
+		for _, v := range values {
+			pair, _ := v.([]interface{})
+			if len(pair) != 2 {
+				continue
+			}
+			ts, _ := pair[0].(string)
+			line, _ := pair[1].(string)
+			n, _ := strconv.ParseInt(ts, 10, 64)
+			entries = append(entries, entry{n, line})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ts < entries[j].ts })
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = strings.TrimRight(e.line, "\n")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type ElasticsearchSource struct {
+	config LogSourceConfig
+	fields ElasticsearchKeys
+}
+
+func (k ElasticsearchKeys) withDefaults() ElasticsearchKeys {
+	if k.Namespace == "" {
+		k.Namespace = "kubernetes.namespace"
+	}
+	if k.Pod == "" {
+		k.Pod = "kubernetes.pod.name"
+	}
+	if k.Container == "" {
+		k.Container = "kubernetes.container.name"
+	}
+	if k.Message == "" {
+		k.Message = "message"
+	}
+	if k.Timestamp == "" {
+		k.Timestamp = "@timestamp"
+	}
+	return k
+}
+
+func (e *ElasticsearchSource) Name() string { return "Elasticsearch" }
+
+func (e *ElasticsearchSource) Logs(ctx context.Context, namespace, pod, container string, from, to time.Time, limit int) (string, error) {
+	f := e.fields
+	query := map[string]interface{}{
+		"size": limit,
+		"sort": []interface{}{map[string]string{f.Timestamp: "desc"}},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"match_phrase": map[string]string{f.Namespace: namespace}},
+					map[string]interface{}{"match_phrase": map[string]string{f.Pod: pod}},
+					map[string]interface{}{"match_phrase": map[string]string{f.Container: container}},
+					map[string]interface{}{"range": map[string]interface{}{f.Timestamp: map[string]string{
+						"gte": from.UTC().Format(time.RFC3339),
+						"lte": to.UTC().Format(time.RFC3339),
+					}}},
+				},
+			},
+		},
+	}
+	endpoint := strings.TrimSuffix(e.config.URL, "/") + "/" + e.config.Index + "/_search"
+	resp, err := trackers.Request(ctx, "POST", endpoint, query, logSourceAuth)
+	if err != nil {
+		return "", err
+	}
+
+	hits, _ := resp["hits"].(map[string]interface{})
+	docs, _ := hits["hits"].([]interface{})
+	lines := make([]string, 0, len(docs))
+	for i := len(docs) - 1; i >= 0; i-- {
+		doc, _ := docs[i].(map[string]interface{})
+		source, _ := doc["_source"].(map[string]interface{})
+		if msg := fieldValue(source, f.Message); msg != "" {
+			lines = append(lines, strings.TrimRight(msg, "\n"))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// fieldValue reads a dotted field from a document, whether it is stored as
+// nested objects or under the literal dotted key.
+func fieldValue(doc map[string]interface{}, field string) string {
+	if v, ok := doc[field]; ok {
+		return fmt.Sprint(v)
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) == 2 {
+		if nested, ok := doc[parts[0]].(map[string]interface{}); ok {
+			return fieldValue(nested, parts[1])
+		}
+	}
+	return ""
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -13,8 +14,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	"github.com/ghulevishal/pod-analyzer/internal/detector"
+	"github.com/ghulevishal/pod-analyzer/internal/notifier"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -25,12 +30,25 @@ const (
 	OLLAMA_MODEL   = "llama3"
 	SLACK_CHANNEL  = "#all-vishal-personal"
 	CHECK_INTERVAL = 30 * time.Second
-	LOG_LINES      = 50
+	LOG_LINES      = 200
+
+	ISSUE_THRESHOLD = 3
+	ISSUE_WINDOW    = 1 * time.Hour
 )
 
 var notifiedRestarts = make(map[string]time.Time)
 
+var dryRun = flag.Bool("dry-run", false, "detect and analyze, but print Slack messages to stdout instead of posting them")
+
 func main() {
+	flag.Parse()
+	if *dryRun {
+		slackClient = dryRunSlack{}
+	}
+	if *fakeModel {
+		modelOverride = cannedModel{}
+	}
+
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		log.Println("⚠️ In-cluster config not found, trying local kubeconfig...")
@@ -41,90 +59,477 @@ func main() {
 		}
 	}
 
+	configureAPIClient(config)
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		log.Fatalf("❌ Failed to create clientset: %v", err)
 	}
 
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("❌ Failed to create dynamic client: %v", err)
+	}
+
+	path := configPath()
+	go watchConfig(path, reloadConfig(path, nil))
+	checkPermissions(clientset)
+	if *readOnly {
+		verifyReadOnly(clientset)
+	}
+	watchRules(clientset, dyn)
+	if flag.Arg(0) == "backfill" {
+		runBackfill(clientset, flag.Args()[1:])
+		return
+	}
+	detectIncidentCRD(clientset)
+	loadThreads(clientset)
+	watchTenants(clientset)
+	go runDigests()
+	go runMaintenance()
+	go serveHTTP(clientset, dyn)
+	go watchResolutions(clientset, dyn)
+	go retryAnalyses(clientset, dyn)
+	go watchNodes(clientset)
+	go watchAdmission(clientset, dyn)
+
+	if *namespaced {
+		log.Printf("🗂️ Namespaced mode: watching %s", strings.Join(watchedNamespaces(cfg()), ", "))
+	}
+	if *dryRun {
+		log.Println("🧪 Dry-run mode: Slack messages will be printed, not posted")
+	} else if os.Getenv("SLACK_BOT_TOKEN") == "" {
+		log.Println("🔕 SLACK_BOT_TOKEN is not set, Slack notifications are disabled")
+	}
 	log.Println("🚀 Pod restart monitor started...")
 
 	for {
-		pods, err := clientset.CoreV1().Pods("").List(context.Background(), v1.ListOptions{})
+		pods, err := listPods(context.Background(), clientset)
 		if err != nil {
 			log.Printf("❌ Error fetching pods: %v", err)
+			time.Sleep(pollDelay("pods", err))
 			continue
 		}
 
-		for _, pod := range pods.Items {
+		evictions := map[string][]corev1.Pod{}
+		for _, pod := range pods {
+			if !cfg().watchesNamespace(pod.Namespace) && !cfg().watchesControlPlane(&pod) {
+				continue
+			}
+			if detector.IsEvicted(&pod) {
+				key := "evicted/" + string(pod.UID)
+				if _, exists := notifiedRestarts[key]; !exists && ruleFor(pod.Namespace).allowsType(INCIDENT_EVICTION) {
+					notifiedRestarts[key] = detector.EvictionTime(&pod)
+					evictions[pod.Spec.NodeName] = append(evictions[pod.Spec.NodeName], pod)
+				}
+				continue
+			}
 			for _, cs := range pod.Status.ContainerStatuses {
-				if cs.RestartCount > 0 && pod.Status.StartTime != nil {
+				observeRestarts(&pod, cs)
+				if detector.StuckWaiting(cs) {
+					key := fmt.Sprintf("waiting/%s/%s/%s", pod.Namespace, pod.Name, cs.Name)
+					if _, exists := notifiedRestarts[key]; !exists {
+						notifiedRestarts[key] = time.Now()
+						log.Printf("⛔ Detected container stuck in %s: %s [%s]", cs.State.Waiting.Reason, pod.Name, pod.Namespace)
+						go analyzePod(clientset, dyn, pod, cs, time.Now())
+					}
+					continue
+				}
+				if detector.StuckUnready(&pod, cs, cfg().ReadinessTimeout.Duration) {
+					key := fmt.Sprintf("unready/%s/%s/%s", pod.Namespace, pod.Name, cs.Name)
+					if _, exists := notifiedRestarts[key]; !exists && ruleFor(pod.Namespace).allowsType(INCIDENT_PROBE_FAILURE) {
+						notifiedRestarts[key] = time.Now()
+						log.Printf("🩺 Detected container failing its readiness probe: %s [%s]", pod.Name, pod.Namespace)
+						go analyzePod(clientset, dyn, pod, cs, time.Now())
+					}
+					continue
+				}
+				if cs.RestartCount > 0 && cs.RestartCount >= restartThresholdFor(clientset, &pod) && pod.Status.StartTime != nil {
 					key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
 					restartTime := pod.Status.StartTime.Time
+					if t := cs.LastTerminationState.Terminated; t != nil && !t.FinishedAt.IsZero() {
+						restartTime = t.FinishedAt.Time
+					}
 
 					if last, exists := notifiedRestarts[key]; !exists || restartTime.After(last) {
 						notifiedRestarts[key] = restartTime
 						log.Printf("🚨 Detected restart: %s [%s]", pod.Name, pod.Namespace)
-						go analyzePod(clientset, pod.Name, pod.Namespace, restartTime)
+						go analyzePod(clientset, dyn, pod, cs, restartTime)
 					}
 				}
 			}
 		}
-		time.Sleep(CHECK_INTERVAL)
+		for node, evicted := range evictions {
+			log.Printf("🧹 Detected %d evicted pod(s) on node %s", len(evicted), node)
+			go analyzeEvictions(clientset, dyn, node, evicted)
+		}
+
+		jobs, err := listJobs(context.Background(), clientset)
+		if err != nil {
+			log.Printf("❌ Error fetching jobs: %v", err)
+		} else {
+			for _, job := range jobs {
+				if !cfg().watchesNamespace(job.Namespace) || jobFailure(&job) == nil {
+					continue
+				}
+				key := "job/" + string(job.UID)
+				if _, exists := notifiedRestarts[key]; !exists && ruleFor(job.Namespace).allowsType(INCIDENT_JOB_FAILURE) {
+					notifiedRestarts[key] = jobFailure(&job).LastTransitionTime.Time
+					log.Printf("💥 Detected failed job: %s [%s]", job.Name, job.Namespace)
+					go analyzeJob(clientset, dyn, job)
+				}
+			}
+		}
+		recordNotifiedSize(len(notifiedRestarts))
+		time.Sleep(pollDelay("pods", nil))
 	}
 }
 
-func analyzePod(clientset *kubernetes.Clientset, podName, namespace string, restartTime time.Time) {
-	ctx := context.Background()
+func analyzePod(clientset kubernetes.Interface, dyn dynamic.Interface, pod corev1.Pod, cs corev1.ContainerStatus, restartTime time.Time) *Incident {
+	return analyzePodFor(clientset, dyn, pod, cs, restartTime, nil)
+}
 
-	logs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{TailLines: int64Ptr(LOG_LINES)}).DoRaw(ctx)
-	if err != nil {
-		log.Printf("❌ Failed to get logs for %s: %v", podName, err)
-		return
+// analyzePodFor analyzes a container. With a reply, the analysis was asked
+// for on demand: it is posted into that thread, and maintenance windows,
+// correlation, paging and the incident store do not apply.
+func analyzePodFor(clientset kubernetes.Interface, dyn dynamic.Interface, pod corev1.Pod, cs corev1.ContainerStatus, restartTime time.Time, reply *slackReply) *Incident {
+	config := cfg().forNamespace(pod.Namespace)
+	podName, namespace := pod.Name, pod.Namespace
+	// Analyses asked for on demand neither supersede the analysis of a
+	// detected restart nor are superseded by one.
+	var ctx context.Context
+	var done func()
+	if reply != nil {
+		ctx, done = within(context.Background(), config.Timeouts.Analysis)
+	} else {
+		ctx, done = startAnalysis(fmt.Sprintf("%s/%s/%s", namespace, podName, cs.Name), restartTime, config.Timeouts.Analysis)
+	}
+	defer done()
+	ctx = withUsage(ctx, namespace)
+	rule := ruleFor(namespace)
+	workload := workloadName(&pod)
+
+	// While a workload is flapping, further restarts only add a line to the
+	// open flapping alert instead of a new analysis each.
+	restarts := workloadRestarts(namespace, workload)
+	flapping := config.Flapping.Threshold > 0 && restarts > config.Flapping.Threshold && !detector.StuckWaiting(cs)
+	if open := openFlappingAlert(config, namespace, workload, restarts); open != nil && flapping && reply == nil {
+		if open.ThreadTS != "" {
+			sendSlackThread(open.Channel, open.ThreadTS, fmt.Sprintf("🔁 `%s` restarted again at %s (%d restarts in the last %s)",
+				podName, restartTime.Format("15:04:05"), restarts, config.Flapping.Window.Duration))
+		}
+		return nil
 	}
 
-	eventList, err := clientset.CoreV1().Events(namespace).List(ctx, v1.ListOptions{})
+	lc := config.logConfigFor(namespace)
+	logs, errorLines := prepareLogs(collectLogs(ctx, clientset, &pod, cs.Name, restartTime, lc), lc)
+
+	events, err := podEvents(ctx, clientset, namespace, podName, restartTime.Add(-config.EventLookback.Duration))
 	if err != nil {
 		log.Printf("❌ Failed to get events for %s: %v", podName, err)
-		return
+		return nil
 	}
 
-	var events []corev1.Event
-	for _, e := range eventList.Items {
-		if e.InvolvedObject.Name == podName && e.LastTimestamp.Time.After(restartTime.Add(-1*time.Minute)) {
-			events = append(events, e)
+	resources := resourceSnapshot(ctx, clientset, &pod)
+	probes := collector.DescribeProbes(&pod, cs.Name)
+	storage := describeStorage(ctx, clientset, &pod, events, restartTime.Add(-config.EventLookback.Duration))
+	network := describeNetwork(ctx, clientset, &pod, errorLines+"\n"+logs)
+	registry := probeRegistry(ctx, clientset, config, &pod, cs)
+	autoscaler, scaling := describeAutoscaler(ctx, clientset, &pod, restartTime, config.ScaleWindow.Duration)
+	replica := compareHealthyReplica(ctx, clientset, &pod, cs.Name)
+	changes := configChanges(ctx, clientset, &pod, restartTime, config.ChangeWindow.Duration)
+	if rollout := rolloutChange(ctx, clientset, &pod, restartTime, config.RolloutWindow.Duration); rollout != "" {
+		changes = append([]string{rollout}, changes...)
+	}
+	deliveries := deliveriesOf(ctx, clientset, dyn, config, &pod)
+	var delivery []string
+	for _, d := range deliveries {
+		delivery = append(delivery, d.String())
+	}
+
+	unready := detector.StuckUnready(&pod, cs, config.ReadinessTimeout.Duration)
+	incidentType := INCIDENT_RESTART
+	if detector.StuckWaiting(cs) {
+		incidentType = INCIDENT_START_FAILURE
+	} else if detector.LivenessProbeFailed(events, cs.Name) || unready {
+		incidentType = INCIDENT_PROBE_FAILURE
+	}
+	if flapping {
+		incidentType = INCIDENT_FLAPPING
+	}
+	if !rule.allowsType(incidentType) {
+		log.Printf("🔕 Skipping %s incident for %s [%s]: not selected by PodAnalyzerRule %s", incidentType, podName, namespace, rule.Name)
+		return nil
+	}
+	severity := severityOf(incidentType)
+	if o := overridesFor(clientset, &pod); reply == nil && !o.allows(severity) {
+		log.Printf("🔕 Skipping %s incident for %s [%s]: %s is below the workload's minimum severity %s", incidentType, podName, namespace, severity, o.MinSeverity)
+		return nil
+	}
+
+	tmpl := rule.promptTemplate(config)
+	data := PromptData{
+		Type:       incidentType,
+		Restarts:   restarts,
+		Window:     config.Flapping.Window.Duration.String(),
+		Events:     collector.FormatEvents(events),
+		Resources:  resources,
+		Probes:     probes,
+		Storage:    storage,
+		Network:    network,
+		Autoscaler: autoscaler,
+		Replica:    replica,
+		Changes:    strings.Join(changes, "\n"),
+		Delivery:   strings.Join(delivery, "\n"),
+		History:    workloadHistory(config, namespace, workload, restartTime),
+		Errors:     errorLines,
+		Logs:       logs,
+	}
+
+	inc := &Incident{
+		ID:        fmt.Sprintf("%s-%s-%d", namespace, podName, restartTime.Unix()),
+		Type:      incidentType,
+		Severity:  severity,
+		Namespace: namespace,
+		Pod:       podName,
+		Workload:  workload,
+		Container: cs.Name,
+		Signature: crashSignature(namespace, workload, cs),
+		Time:      restartTime,
+		Events:    events,
+		Logs:      logs,
+		Resources: resources,
+		Restarts:  restarts,
+		Changes:   changes,
+		Delivery:  delivery,
+		Scaling:   scaling,
+		Language:  config.languageFor(namespace, rule.slackChannel(config)),
+	}
+	data.Language = promptLanguage(inc.Language)
+	if registry != nil {
+		inc.Registry = registry.String()
+		data.Registry = inc.Registry
+	}
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		inc.Reason, inc.ExitCode = t.Reason, t.ExitCode
+	} else if w := cs.State.Waiting; w != nil {
+		inc.Reason = w.Reason
+	}
+	if unready && incidentType == INCIDENT_PROBE_FAILURE {
+		inc.Reason = "NotReady"
+		data.ProbeKind = "readiness"
+	} else if incidentType == INCIDENT_PROBE_FAILURE {
+		data.ProbeKind = "liveness"
+	}
+	if reply == nil && (incidentType == INCIDENT_RESTART || incidentType == INCIDENT_FLAPPING) {
+		if r := suppressExpected(ctx, clientset, config, &pod, inc); r != nil {
+			if r.Record {
+				recordIncident(inc)
+				publishIncident(ctx, dyn, inc)
+				return inc
+			}
+			return nil
+		}
+	}
+	if reply == nil && silence(config, inc) {
+		recordIncident(inc)
+		publishIncident(ctx, dyn, inc)
+		return inc
+	}
+	// Incidents that share a root cause with a recent alert join its thread
+	// and get one combined analysis instead of an alert each.
+	if reply == nil && correlate(config, inc, correlationInfoFor(ctx, clientset, &pod, errorLines)) {
+		inc.Analysis = "Correlated with incident " + inc.GroupID + ", see the combined analysis in its thread."
+		recordIncident(inc)
+		publishIncident(ctx, dyn, inc)
+		trackOpen(inc)
+		return inc
+	}
+	enrichment := enrich(ctx, config, inc)
+	data.Enrichment = enrichment
+	data.Runbooks = describeRunbooks(matchRunbooks(config, inc, errorLines+"\n"+logs))
+
+	// Failures the heuristics recognize are reported right away; the model
+	// only runs for the rest, or when someone asks for it from Slack. Once
+	// the daily token budget is spent, the heuristics run regardless.
+	var class *analyzer.Classification
+	if config.Heuristics || overTokenBudget(config) {
+		class = classify(&pod, cs, incidentType, events, errorLines)
+	}
+	if class != nil && class.Category == analyzer.CATEGORY_IMAGE_PULL && registry != nil {
+		registry.refine(class)
+	}
+	var analysis string
+	var structured *analyzer.StructuredAnalysis
+	var modelErr error
+	if class != nil {
+		log.Printf("⚡ Classified %s [%s] as %s", podName, namespace, class.Category)
+		analysis = class.String()
+	} else {
+		modelConfig := config.forIncident(incidentType)
+		fitted := data
+		fitPromptData(ctx, modelConfig, tmpl, &fitted)
+		analysis, structured, modelErr = analyzeWithModel(ctx, modelConfig, renderPrompt(tmpl, fitted))
+		if ctx.Err() == context.Canceled {
+			log.Printf("⏹️ Dropping the analysis of %s [%s]: superseded by a newer restart", podName, namespace)
+			return nil
+		}
+		if modelErr != nil {
+			// Still alert with what is known; the analysis is backfilled
+			// once the model answers again.
+			log.Printf("❌ Failed to analyze pod %s, alerting without AI analysis: %v", podName, modelErr)
+			analysis = fallbackAnalysis(&pod, cs, incidentType, events, errorLines, modelErr)
 		}
 	}
 
-	analysis, err := callOllama(logs, events)
-	if err != nil {
-		log.Printf("❌ Failed to analyze pod %s: %v", podName, err)
-		return
+	inc.Analysis = analysis
+	inc.PromptTokens, inc.ResponseTokens = usageOf(ctx)
+	if class != nil {
+		inc.Category = class.Category
+		inc.PromptVersion = PROMPT_HEURISTICS
+	} else if modelErr == nil {
+		inc.PromptVersion = rule.promptVersion(config)
+		if structured != nil {
+			inc.Category, inc.RootCause = structured.Category, structured.RootCause
+			inc.Confidence, inc.NeedsHuman = structured.Confidence, structured.NeedsHuman
+		}
 	}
+	// Matched again now that the category is known.
+	inc.Runbooks = matchRunbooks(config, inc, errorLines+"\n"+logs)
 
-	threadTS := sendMainSlackMessage(podName, namespace, restartTime)
+	channel := rule.slackChannel(config)
+	if flapping {
+		channel = config.flappingChannel(rule)
+	}
+	channel = config.channelFor(channel)
+	// Repeated detections of an ongoing crash loop go into its first thread,
+	// with the parent message updated to the current restart count.
+	var threadTS string
+	thread := activeThread(config, inc.Signature)
+	if reply != nil {
+		channel, threadTS, thread = reply.Channel, reply.TS, nil
+		if threadTS != "" {
+			sendSlackThread(channel, threadTS, mainMessageText(inc, nil))
+		}
+	} else if thread != nil && !flapping {
+		channel, threadTS = thread.Channel, thread.TS
+		thread = touchThread(config, inc.Signature, channel, threadTS, cs.RestartCount)
+		updateSlackMessage(channel, threadTS, mainMessageText(inc, thread))
+		sendSlackThread(channel, threadTS, fmt.Sprintf(translate(inc.Language, "🔁 *Restarted again* at %s (restart count %d), updated analysis below."),
+			restartTime.Format("2006-01-02 15:04:05"), cs.RestartCount))
+	} else {
+		thread = nil
+		threadTS = sendMainSlackMessage(channel, inc)
+		if !flapping {
+			touchThread(config, inc.Signature, channel, threadTS, cs.RestartCount)
+		}
+	}
+	inc.Channel, inc.ThreadTS = channel, threadTS
+	if flapping && reply == nil {
+		setFlappingAlert(inc)
+	}
+	if threadTS != "" && thread == nil {
+		slack := localized(formatterFor(FORMAT_MRKDWN), inc.Language)
+		sendSlackThread(channel, threadTS, slack.Section(eventsSection(events)))
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "📈", Title: "Resources", Body: resources}))
+		if incidentType == INCIDENT_PROBE_FAILURE && probes != "" {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🩺", Title: "Probes", Body: probes}))
+		}
+		if storage != "" {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "💾", Title: "Storage", Body: storage}))
+		}
+		if autoscaler != "" {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "⚖️", Title: "Autoscaler", Body: autoscaler}))
+		}
+		if replica != "" {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🪞", Title: "Healthy replica", Body: replica}))
+		}
+		if network != "" {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🌐", Title: "Network", Body: network}))
+		}
+		if enrichment != "" {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🧩", Title: "Context", Body: enrichment}))
+		}
+		sendSlackThread(channel, threadTS, slack.Section(logsSection(logs)))
+	}
 	if threadTS != "" {
-		sendSlackThread(threadTS, "📋 *Events:*\n```"+formatEvents(events)+"```")
-		sendSlackThread(threadTS, "📦 *Logs:*\n```"+truncate(string(logs), 1000)+"```")
-		sendSlackThread(threadTS, "🤖 *Analysis:*\n"+formatCodeBlocks(truncate(analysis, 3000)))
+		switch {
+		case class != nil:
+			postQuickDiagnosis(channel, inc, class, tmpl, data)
+		case modelErr != nil:
+			sendSlackThread(channel, threadTS, analysis)
+		default:
+			postAnalysis(clientset, channel, inc, analysis)
+		}
+	}
+	// An analysis asked for on demand is only an answer: it is not an
+	// incident, so it is not stored, retried, paged, acted on or counted
+	// toward recurring-incident issues.
+	if reply != nil {
+		return inc
+	}
+	if modelErr != nil {
+		queueAnalysis(inc, tmpl, data)
 	}
-}
 
-func callOllama(logs []byte, events []corev1.Event) (string, error) {
-	eventLines := []string{}
-	for _, e := range events {
-		eventLines = append(eventLines, fmt.Sprintf("- %s: %s", e.Reason, e.Message))
+	recordIncident(inc)
+	publishIncident(ctx, dyn, inc)
+	emitDiagnosisEvent(ctx, clientset, &pod, inc)
+	notify(config, inc)
+	trackOpen(inc)
+	correlationReady(inc)
+	crashLooping := flapping || cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff"
+	actOnDeliveries(ctx, clientset, dyn, config, deliveries, inc, crashLooping)
+	if config.Remediation.Enabled && !*readOnly && threadTS != "" {
+		proposeRemediation(ctx, clientset, &pod, inc, channel)
 	}
-	eventStr := strings.Join(eventLines, "\n")
 
-	prompt := fmt.Sprintf("Here are the logs and events from a Kubernetes pod. Help me identify the issue and suggest a fix.\n\nEvents:\n%s\n\nLogs:\n%s", eventStr, string(logs))
+	recent := incidentsBySignature(inc.Signature, time.Now().Add(-config.IssueWindow.Duration))
+	if len(recent) > config.IssueThreshold {
+		// Only the incident that crosses the threshold starts a new round of
+		// recurrences; the ones after it just update the issue, quietly.
+		crossed := len(recent) == config.IssueThreshold+1
+		links, opened := fileRecurringIssue(config, inc, recent, crossed)
+		if threadTS != "" && len(links) > 0 && (crossed || opened) {
+			sendSlackThread(channel, threadTS, "🎫 *Recurring incident tracked:* "+strings.Join(links, " "))
+		}
+	}
+	return inc
+}
+
+func callOllama(ctx context.Context, config *Config, prompt string, format interface{}) (string, error) {
+	if err := checkTokenBudget(config); err != nil {
+		return "", err
+	}
+	options := map[string]interface{}{
+		"num_ctx": config.contextTokens(),
+	}
+	if config.ModelParams.Temperature != nil {
+		options["temperature"] = *config.ModelParams.Temperature
+	}
+	if config.ModelParams.TopP != nil {
+		options["top_p"] = *config.ModelParams.TopP
+	}
+	if config.ModelParams.MaxTokens > 0 {
+		options["num_predict"] = config.ModelParams.MaxTokens
+	}
 	body := map[string]interface{}{
-		"model":  OLLAMA_MODEL,
-		"prompt": prompt,
-		"stream": false,
+		"model":   config.OllamaModel,
+		"prompt":  prompt,
+		"stream":  false,
+		"options": options,
+	}
+	if config.ModelParams.SystemPrompt != "" {
+		body["system"] = config.ModelParams.SystemPrompt
+	}
+	if format != nil {
+		body["format"] = format
 	}
 	jsonData, _ := json.Marshal(body)
+	jsonData = outbound("model", config.OllamaAPI, jsonData)
 
-	req, err := http.NewRequest("POST", OLLAMA_API, bytes.NewBuffer(jsonData))
+	ctx, cancel := within(ctx, config.Timeouts.Model)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", config.OllamaAPI, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", err
 	}
@@ -146,28 +551,47 @@ func callOllama(logs []byte, events []corev1.Event) (string, error) {
 		return "", err
 	}
 
-	if response, ok := parsed["response"].(string); ok {
+	response, ok := parsed["response"].(string)
+	promptTokens, _ := parsed["prompt_eval_count"].(float64)
+	responseTokens, _ := parsed["eval_count"].(float64)
+	recordUsage(ctx, config, prompt, response, int(promptTokens), int(responseTokens))
+	if ok {
 		return response, nil
 	}
 	return "No response from model", nil
 }
 
-func sendMainSlackMessage(podName, namespace string, restartTime time.Time) string {
-	summary := "*🚨 Pod Restart Detected!*\n" +
-		fmt.Sprintf("> *Pod:* `%s`\n", podName) +
-		fmt.Sprintf("> *Namespace:* `%s`\n", namespace) +
-		fmt.Sprintf("> *Restart Time:* `%s`", restartTime.Format("2006-01-02 15:04:05"))
-
+func sendMainSlackMessage(channel string, inc *Incident) string {
 	payload := map[string]interface{}{
-		"channel": SLACK_CHANNEL,
-		"text":    summary,
+		"channel": channel,
+		"text":    mainMessageText(inc, nil),
 	}
 	return postToSlack(payload)
 }
 
-func sendSlackThread(threadTs string, message string) {
+// mainMessageText is the parent message of an incident; for an ongoing
+// incident it also shows how often it has been detected so far.
+func mainMessageText(inc *Incident, thread *slackThread) string {
+	v := viewOf(inc)
+	if thread != nil && thread.Detections > 1 {
+		v.Fields = append(v.Fields, viewField{Emoji: "🔁", Label: "Ongoing",
+			Value: fmt.Sprintf("restart count `%d`, detected %d times since %s", thread.Restarts, thread.Detections, thread.First.Format("2006-01-02 15:04:05"))})
+	}
+	return localized(formatterFor(FORMAT_MRKDWN), inc.Language).Header(v)
+}
+
+// updateSlackMessage replaces the text of a posted message.
+func updateSlackMessage(channel, ts, text string) {
+	slackAPI("chat.update", map[string]interface{}{
+		"channel": channel,
+		"ts":      ts,
+		"text":    text,
+	})
+}
+
+func sendSlackThread(channel, threadTs string, message string) {
 	payload := map[string]interface{}{
-		"channel":   SLACK_CHANNEL,
+		"channel":   channel,
 		"text":      message,
 		"thread_ts": threadTs,
 	}
@@ -175,42 +599,72 @@ func sendSlackThread(threadTs string, message string) {
 }
 
 func postToSlack(payload map[string]interface{}) string {
-	token := os.Getenv("SLACK_BOT_TOKEN")
-	url := "https://slack.com/api/chat.postMessage"
+	return slackAPI("chat.postMessage", payload)
+}
 
-	jsonData, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+// SlackClient calls a Slack Web API method and returns the ts of the message
+// it posted or updated, or "" if the call failed.
+type SlackClient interface {
+	Call(method string, payload map[string]interface{}) string
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("❌ Slack API error: %v", err)
-		return ""
-	}
-	defer resp.Body.Close()
+// slackClient is replaced by dryRunSlack with --dry-run.
+var slackClient SlackClient = webSlack{api: &notifier.Slack{}}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	var result map[string]interface{}
-	_ = json.Unmarshal(body, &result)
+func slackAPI(method string, payload map[string]interface{}) string {
+	return slackClient.Call(method, payload)
+}
 
-	if ok, _ := result["ok"].(bool); !ok {
-		log.Printf("❌ Slack API response: %s", string(body))
+// webSlack posts to the Slack Web API with the bot token of the channel's
+// tenant.
+type webSlack struct {
+	api *notifier.Slack
+}
+
+func (s webSlack) Call(method string, payload map[string]interface{}) string {
+	channel, token := slackCredentials(fmt.Sprint(payload["channel"]))
+	if token == "" {
 		return ""
 	}
+	payload["channel"] = channel
 
-	if ts, ok := result["ts"].(string); ok {
-		return ts
+	ctx, cancel := within(context.Background(), cfg().Timeouts.Slack)
+	defer cancel()
+	start := time.Now()
+	jsonData, _ := json.Marshal(payload)
+	jsonData = outbound("slack", method, jsonData)
+	ts, err := s.api.Call(ctx, token, method, jsonData)
+	if err != nil {
+		log.Printf("❌ Slack API error (%s): %v", method, err)
+		recordSlackCall(method, start, err.Error())
+		return ""
 	}
-	return ""
+	recordSlackCall(method, start, "")
+	return ts
 }
 
-func formatEvents(events []corev1.Event) string {
-	var lines []string
-	for _, e := range events {
-		lines = append(lines, fmt.Sprintf("%s: %s", e.Reason, e.Message))
+// dryRunSlack prints messages to stdout instead of posting them.
+type dryRunSlack struct{}
+
+func (dryRunSlack) Call(method string, payload map[string]interface{}) string {
+	return printDryRun(payload)
+}
+
+func printDryRun(payload map[string]interface{}) string {
+	if ts, ok := payload["ts"].(string); ok {
+		fmt.Printf("----- [dry-run] %v (update of message %s)\n", payload["channel"], ts)
+		fmt.Println(payload["text"])
+		return ts
+	}
+	ts, _ := payload["thread_ts"].(string)
+	if ts == "" {
+		ts = fmt.Sprintf("dry-run-%d", time.Now().UnixNano())
+		fmt.Printf("----- [dry-run] %v (new message %s)\n", payload["channel"], ts)
+	} else {
+		fmt.Printf("----- [dry-run] %v (thread %s)\n", payload["channel"], ts)
 	}
-	return strings.Join(lines, "\n")
+	fmt.Println(payload["text"])
+	return ts
 }
 
 func formatCodeBlocks(text string) string {
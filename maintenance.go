@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const MAINTENANCE_SUMMARY_TOP_N = 10
+
+// MaintenanceWindow is a period in which incidents are still detected and
+// recorded, but nobody is notified. It either recurs on a cron schedule for
+// duration, or runs once from from until until.
+type MaintenanceWindow struct {
+	Name       string      `json:"name"`
+	Schedule   string      `json:"schedule"`
+	Duration   v1.Duration `json:"duration"`
+	From       v1.Time     `json:"from"`
+	Until      v1.Time     `json:"until"`
+	Namespaces []string    `json:"namespaces"`
+	Channel    string      `json:"channel"`
+}
+
+// silencedWindow is one occurrence of a window and what it suppressed.
+type silencedWindow struct {
+	Window    MaintenanceWindow
+	Start     time.Time
+	End       time.Time
+	Incidents []*Incident
+}
+
+var (
+	maintenanceMu sync.Mutex
+	silenced      = map[string]*silencedWindow{}
+)
+
+// occurrence returns the start and end of the window's occurrence that
+// covers now, if any.
+func (w MaintenanceWindow) occurrence(now time.Time) (start, end time.Time, ok bool) {
+	if w.Schedule == "" {
+		if w.From.IsZero() || w.Until.IsZero() {
+			return start, end, false
+		}
+		return w.From.Time, w.Until.Time, !now.Before(w.From.Time) && now.Before(w.Until.Time)
+	}
+	schedule, err := cron.ParseStandard(w.Schedule)
+	if err != nil || w.Duration.Duration <= 0 {
+		return start, end, false
+	}
+	start = schedule.Next(now.Add(-w.Duration.Duration))
+	end = start.Add(w.Duration.Duration)
+	return start, end, !start.After(now)
+}
+
+// covers reports whether the window applies to the namespace. Incidents
+// without one, such as nodes, are only covered by cluster-wide windows.
+func (w MaintenanceWindow) covers(namespace string) bool {
+	return len(w.Namespaces) == 0 || containsString(w.Namespaces, namespace)
+}
+
+func (w MaintenanceWindow) key(start time.Time) string {
+	return w.Name + "|" + start.Format(time.RFC3339)
+}
+
+// silence records the incident in the summary of the maintenance window it
+// falls into and reports whether notifications for it must be suppressed.
+func silence(config *Config, inc *Incident) bool {
+	now := time.Now()
+	for _, w := range config.Maintenance {
+		if !w.covers(inc.Namespace) {
+			continue
+		}
+		start, end, ok := w.occurrence(now)
+		if !ok {
+			continue
+		}
+		maintenanceMu.Lock()
+		s := silenced[w.key(start)]
+		if s == nil {
+			s = &silencedWindow{Window: w, Start: start, End: end}
+			silenced[w.key(start)] = s
+		}
+		s.Incidents = append(s.Incidents, inc)
+		maintenanceMu.Unlock()
+		log.Printf("🔇 Maintenance window %s until %s: recorded %s [%s] without notifying", w.Name, end.Format("15:04"), inc.Pod, inc.Namespace)
+		return true
+	}
+	return false
+}
+
+// runMaintenance logs when windows start and posts the summary of each one
+// when it ends. Windows are re-read from the config every minute.
+func runMaintenance() {
+	for {
+		now := time.Now()
+		config := cfg()
+		maintenanceMu.Lock()
+		for _, w := range config.Maintenance {
+			start, end, ok := w.occurrence(now)
+			if !ok {
+				continue
+			}
+			if _, exists := silenced[w.key(start)]; !exists {
+				silenced[w.key(start)] = &silencedWindow{Window: w, Start: start, End: end}
+				log.Printf("🔇 Maintenance window %s started, notifications suppressed until %s", w.Name, end.Format("2006-01-02 15:04"))
+			}
+		}
+		var ended []*silencedWindow
+		for key, s := range silenced {
+			if !now.Before(s.End) {
+				ended = append(ended, s)
+				delete(silenced, key)
+			}
+		}
+		maintenanceMu.Unlock()
+
+		for _, s := range ended {
+			log.Printf("🔔 Maintenance window %s ended with %d incident(s)", s.Window.Name, len(s.Incidents))
+			channel := s.Window.Channel
+			if channel == "" {
+				channel = config.SlackChannel
+			}
+			postToSlack(map[string]interface{}{
+				"channel": channel,
+				"text":    maintenanceSummary(s),
+			})
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func maintenanceSummary(s *silencedWindow) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*🔔 Maintenance window `%s` ended*\n", s.Window.Name)
+	fmt.Fprintf(&b, "> %s – %s", s.Start.Format("2006-01-02 15:04"), s.End.Format("15:04"))
+	if len(s.Window.Namespaces) > 0 {
+		fmt.Fprintf(&b, " in `%s`", strings.Join(s.Window.Namespaces, "`, `"))
+	}
+	if len(s.Incidents) == 0 {
+		b.WriteString("\nNo incidents during the window. 🎉")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\nIncidents recorded without alerting: *%d*\n", len(s.Incidents))
+
+	type group struct {
+		key    string
+		count  int
+		reason string
+	}
+	groups := map[string]*group{}
+	for _, inc := range s.Incidents {
+		key := fmt.Sprintf("%s/%s (%s)", inc.Namespace, inc.Workload, inc.Type)
+		if groups[key] == nil {
+			groups[key] = &group{key: key}
+		}
+		groups[key].count++
+		if inc.Reason != "" {
+			groups[key].reason = inc.Reason
+		}
+	}
+	var list []*group
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].count != list[j].count {
+			return list[i].count > list[j].count
+		}
+		return list[i].key < list[j].key
+	})
+	for i, g := range list {
+		if i == MAINTENANCE_SUMMARY_TOP_N {
+			fmt.Fprintf(&b, "…and %d more\n", len(list)-i)
+			break
+		}
+		fmt.Fprintf(&b, "• `%s` ×%d", g.key, g.count)
+		if g.reason != "" {
+			fmt.Fprintf(&b, " — %s", g.reason)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Still failing workloads will be alerted on their next restart.")
+	return b.String()
+}
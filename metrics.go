@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	metricsMu      sync.Mutex
+	incidentTotals = map[string]int{}
+	categoryTotals = map[string]int{}
+)
+
+func countIncident(inc *Incident) {
+	metricsMu.Lock()
+	incidentTotals[inc.Type]++
+	if inc.Category != "" {
+		categoryTotals[inc.Category]++
+	}
+	metricsMu.Unlock()
+}
+
+// handleMetrics serves the restart-rate and incident metrics in the
+// Prometheus text exposition format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	config := cfg()
+	window := config.Flapping.Window.Duration
+	hours := window.Hours()
+
+	var b strings.Builder
+	rates := restartRates()
+	keys := make([]string, 0, len(rates))
+	for k := range rates {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(&b, "# HELP pod_analyzer_workload_restarts Container restarts of the workload within the flapping window (%s).\n", window)
+	b.WriteString("# TYPE pod_analyzer_workload_restarts gauge\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "pod_analyzer_workload_restarts{%s} %d\n", workloadLabels(k), rates[k])
+	}
+	b.WriteString("# HELP pod_analyzer_workload_restart_rate Container restarts per hour of the workload, averaged over the flapping window.\n")
+	b.WriteString("# TYPE pod_analyzer_workload_restart_rate gauge\n")
+	for _, k := range keys {
+		rate := float64(rates[k])
+		if hours > 0 {
+			rate /= hours
+		}
+		fmt.Fprintf(&b, "pod_analyzer_workload_restart_rate{%s} %g\n", workloadLabels(k), rate)
+	}
+	b.WriteString("# HELP pod_analyzer_workload_flapping Whether the workload restarts more often than the flapping threshold.\n")
+	b.WriteString("# TYPE pod_analyzer_workload_flapping gauge\n")
+	for _, k := range keys {
+		flapping := 0
+		if config.Flapping.Threshold > 0 && rates[k] > config.Flapping.Threshold {
+			flapping = 1
+		}
+		fmt.Fprintf(&b, "pod_analyzer_workload_flapping{%s} %d\n", workloadLabels(k), flapping)
+	}
+
+	metricsMu.Lock()
+	types := make([]string, 0, len(incidentTotals))
+	for t := range incidentTotals {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	b.WriteString("# HELP pod_analyzer_incidents_total Incidents detected since the analyzer started.\n")
+	b.WriteString("# TYPE pod_analyzer_incidents_total counter\n")
+	for _, t := range types {
+		fmt.Fprintf(&b, "pod_analyzer_incidents_total{type=%q} %d\n", t, incidentTotals[t])
+	}
+	categories := make([]string, 0, len(categoryTotals))
+	for c := range categoryTotals {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	b.WriteString("# HELP pod_analyzer_incidents_by_category_total Incidents by diagnosed category (heuristics or structured model output).\n")
+	b.WriteString("# TYPE pod_analyzer_incidents_by_category_total counter\n")
+	for _, c := range categories {
+		fmt.Fprintf(&b, "pod_analyzer_incidents_by_category_total{category=%q} %d\n", c, categoryTotals[c])
+	}
+	metricsMu.Unlock()
+	writeFeedbackMetrics(&b)
+	writeAPIMetrics(&b)
+	writeUsageMetrics(&b, config)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+// workloadLabels turns a namespace/workload key into Prometheus labels.
+func workloadLabels(key string) string {
+	namespace, workload := key, ""
+	if i := strings.Index(key, "/"); i >= 0 {
+		namespace, workload = key[:i], key[i+1:]
+	}
+	return fmt.Sprintf("namespace=%q,workload=%q", namespace, workload)
+}
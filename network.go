@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const NETWORK_MAX_TARGETS = 5
+
+var (
+	networkErrorPattern  = regexp.MustCompile(`(?i)connection refused|connection reset|i/o timeout|timed out|timeout|no route to host|no such host|network is unreachable|ECONNREFUSED|ETIMEDOUT|EHOSTUNREACH|ENOTFOUND|upstream connect error|no healthy upstream`)
+	networkTargetPattern = regexp.MustCompile(`(?i)\b((?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)*[a-z](?:[a-z0-9-]*[a-z0-9])?|\d{1,3}(?:\.\d{1,3}){3}):(\d{2,5})\b`)
+	dnsLookupPattern     = regexp.MustCompile(`(?i)lookup ([a-z0-9.-]+)(?: on [0-9.:]+)?: no such host`)
+)
+
+// sidecars are the mesh proxies injected next to the application.
+var sidecars = map[string]string{
+	"istio-proxy":   "Istio",
+	"linkerd-proxy": "Linkerd",
+}
+
+// networkTarget is a host the pod failed to reach.
+type networkTarget struct {
+	Host string
+	Port string
+}
+
+// describeNetwork grounds connection errors in the cluster objects behind
+// them: the Services and Endpoints the pod failed to reach, the
+// NetworkPolicies selecting the pod and its targets, and mesh sidecars. It
+// returns nothing when the logs show no network errors.
+func describeNetwork(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, logs string) string {
+	var errors []string
+	for _, line := range strings.Split(logs, "\n") {
+		if networkErrorPattern.MatchString(line) {
+			errors = append(errors, line)
+		}
+	}
+	if len(errors) == 0 {
+		return ""
+	}
+
+	var sections []string
+	targets := networkTargets(errors)
+	for _, t := range targets {
+		sections = append(sections, describeTarget(ctx, clientset, pod, t))
+	}
+	if policies := describePolicies(ctx, clientset, pod.Namespace, labels.Set(pod.Labels), "pod"); policies != "" {
+		sections = append(sections, policies)
+	}
+	if mesh := describeMesh(ctx, clientset, pod); mesh != "" {
+		sections = append(sections, mesh)
+	}
+	if len(targets) == 0 {
+		sections = append([]string{"no target host found in the network errors"}, sections...)
+	}
+	return strings.Join(sections, "\n")
+}
+
+// networkTargets reads the hosts from the error lines, skipping the cluster
+// DNS server that lookups report.
+func networkTargets(errors []string) []networkTarget {
+	seen := map[string]bool{}
+	var targets []networkTarget
+	add := func(host, port string) {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if seen[host] || len(targets) == NETWORK_MAX_TARGETS {
+			return
+		}
+		seen[host] = true
+		targets = append(targets, networkTarget{Host: host, Port: port})
+	}
+	for _, line := range errors {
+		if m := dnsLookupPattern.FindStringSubmatch(line); m != nil {
+			add(m[1], "")
+			continue
+		}
+		for _, m := range networkTargetPattern.FindAllStringSubmatch(line, -1) {
+			if m[2] == "53" {
+				continue
+			}
+			add(m[1], m[2])
+		}
+	}
+	return targets
+}
+
+// describeTarget reports the Service behind a host and whether it has
+// ready endpoints on the port the pod used.
+func describeTarget(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, t networkTarget) string {
+	label := t.Host
+	if t.Port != "" {
+		label += ":" + t.Port
+	}
+
+	if ip := net.ParseIP(t.Host); t.Host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return fmt.Sprintf("target %s: inside the pod, i.e. another container or the mesh sidecar", label)
+	}
+	var svc *corev1.Service
+	if ip := net.ParseIP(t.Host); ip != nil {
+		if allowed(pod.Namespace, "list", "services") {
+			if list, err := clientset.CoreV1().Services(pod.Namespace).List(ctx, v1.ListOptions{}); err == nil {
+				for i := range list.Items {
+					if list.Items[i].Spec.ClusterIP == t.Host {
+						svc = &list.Items[i]
+					}
+				}
+			}
+		}
+		if svc == nil {
+			return fmt.Sprintf("target %s: not the ClusterIP of a Service in %s", label, pod.Namespace)
+		}
+	} else {
+		hosts := dependencyHosts(t.Host, pod.Namespace)
+		if len(hosts) == 0 {
+			return fmt.Sprintf("target %s: not a Service name", label)
+		}
+		parts := strings.SplitN(hosts[0], ".", 2)
+		if !allowed(parts[1], "get", "services") {
+			return fmt.Sprintf("target %s: Service %s not checked (the service account may not get services)", label, hosts[0])
+		}
+		var err error
+		svc, err = clientset.CoreV1().Services(parts[1]).Get(ctx, parts[0], v1.GetOptions{})
+		if err != nil {
+			return fmt.Sprintf("target %s: no Service %s in the cluster (%v)", label, hosts[0], err)
+		}
+	}
+
+	var ports []string
+	portKnown := t.Port == ""
+	for _, p := range svc.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%d->%s/%s", p.Port, p.TargetPort.String(), p.Protocol))
+		if fmt.Sprint(p.Port) == t.Port || p.TargetPort.String() == t.Port {
+			portKnown = true
+		}
+	}
+	line := fmt.Sprintf("target %s: Service %s/%s type %s clusterIP %s ports [%s]", label, svc.Namespace, svc.Name, svc.Spec.Type, svc.Spec.ClusterIP, strings.Join(ports, ", "))
+	if !portKnown {
+		line += fmt.Sprintf(", port %s is not exposed by the Service", t.Port)
+	}
+	if len(svc.Spec.Selector) > 0 {
+		line += ", selector " + labels.SelectorFromSet(svc.Spec.Selector).String()
+	}
+
+	if allowed(svc.Namespace, "get", "endpoints") {
+		endpoints, err := clientset.CoreV1().Endpoints(svc.Namespace).Get(ctx, svc.Name, v1.GetOptions{})
+		if err != nil {
+			line += fmt.Sprintf("\n  endpoints: %v", err)
+		} else {
+			ready, notReady := 0, 0
+			for _, s := range endpoints.Subsets {
+				ready += len(s.Addresses)
+				notReady += len(s.NotReadyAddresses)
+			}
+			line += fmt.Sprintf("\n  endpoints: %d ready, %d not ready", ready, notReady)
+			if ready == 0 {
+				line += " (no backend can accept connections)"
+			}
+		}
+	}
+	if len(svc.Spec.Selector) > 0 {
+		if policies := describePolicies(ctx, clientset, svc.Namespace, labels.Set(svc.Spec.Selector), "target"); policies != "" {
+			line += "\n  " + strings.ReplaceAll(policies, "\n", "\n  ")
+		}
+	}
+	return line
+}
+
+// describePolicies lists the NetworkPolicies that select pods with the
+// labels; selecting a pod at all makes the policy's direction default-deny.
+func describePolicies(ctx context.Context, clientset kubernetes.Interface, namespace string, podLabels labels.Set, what string) string {
+	if !allowed(namespace, "list", "networkpolicies.networking.k8s.io") {
+		return ""
+	}
+	list, err := clientset.NetworkingV1().NetworkPolicies(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Sprintf("network policies of the %s: %v", what, err)
+	}
+	var lines []string
+	for _, np := range list.Items {
+		selector, err := v1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+		if err != nil || !selector.Matches(podLabels) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("networkpolicy %s/%s selects the %s: %s", np.Namespace, np.Name, what, describePolicy(&np)))
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("no network policy selects the %s in %s", what, namespace)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func describePolicy(np *networkingv1.NetworkPolicy) string {
+	types := np.Spec.PolicyTypes
+	if len(types) == 0 {
+		types = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+		if len(np.Spec.Egress) > 0 {
+			types = append(types, networkingv1.PolicyTypeEgress)
+		}
+	}
+	var parts []string
+	for _, t := range types {
+		switch t {
+		case networkingv1.PolicyTypeIngress:
+			if len(np.Spec.Ingress) == 0 {
+				parts = append(parts, "denies all ingress")
+			}
+			for _, r := range np.Spec.Ingress {
+				parts = append(parts, "ingress from "+describePeers(r.From)+" on "+describePorts(r.Ports))
+			}
+		case networkingv1.PolicyTypeEgress:
+			if len(np.Spec.Egress) == 0 {
+				parts = append(parts, "denies all egress")
+			}
+			for _, r := range np.Spec.Egress {
+				parts = append(parts, "egress to "+describePeers(r.To)+" on "+describePorts(r.Ports))
+			}
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func describePeers(peers []networkingv1.NetworkPolicyPeer) string {
+	if len(peers) == 0 {
+		return "anywhere"
+	}
+	var list []string
+	for _, p := range peers {
+		var parts []string
+		if p.NamespaceSelector != nil {
+			parts = append(parts, "namespaces "+selectorString(p.NamespaceSelector))
+		}
+		if p.PodSelector != nil {
+			parts = append(parts, "pods "+selectorString(p.PodSelector))
+		}
+		if p.IPBlock != nil {
+			block := "ipBlock " + p.IPBlock.CIDR
+			if len(p.IPBlock.Except) > 0 {
+				block += " except " + strings.Join(p.IPBlock.Except, ",")
+			}
+			parts = append(parts, block)
+		}
+		list = append(list, strings.Join(parts, " and "))
+	}
+	return "[" + strings.Join(list, "; ") + "]"
+}
+
+func describePorts(ports []networkingv1.NetworkPolicyPort) string {
+	if len(ports) == 0 {
+		return "all ports"
+	}
+	var list []string
+	for _, p := range ports {
+		s := "TCP"
+		if p.Protocol != nil {
+			s = string(*p.Protocol)
+		}
+		if p.Port != nil {
+			s += "/" + p.Port.String()
+		}
+		if p.EndPort != nil {
+			s += fmt.Sprintf("-%d", *p.EndPort)
+		}
+		list = append(list, s)
+	}
+	return strings.Join(list, ",")
+}
+
+func selectorString(s *v1.LabelSelector) string {
+	selector, err := v1.LabelSelectorAsSelector(s)
+	if err != nil {
+		return "invalid"
+	}
+	if selector.Empty() {
+		return "(all)"
+	}
+	return selector.String()
+}
+
+// describeMesh reports the Istio or Linkerd sidecar of the pod and, with
+// get on namespaces, whether the namespace asks for injection.
+func describeMesh(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) string {
+	var lines []string
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		mesh := sidecars[cs.Name]
+		if mesh == "" && (cs.Name == "istio-init" || cs.Name == "linkerd-init") {
+			mesh = "mesh init"
+		}
+		if mesh == "" {
+			continue
+		}
+		line := fmt.Sprintf("%s sidecar %s: ready=%t restarts=%d", mesh, cs.Name, cs.Ready, cs.RestartCount)
+		if cs.State.Waiting != nil {
+			line += " waiting " + cs.State.Waiting.Reason
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			line += fmt.Sprintf(", last terminated %s (exit code %d)", t.Reason, t.ExitCode)
+		}
+		lines = append(lines, line)
+	}
+	for _, key := range []string{"sidecar.istio.io/inject", "linkerd.io/inject", "proxy.istio.io/config", "config.linkerd.io/skip-outbound-ports"} {
+		if v, ok := pod.Annotations[key]; ok {
+			lines = append(lines, fmt.Sprintf("pod annotation %s=%s", key, strings.TrimSpace(v)))
+		}
+	}
+	if allowed("", "get", "namespaces") {
+		if ns, err := clientset.CoreV1().Namespaces().Get(ctx, pod.Namespace, v1.GetOptions{}); err == nil {
+			for _, key := range []string{"istio-injection", "istio.io/rev"} {
+				if v, ok := ns.Labels[key]; ok {
+					lines = append(lines, fmt.Sprintf("namespace label %s=%s", key, v))
+				}
+			}
+			if v, ok := ns.Annotations["linkerd.io/inject"]; ok {
+				lines = append(lines, "namespace annotation linkerd.io/inject="+v)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	INCIDENT_NODE_NOT_READY  = "node-not-ready"
+	INCIDENT_KUBELET_RESTART = "kubelet-restart"
+)
+
+const NODE_PROMPT = `Kubernetes node %s %s. Analyze the node rather than the individual applications: the likely cause (kubelet or container runtime failure, resource pressure, network partition, kernel or hardware problem, a reboot or upgrade), its impact on the pods it runs, and what to check or change on the node.
+
+Node:
+%s
+
+Node conditions:
+%s
+
+Node capacity:
+%s
+
+Pods on the node that are not ready:
+%s
+
+Node events:
+%s`
+
+// NodeConfig turns on watching Node conditions and kubelet restarts, and
+// control-plane pods that excludeNamespaces would otherwise skip.
+type NodeConfig struct {
+	Enabled      bool   `json:"enabled"`
+	ControlPlane bool   `json:"controlPlane"`
+	SlackChannel string `json:"slackChannel"`
+}
+
+// nodeIncident is a NotReady node still waiting to become Ready again. The
+// incident is set once its analysis is done.
+type nodeIncident struct {
+	Incident *Incident
+	Alerted  bool
+	Since    time.Time
+}
+
+var nodesMu sync.Mutex
+
+var controlPlaneComponents = map[string]bool{
+	"kube-apiserver":          true,
+	"kube-controller-manager": true,
+	"kube-scheduler":          true,
+	"etcd":                    true,
+}
+
+// isControlPlanePod matches the static pods kubeadm and most distributions
+// run the control plane in: mirror pods owned by their Node, or labelled as
+// a control-plane component.
+func isControlPlanePod(pod *corev1.Pod) bool {
+	if pod.Namespace != v1.NamespaceSystem {
+		return false
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "Node" {
+			return true
+		}
+	}
+	return pod.Labels["tier"] == "control-plane" || controlPlaneComponents[pod.Labels["component"]]
+}
+
+// watchesControlPlane reports whether the pod is a control-plane pod the
+// node mode watches even in an excluded namespace.
+func (c *Config) watchesControlPlane(pod *corev1.Pod) bool {
+	return c.Nodes.Enabled && c.Nodes.ControlPlane && isControlPlanePod(pod)
+}
+
+func (c *Config) nodeChannel() string {
+	if c.Nodes.SlackChannel != "" {
+		return c.Nodes.SlackChannel
+	}
+	return c.SlackChannel
+}
+
+// watchNodes alerts when a node turns NotReady and when its kubelet restarts,
+// and follows up in the thread once the node is Ready again.
+func watchNodes(clientset kubernetes.Interface) {
+	ready := map[string]bool{}
+	notReady := map[string]*nodeIncident{}
+	seenEvents := map[string]bool{}
+	started := time.Now()
+	var err error
+	for {
+		time.Sleep(pollDelay("nodes", err))
+		err = nil
+		config := cfg()
+		if !config.Nodes.Enabled || !allowed("", "list", "nodes") {
+			continue
+		}
+
+		var nodes *corev1.NodeList
+		nodes, err = clientset.CoreV1().Nodes().List(context.Background(), v1.ListOptions{})
+		if err != nil {
+			log.Printf("❌ Error fetching nodes: %v", err)
+			continue
+		}
+		for i := range nodes.Items {
+			node := &nodes.Items[i]
+			cond := nodeReadyCondition(node)
+			isReady := cond != nil && cond.Status == corev1.ConditionTrue
+			wasReady, known := ready[node.Name]
+			ready[node.Name] = isReady
+
+			switch {
+			case known && wasReady && !isReady:
+				log.Printf("🖥️ Detected node NotReady: %s", node.Name)
+				reason := "became NotReady"
+				if cond != nil && cond.Message != "" {
+					reason += " (" + cond.Message + ")"
+				}
+				n := &nodeIncident{Since: time.Now()}
+				notReady[node.Name] = n
+				go func(node *corev1.Node) {
+					inc, alerted := analyzeNode(clientset, node, INCIDENT_NODE_NOT_READY, reason, n.Since)
+					nodesMu.Lock()
+					n.Incident, n.Alerted = inc, alerted
+					nodesMu.Unlock()
+				}(node)
+			case isReady && notReady[node.Name] != nil:
+				n := notReady[node.Name]
+				nodesMu.Lock()
+				inc := n.Incident
+				nodesMu.Unlock()
+				if inc == nil {
+					// Still being analyzed; resolve on a later check.
+					continue
+				}
+				resolveNode(config, n)
+				delete(notReady, node.Name)
+			}
+		}
+
+		events, err := clientset.CoreV1().Events("").List(context.Background(), v1.ListOptions{
+			FieldSelector: "involvedObject.kind=Node",
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to get node events: %v", err)
+			continue
+		}
+		for _, e := range events.Items {
+			if seenEvents[string(e.UID)] || !collector.EventTime(e).After(started) || !kubeletRestart(e) {
+				continue
+			}
+			seenEvents[string(e.UID)] = true
+			log.Printf("🖥️ Detected kubelet restart on node %s", e.InvolvedObject.Name)
+			node, err := clientset.CoreV1().Nodes().Get(context.Background(), e.InvolvedObject.Name, v1.GetOptions{})
+			if err != nil {
+				log.Printf("⚠️ Failed to get node %s: %v", e.InvolvedObject.Name, err)
+				continue
+			}
+			what := "had its kubelet restart"
+			if e.Reason == "Rebooted" {
+				what = "was rebooted"
+			}
+			go analyzeNode(clientset, node, INCIDENT_KUBELET_RESTART, what, collector.EventTime(e))
+		}
+	}
+}
+
+// kubeletRestart matches the events a kubelet records when it starts, and
+// when it finds the node rebooted.
+func kubeletRestart(e corev1.Event) bool {
+	return e.Source.Component == "kubelet" && (e.Reason == "Starting" || e.Reason == "Rebooted")
+}
+
+func nodeReadyCondition(node *corev1.Node) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == corev1.NodeReady {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// nodeEvents returns the node's events within the lookback, oldest first.
+func nodeEvents(ctx context.Context, clientset kubernetes.Interface, nodeName string, since time.Time) []corev1.Event {
+	list, err := clientset.CoreV1().Events("").List(ctx, v1.ListOptions{
+		FieldSelector: "involvedObject.kind=Node,involvedObject.name=" + nodeName,
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to get events for node %s: %v", nodeName, err)
+		return nil
+	}
+	var events []corev1.Event
+	for _, e := range list.Items {
+		if collector.EventTime(e).After(since) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return collector.EventTime(events[i]).Before(collector.EventTime(events[j])) })
+	return events
+}
+
+// unreadyPods lists the pods scheduled on the node that are not ready.
+func unreadyPods(ctx context.Context, clientset kubernetes.Interface, nodeName string) string {
+	pods, err := clientset.CoreV1().Pods("").List(ctx, v1.ListOptions{FieldSelector: "spec.nodeName=" + nodeName})
+	if err != nil {
+		return fmt.Sprintf("unknown: %v", err)
+	}
+	var lines []string
+	for _, p := range pods.Items {
+		for _, c := range p.Status.Conditions {
+			if c.Type == corev1.PodReady && c.Status != corev1.ConditionTrue {
+				lines = append(lines, fmt.Sprintf("%s/%s: %s %s", p.Namespace, p.Name, p.Status.Phase, c.Reason))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "none"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// analyzeNode runs a node incident through the model and alerts on it,
+// unless a maintenance window silences it.
+func analyzeNode(clientset kubernetes.Interface, node *corev1.Node, incidentType, what string, at time.Time) (inc *Incident, alerted bool) {
+	config := cfg().forIncident(incidentType)
+	ctx, cancel := within(context.Background(), config.Timeouts.Analysis)
+	defer cancel()
+	ctx = withUsage(ctx, "")
+
+	// Node incidents have no namespace, so no PodIncident is created for them.
+	inc = &Incident{
+		ID:        fmt.Sprintf("node-%s-%s-%d", node.Name, incidentType, at.Unix()),
+		Type:      incidentType,
+		Severity:  severityOf(incidentType),
+		Pod:       node.Name,
+		Workload:  "node/" + node.Name,
+		Reason:    what,
+		Signature: signatureOf("node", node.Name, incidentType),
+		Time:      at,
+	}
+	if silence(config, inc) {
+		recordIncident(inc)
+		return inc, false
+	}
+
+	info := node.Status.NodeInfo
+	details := fmt.Sprintf("kubelet %s, container runtime %s, kernel %s, OS %s",
+		info.KubeletVersion, info.ContainerRuntimeVersion, info.KernelVersion, info.OSImage)
+	conditions := formatNodeConditions(node)
+	capacity := fmt.Sprintf("allocatable cpu %s, memory %s, ephemeral-storage %s, pods %s",
+		node.Status.Allocatable.Cpu(), node.Status.Allocatable.Memory(),
+		node.Status.Allocatable.StorageEphemeral(), node.Status.Allocatable.Pods())
+	pods := unreadyPods(ctx, clientset, node.Name)
+	events := nodeEvents(ctx, clientset, node.Name, time.Now().Add(-config.EventLookback.Duration))
+
+	prompt := fmt.Sprintf(NODE_PROMPT, node.Name, what, details, conditions, capacity, pods, collector.FormatEvents(events)) + languageInstruction(config.Language)
+	analysis, err := callModel(ctx, config, prompt)
+	if err != nil {
+		log.Printf("❌ Failed to analyze node %s: %v", node.Name, err)
+		analysis = fmt.Sprintf("⚠️ *AI analysis unavailable* (%v).", err)
+	}
+
+	title := "*🖥️ Node NotReady!*\n"
+	if incidentType == INCIDENT_KUBELET_RESTART {
+		title = "*🖥️ Kubelet Restarted!*\n"
+	}
+	channel := config.nodeChannel()
+	threadTS := postToSlack(map[string]interface{}{
+		"channel": channel,
+		"text": title +
+			fmt.Sprintf("> *Node:* `%s`\n", node.Name) +
+			fmt.Sprintf("> *What:* %s\n", what) +
+			fmt.Sprintf("> *Detected At:* `%s`", at.Format("2006-01-02 15:04:05")),
+	})
+	if threadTS != "" {
+		slack := localized(formatterFor(FORMAT_MRKDWN), config.Language)
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "🖥️", Title: "Node", Body: details + "\n" + conditions + "\n" + capacity}))
+		sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "📦", Title: "Pods not ready", Body: pods}))
+		if len(events) > 0 {
+			sendSlackThread(channel, threadTS, slack.Section(viewSection{Emoji: "📋", Title: "Node events", Body: collector.FormatEvents(events)}))
+		}
+		sendSlackThread(channel, threadTS, slack.Section(analysisSection(analysis)))
+	}
+
+	inc.Events, inc.Resources, inc.Analysis = events, conditions, analysis
+	inc.Channel, inc.ThreadTS = channel, threadTS
+	inc.PromptTokens, inc.ResponseTokens = usageOf(ctx)
+	recordIncident(inc)
+	notify(config, inc)
+	return inc, true
+}
+
+// resolveNode follows up on a NotReady node that is Ready again.
+func resolveNode(config *Config, n *nodeIncident) {
+	inc := n.Incident
+	log.Printf("✅ Node %s is Ready again", inc.Pod)
+	incidentsMu.Lock()
+	inc.Resolved = time.Now()
+	incidentsMu.Unlock()
+	if !n.Alerted {
+		return
+	}
+	if inc.ThreadTS != "" {
+		sendSlackThread(inc.Channel, inc.ThreadTS, fmt.Sprintf("✅ *Resolved:* node `%s` is Ready again after %s.",
+			inc.Pod, time.Since(n.Since).Round(time.Second)))
+	}
+	for _, nt := range notifiers(config) {
+		if r, ok := nt.(Resolver); ok {
+			if err := r.Resolve(inc); err != nil {
+				log.Printf("❌ Failed to resolve %s incident for node %s: %v", nt.Name(), inc.Pod, err)
+			}
+		}
+	}
+}
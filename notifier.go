@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// Notifier delivers incidents to a destination other than the Slack thread,
+// which stays the primary, interactive channel.
+type Notifier interface {
+	Name() string
+	Notify(inc *Incident) error
+}
+
+// Resolver is implemented by notifiers that track incident state and can
+// close the incident once the workload recovers.
+type Resolver interface {
+	Resolve(inc *Incident) error
+}
+
+// Updater is implemented by notifiers that keep a copy of the incident and
+// rewrite it when its analysis arrives after the alert.
+type Updater interface {
+	Update(inc *Incident) error
+}
+
+// notifiers returns the destinations enabled in the current config, so they
+// follow config reloads.
+func notifiers(config *Config) []Notifier {
+	var list []Notifier
+	if config.Archive.Bucket != "" {
+		list = append(list, &ArchiveNotifier{config: config.Archive})
+	}
+	if config.Email.SMTPHost != "" {
+		list = append(list, &EmailNotifier{config: config.Email})
+	}
+	for _, h := range config.Hooks.Sinks {
+		list = append(list, &ExecHook{config: h})
+	}
+	if os.Getenv("OPSGENIE_API_KEY") != "" {
+		list = append(list, &OpsgenieNotifier{})
+	}
+	if os.Getenv("ONCALL_API_KEY") != "" && os.Getenv("ONCALL_ROUTING_KEY") != "" {
+		list = append(list, &OnCallNotifier{})
+	}
+	return list
+}
+
+func notify(config *Config, inc *Incident) {
+	for _, n := range notifiers(config) {
+		if err := n.Notify(inc); err != nil {
+			log.Printf("❌ Failed to send %s notification for %s [%s]: %v", n.Name(), inc.Pod, inc.Namespace, err)
+		}
+	}
+}
+
+func notifyUpdate(config *Config, inc *Incident) {
+	for _, n := range notifiers(config) {
+		if u, ok := n.(Updater); ok {
+			if err := u.Update(inc); err != nil {
+				log.Printf("❌ Failed to update %s copy of %s [%s]: %v", n.Name(), inc.Pod, inc.Namespace, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ghulevishal/pod-analyzer/internal/notifier"
+)
+
+// OnCallNotifier raises incidents in Splunk On-Call (VictorOps) through the
+// REST endpoint integration. The crash signature is the entity_id, which
+// On-Call uses to fold repeated alerts into one incident and to match the
+// RECOVERY message. Configured with ONCALL_API_KEY and ONCALL_ROUTING_KEY.
+type OnCallNotifier struct{}
+
+func (n *OnCallNotifier) Name() string {
+	return "Splunk On-Call"
+}
+
+func (n *OnCallNotifier) Notify(inc *Incident) error {
+	return oncallAlert(map[string]interface{}{
+		"message_type":        "CRITICAL",
+		"entity_id":           alertAlias(inc),
+		"entity_display_name": fmt.Sprintf("%s: %s/%s (%s)", incidentTitle(inc.Type), inc.Namespace, inc.Workload, inc.cause()),
+		"state_message":       truncate(formatterFor(FORMAT_TEXT).Section(analysisSection(inc.Analysis)), 10000),
+		"monitoring_tool":     "pod-analyzer",
+		"namespace":           inc.Namespace,
+		"pod":                 inc.Pod,
+		"reason":              inc.Reason,
+	})
+}
+
+func (n *OnCallNotifier) Resolve(inc *Incident) error {
+	return oncallAlert(map[string]interface{}{
+		"message_type":    "RECOVERY",
+		"entity_id":       alertAlias(inc),
+		"state_message":   fmt.Sprintf("%s/%s is healthy again.", inc.Namespace, inc.Workload),
+		"monitoring_tool": "pod-analyzer",
+	})
+}
+
+func oncallAlert(payload map[string]interface{}) error {
+	if *dryRun {
+		fmt.Printf("----- [dry-run] Splunk On-Call %s %s\n", payload["message_type"], payload["entity_id"])
+		return nil
+	}
+	oncall := &notifier.OnCall{
+		BaseURL:    os.Getenv("ONCALL_API_URL"),
+		APIKey:     os.Getenv("ONCALL_API_KEY"),
+		RoutingKey: os.Getenv("ONCALL_ROUTING_KEY"),
+		Client:     trackers,
+	}
+	return oncall.Send(context.Background(), payload)
+}
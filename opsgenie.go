@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ghulevishal/pod-analyzer/internal/notifier"
+)
+
+// OpsgenieNotifier opens one alert per crash signature: the signature is the
+// alert alias, so repeated crashes bump the count of the open alert instead
+// of paging again. Configured with OPSGENIE_API_KEY (and OPSGENIE_API_URL for
+// the EU instance).
+type OpsgenieNotifier struct{}
+
+func (n *OpsgenieNotifier) Name() string {
+	return "Opsgenie"
+}
+
+func (n *OpsgenieNotifier) Notify(inc *Incident) error {
+	details := map[string]string{
+		"namespace": inc.Namespace,
+		"pod":       inc.Pod,
+		"workload":  inc.Workload,
+		"type":      inc.Type,
+		"reason":    inc.Reason,
+	}
+	if inc.Container != "" {
+		details["container"] = inc.Container
+	}
+	if inc.Category != "" {
+		details["category"] = inc.Category
+	}
+	payload := map[string]interface{}{
+		"message":     truncate(fmt.Sprintf("%s: %s/%s (%s)", incidentTitle(inc.Type), inc.Namespace, inc.Workload, inc.cause()), 110),
+		"alias":       alertAlias(inc),
+		"description": truncate(formatterFor(FORMAT_TEXT).Section(analysisSection(inc.Analysis)), 14000),
+		"entity":      inc.Namespace + "/" + inc.Workload,
+		"source":      "pod-analyzer",
+		"tags":        []string{"pod-analyzer", inc.Type, inc.Namespace},
+		"details":     details,
+		"priority":    "P3",
+	}
+	if *dryRun {
+		fmt.Printf("----- [dry-run] Opsgenie alert %s: %s\n", payload["alias"], payload["message"])
+		return nil
+	}
+	return opsgenie().Open(context.Background(), payload)
+}
+
+func (n *OpsgenieNotifier) Resolve(inc *Incident) error {
+	if *dryRun {
+		fmt.Printf("----- [dry-run] close Opsgenie alert %s\n", alertAlias(inc))
+		return nil
+	}
+	return opsgenie().Close(context.Background(), alertAlias(inc), fmt.Sprintf("%s/%s is healthy again.", inc.Namespace, inc.Workload))
+}
+
+func opsgenie() *notifier.Opsgenie {
+	return &notifier.Opsgenie{BaseURL: os.Getenv("OPSGENIE_API_URL"), APIKey: os.Getenv("OPSGENIE_API_KEY"), Client: trackers}
+}
+
+// alertAlias identifies the paging-tool incident of a crash signature.
+func alertAlias(inc *Incident) string {
+	return "pod-analyzer-" + inc.Signature
+}
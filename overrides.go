@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	RESTART_THRESHOLD_ANNOTATION = "pod-analyzer.io/restart-threshold"
+	MIN_SEVERITY_ANNOTATION      = "pod-analyzer.io/min-severity"
+	OVERRIDES_CACHE_TTL          = 5 * time.Minute
+
+	SEVERITY_INFO     = "info"
+	SEVERITY_WARNING  = "warning"
+	SEVERITY_CRITICAL = "critical"
+)
+
+var severityLevels = map[string]int{
+	SEVERITY_INFO:     0,
+	SEVERITY_WARNING:  1,
+	SEVERITY_CRITICAL: 2,
+}
+
+// workloadOverrides are the detection settings a workload sets for itself
+// with annotations, so a noisy but known workload can raise the bar without
+// a change to the global config or its namespace's rule.
+type workloadOverrides struct {
+	RestartThreshold int32
+	MinSeverity      string
+	fetched          time.Time
+}
+
+var (
+	overridesMu    sync.Mutex
+	overridesCache = map[string]workloadOverrides{}
+)
+
+// severityOf ranks incident types: a workload that is down or cannot get
+// pods at all is critical, a single failure a warning. Expected restarts
+// that are only recorded are info.
+func severityOf(incidentType string) string {
+	switch incidentType {
+	case INCIDENT_FLAPPING, INCIDENT_START_FAILURE, INCIDENT_NODE_NOT_READY, INCIDENT_ADMISSION:
+		return SEVERITY_CRITICAL
+	}
+	return SEVERITY_WARNING
+}
+
+// allows reports whether an incident of the severity is alerted on.
+func (o workloadOverrides) allows(severity string) bool {
+	return o.MinSeverity == "" || severityLevels[severity] >= severityLevels[o.MinSeverity]
+}
+
+// restartThresholdFor is the restart count from which a container of the pod
+// is analyzed: its workload's annotation, else its namespace's rule.
+func restartThresholdFor(clientset kubernetes.Interface, pod *corev1.Pod) int32 {
+	if o := overridesFor(clientset, pod); o.RestartThreshold > 0 {
+		return o.RestartThreshold
+	}
+	return ruleFor(pod.Namespace).restartThreshold()
+}
+
+// overridesFor reads the annotations of the pod's Deployment, StatefulSet or
+// DaemonSet, falling back to the pod's own (i.e. its template's) for other
+// controllers or without permission to get the workload. Results are cached
+// per workload.
+func overridesFor(clientset kubernetes.Interface, pod *corev1.Pod) workloadOverrides {
+	kind, name := podController(pod)
+	key := pod.Namespace + "/" + kind + "/" + name
+	overridesMu.Lock()
+	o, ok := overridesCache[key]
+	overridesMu.Unlock()
+	if ok && time.Since(o.fetched) < OVERRIDES_CACHE_TTL {
+		return o
+	}
+
+	annotations := map[string]string{}
+	for k, v := range pod.Annotations {
+		annotations[k] = v
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	meta, err := workloadMeta(ctx, clientset, pod)
+	if err != nil {
+		log.Printf("⚠️ Failed to get %s %s/%s for its annotations: %v", kind, pod.Namespace, name, err)
+	}
+	if meta != nil {
+		for k, v := range meta.Annotations {
+			annotations[k] = v
+		}
+	}
+
+	o = workloadOverrides{fetched: time.Now()}
+	if v := annotations[RESTART_THRESHOLD_ANNOTATION]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Printf("❌ Invalid %s %q on %s, using the default", RESTART_THRESHOLD_ANNOTATION, v, key)
+		} else {
+			o.RestartThreshold = int32(n)
+		}
+	}
+	if v := annotations[MIN_SEVERITY_ANNOTATION]; v != "" {
+		if _, known := severityLevels[v]; !known {
+			log.Printf("❌ Invalid %s %q on %s, expected info, warning or critical", MIN_SEVERITY_ANNOTATION, v, key)
+		} else {
+			o.MinSeverity = v
+		}
+	}
+	overridesMu.Lock()
+	overridesCache[key] = o
+	overridesMu.Unlock()
+	return o
+}
+
+// workloadMeta gets the metadata of the pod's Deployment, StatefulSet or
+// DaemonSet. It returns nil for other controllers and without permission to
+// get the workload.
+func workloadMeta(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) (*v1.ObjectMeta, error) {
+	kind, name := podController(pod)
+	apps := clientset.AppsV1()
+	switch {
+	case kind == "Deployment" && allowed(pod.Namespace, "get", "deployments.apps"):
+		d, err := apps.Deployments(pod.Namespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &d.ObjectMeta, nil
+	case kind == "StatefulSet" && allowed(pod.Namespace, "get", "statefulsets.apps"):
+		s, err := apps.StatefulSets(pod.Namespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &s.ObjectMeta, nil
+	case kind == "DaemonSet" && allowed(pod.Namespace, "get", "daemonsets.apps"):
+		d, err := apps.DaemonSets(pod.Namespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &d.ObjectMeta, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const SERVICE_ACCOUNT_NAMESPACE = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+var namespaced = flag.Bool("namespaced", false, "only query the configured namespaces (default: the analyzer's own), so a Role per namespace is enough instead of a ClusterRole")
+
+// permission is one access the analyzer uses, and what it loses without it.
+type permission struct {
+	Verb          string
+	Group         string
+	Resource      string
+	ClusterScoped bool
+	Required      bool
+	Without       string
+}
+
+var permissions = []permission{
+	{Verb: "list", Resource: "pods", Required: true},
+	{Verb: "get", Resource: "pods/log", Without: "logs are left out of the analysis"},
+	{Verb: "list", Resource: "events", Without: "events are left out of the analysis"},
+	{Verb: "create", Resource: "events", Without: "no diagnosis events are recorded on pods"},
+	{Verb: "list", Group: "batch", Resource: "jobs", Without: "failed Jobs are not detected"},
+	{Verb: "get", Group: "metrics.k8s.io", Resource: "pods", Without: "no CPU and memory usage"},
+	{Verb: "get", Resource: "persistentvolumeclaims", Without: "no storage diagnostics"},
+	{Verb: "get", Resource: "configmaps", Without: "ConfigMap updates are not correlated"},
+	{Verb: "get", Resource: "secrets", Without: "Secret updates are not correlated"},
+	{Verb: "list", Group: "apps", Resource: "replicasets", Without: "rollouts are not correlated"},
+	{Verb: "get", Group: "apps", Resource: "replicasets", Without: "no pod template security settings for admission denials"},
+	{Verb: "get", Group: "apps", Resource: "deployments", Without: "annotations on Deployments are not read, only those on their pods"},
+	{Verb: "get", Group: "apps", Resource: "statefulsets", Without: "annotations on StatefulSets are not read, only those on their pods"},
+	{Verb: "get", Group: "apps", Resource: "daemonsets", Without: "annotations on DaemonSets are not read, only those on their pods"},
+	{Verb: "get", Group: "argoproj.io", Resource: "rollouts", Without: "Argo Rollouts status is not shown"},
+	{Verb: "patch", Group: "argoproj.io", Resource: "rollouts", Without: "crash-looping canaries are not paused (delivery.pauseRollouts)"},
+	{Verb: "get", Group: "argoproj.io", Resource: "applications", Without: "ArgoCD sync status is not shown"},
+	{Verb: "get", Group: "kustomize.toolkit.fluxcd.io", Resource: "kustomizations", Without: "Flux Kustomization status is not shown"},
+	{Verb: "get", Group: "helm.toolkit.fluxcd.io", Resource: "helmreleases", Without: "Flux HelmRelease status is not shown"},
+	{Verb: "list", Resource: "services", Without: "incidents are not correlated by service dependencies"},
+	{Verb: "get", Resource: "services", Without: "network errors are not matched to Services"},
+	{Verb: "get", Resource: "endpoints", Without: "no endpoint readiness for network errors"},
+	{Verb: "list", Group: "networking.k8s.io", Resource: "networkpolicies", Without: "no NetworkPolicies for network errors"},
+	{Verb: "list", Group: "autoscaling", Resource: "horizontalpodautoscalers", Without: "no autoscaler context"},
+	{Verb: "get", Resource: "nodes", ClusterScoped: true, Without: "no node conditions for evictions"},
+	{Verb: "list", Resource: "nodes", ClusterScoped: true, Without: "nodes are not monitored"},
+	{Verb: "get", Resource: "nodes/proxy", ClusterScoped: true, Without: "no volume usage"},
+	{Verb: "get", Resource: "persistentvolumes", ClusterScoped: true, Without: "no details of bound volumes"},
+	{Verb: "get", Resource: "namespaces", ClusterScoped: true, Without: "tenants are only selected by their namespaces list"},
+}
+
+var (
+	permissionsMu sync.RWMutex
+	forbidden     = map[string]bool{}
+)
+
+// qualified is the resource as allowed expects it, e.g. "jobs.batch".
+func (p permission) qualified() string {
+	if p.Group == "" {
+		return p.Resource
+	}
+	return p.Resource + "." + p.Group
+}
+
+func (p permission) String() string {
+	return p.Verb + " " + p.qualified()
+}
+
+func permissionKey(namespace, verb, resource string) string {
+	return namespace + "|" + verb + "|" + resource
+}
+
+// checkPermissions reviews every permission the analyzer uses and reports
+// what is missing. Missing optional permissions only switch off the context
+// that depends on them; without pods list there is nothing to monitor.
+func checkPermissions(clientset kubernetes.Interface) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	missing := 0
+	for _, p := range permissions {
+		scopes := watchedNamespaces(cfg())
+		if p.ClusterScoped {
+			scopes = []string{""}
+		}
+		for _, ns := range scopes {
+			ok, err := accessReview(ctx, clientset, p.Verb, p.Group, p.Resource, ns)
+			if err != nil {
+				log.Printf("⚠️ Permission self-check unavailable, assuming full access: %v", err)
+				return
+			}
+			if ok {
+				continue
+			}
+			where := "cluster-wide"
+			if ns != "" {
+				where = "in namespace " + ns
+			}
+			if p.Required {
+				log.Fatalf("❌ Missing required permission %s %s: grant it in the ClusterRole, or in a Role per namespace with --namespaced", p, where)
+			}
+			permissionsMu.Lock()
+			forbidden[permissionKey(ns, p.Verb, p.qualified())] = true
+			permissionsMu.Unlock()
+			log.Printf("⚠️ Missing permission %s %s: %s", p, where, p.Without)
+			missing++
+		}
+	}
+	if missing == 0 {
+		log.Println("✅ Permission self-check passed")
+	} else {
+		log.Printf("⚠️ Permission self-check: %d permission(s) missing, running with reduced context", missing)
+	}
+}
+
+// allowed reports whether the self-check found the permission granted in the
+// namespace; permissions it did not check are assumed granted. The resource
+// carries its API group, as in "jobs.batch".
+func allowed(namespace, verb, resource string) bool {
+	permissionsMu.RLock()
+	defer permissionsMu.RUnlock()
+	return !forbidden[permissionKey("", verb, resource)] && !forbidden[permissionKey(namespace, verb, resource)]
+}
+
+// watchedNamespaces lists the namespaces to query: all of them at once, or
+// with --namespaced the configured ones, defaulting to the analyzer's own.
+func watchedNamespaces(config *Config) []string {
+	if !*namespaced {
+		return []string{v1.NamespaceAll}
+	}
+	if len(config.Namespaces) > 0 {
+		return config.Namespaces
+	}
+	return []string{ownNamespace()}
+}
+
+func ownNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := ioutil.ReadFile(SERVICE_ACCOUNT_NAMESPACE); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return v1.NamespaceDefault
+}
+
+func listPods(ctx context.Context, clientset kubernetes.Interface) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	for _, ns := range watchedNamespaces(cfg()) {
+		list, err := clientset.CoreV1().Pods(ns).List(ctx, v1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, list.Items...)
+	}
+	return pods, nil
+}
+
+func listJobs(ctx context.Context, clientset kubernetes.Interface) ([]batchv1.Job, error) {
+	var jobs []batchv1.Job
+	for _, ns := range watchedNamespaces(cfg()) {
+		if !allowed(ns, "list", "jobs.batch") {
+			continue
+		}
+		list, err := clientset.BatchV1().Jobs(ns).List(ctx, v1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, list.Items...)
+	}
+	return jobs, nil
+}
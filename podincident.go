@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const INCIDENT_LOG_EXCERPT = 4000
+
+var (
+	incidentResource     = schema.GroupVersionResource{Group: "pod-analyzer.io", Version: "v1alpha1", Resource: "podincidents"}
+	incidentCRDInstalled bool
+)
+
+func detectIncidentCRD(clientset kubernetes.Interface) {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(RULE_GROUP_VERSION)
+	if err != nil {
+		return
+	}
+	for _, r := range resources.APIResources {
+		if r.Name != incidentResource.Resource {
+			continue
+		}
+		if *readOnly {
+			log.Println("🔒 Read-only mode: PodIncident CRD found, but incidents are not recorded as resources")
+			return
+		}
+		incidentCRDInstalled = true
+		log.Println("🗂️ Recording incidents as PodIncident resources")
+		return
+	}
+}
+
+// publishIncident stores the incident as a PodIncident next to the pod, with
+// the collected context and the analysis in its status.
+func publishIncident(ctx context.Context, dyn dynamic.Interface, inc *Incident) {
+	if !incidentCRDInstalled {
+		return
+	}
+	if *dryRun {
+		log.Printf("🧪 [dry-run] would create PodIncident for %s [%s]", inc.Pod, inc.Namespace)
+		return
+	}
+
+	name := podIncidentName(inc)
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": RULE_GROUP_VERSION,
+		"kind":       "PodIncident",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": inc.Namespace,
+			"labels": map[string]interface{}{
+				"pod-analyzer.io/workload":  labelValue(inc.Workload),
+				"pod-analyzer.io/type":      inc.Type,
+				"pod-analyzer.io/signature": inc.Signature,
+			},
+		},
+		"spec": map[string]interface{}{
+			"podName":       inc.Pod,
+			"workload":      inc.Workload,
+			"container":     inc.Container,
+			"type":          inc.Type,
+			"signature":     inc.Signature,
+			"reason":        inc.Reason,
+			"exitCode":      int64(inc.ExitCode),
+			"category":      inc.Category,
+			"detectedAt":    inc.Time.UTC().Format(time.RFC3339),
+			"promptVersion": inc.PromptVersion,
+		},
+	}}
+
+	client := dyn.Resource(incidentResource).Namespace(inc.Namespace)
+	created, err := client.Create(ctx, obj, v1.CreateOptions{})
+	if err != nil {
+		log.Printf("❌ Failed to create PodIncident %s/%s: %v", inc.Namespace, name, err)
+		return
+	}
+
+	events := []interface{}{}
+	for _, line := range strings.Split(collector.FormatEvents(inc.Events), "\n") {
+		if line != "" {
+			events = append(events, line)
+		}
+	}
+	created.Object["status"] = map[string]interface{}{
+		"phase":      "Analyzed",
+		"events":     events,
+		"resources":  inc.Resources,
+		"logExcerpt": tail(inc.Logs, INCIDENT_LOG_EXCERPT),
+		"analysis":   inc.Analysis,
+		"slackTS":    inc.ThreadTS,
+	}
+	if _, err := client.UpdateStatus(ctx, created, v1.UpdateOptions{}); err != nil {
+		log.Printf("❌ Failed to write status of PodIncident %s/%s: %v", inc.Namespace, name, err)
+	}
+}
+
+// updateIncidentAnalysis writes an analysis that arrived after the alert,
+// from the retry queue or a deep analysis, into the PodIncident.
+func updateIncidentAnalysis(ctx context.Context, dyn dynamic.Interface, inc *Incident) {
+	if !incidentCRDInstalled || *dryRun {
+		return
+	}
+	client := dyn.Resource(incidentResource).Namespace(inc.Namespace)
+	obj, err := client.Get(ctx, podIncidentName(inc), v1.GetOptions{})
+	if err != nil {
+		log.Printf("⚠️ Failed to get PodIncident %s/%s: %v", inc.Namespace, podIncidentName(inc), err)
+		return
+	}
+	incidentsMu.Lock()
+	unstructured.SetNestedField(obj.Object, inc.Category, "spec", "category")
+	unstructured.SetNestedField(obj.Object, inc.PromptVersion, "spec", "promptVersion")
+	analysis := inc.Analysis
+	incidentsMu.Unlock()
+	updated, err := client.Update(ctx, obj, v1.UpdateOptions{})
+	if err != nil {
+		log.Printf("❌ Failed to update PodIncident %s/%s: %v", inc.Namespace, obj.GetName(), err)
+		return
+	}
+	unstructured.SetNestedField(updated.Object, analysis, "status", "analysis")
+	if _, err := client.UpdateStatus(ctx, updated, v1.UpdateOptions{}); err != nil {
+		log.Printf("❌ Failed to write status of PodIncident %s/%s: %v", inc.Namespace, obj.GetName(), err)
+	}
+}
+
+// markIncidentResolved moves a PodIncident to the Resolved phase once its
+// workload has recovered.
+func markIncidentResolved(ctx context.Context, dyn dynamic.Interface, inc *Incident) {
+	if !incidentCRDInstalled || *dryRun {
+		return
+	}
+	client := dyn.Resource(incidentResource).Namespace(inc.Namespace)
+	obj, err := client.Get(ctx, podIncidentName(inc), v1.GetOptions{})
+	if err != nil {
+		log.Printf("⚠️ Failed to get PodIncident %s/%s: %v", inc.Namespace, podIncidentName(inc), err)
+		return
+	}
+	status, _ := obj.Object["status"].(map[string]interface{})
+	if status == nil {
+		status = map[string]interface{}{}
+	}
+	status["phase"] = "Resolved"
+	status["resolvedAt"] = inc.Resolved.UTC().Format(time.RFC3339)
+	obj.Object["status"] = status
+	if _, err := client.UpdateStatus(ctx, obj, v1.UpdateOptions{}); err != nil {
+		log.Printf("❌ Failed to write status of PodIncident %s/%s: %v", inc.Namespace, obj.GetName(), err)
+	}
+}
+
+// podIncidentName is unique per pod, container and failure, so two
+// containers of a pod crashing in the same second get separate resources.
+// Overlong names lose the end of the pod and container part, never the
+// signature and timestamp that keep them unique.
+func podIncidentName(inc *Incident) string {
+	name := inc.Pod
+	if inc.Container != "" {
+		name += "-" + inc.Container
+	}
+	suffix := fmt.Sprintf("-%d", inc.Time.Unix())
+	if len(inc.Signature) >= 6 {
+		suffix = "-" + inc.Signature[:6] + suffix
+	}
+	if len(name) > 253-len(suffix) {
+		name = name[:253-len(suffix)]
+	}
+	return strings.Trim(name, "-.") + suffix
+}
+
+func labelValue(s string) string {
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-_.")
+}
+
+func tail(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return "(truncated) ..." + s[len(s)-limit:]
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var readOnly = flag.Bool("read-only", false, "never change anything in the cluster: refuse every API request but get, list and watch, switch off remediation, diagnosis events, PodIncidents and the thread ConfigMap, and fail at startup if the service account may do more")
+
+var (
+	readOnlyVerbs = []string{"get", "list", "watch"}
+
+	// Subresources that run or reach into a container, whatever the verb:
+	// exec and attach are upgraded from a GET by websocket clients.
+	execSubresources = []string{"exec", "attach", "portforward"}
+
+	// Reviews of the analyzer's own access are POSTs but create nothing.
+	selfReviews = []string{"selfsubjectaccessreviews", "selfsubjectrulesreviews"}
+)
+
+// readOnlyTransport refuses every API request that could change the cluster
+// or run something in a container, so read-only mode holds even for code
+// paths that do not check the flag.
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	for _, sub := range execSubresources {
+		if strings.HasSuffix(path, "/"+sub) {
+			return nil, fmt.Errorf("read-only mode: refusing %s %s", req.Method, req.URL.Path)
+		}
+	}
+	switch {
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+	case req.Method == http.MethodPost && isSelfReview(path):
+	default:
+		return nil, fmt.Errorf("read-only mode: refusing %s %s", req.Method, req.URL.Path)
+	}
+	return t.next.RoundTrip(req)
+}
+
+func isSelfReview(path string) bool {
+	if !strings.HasPrefix(path, "/apis/authorization.k8s.io/") {
+		return false
+	}
+	return containsString(selfReviews, path[strings.LastIndex(path, "/")+1:])
+}
+
+// verifyReadOnly asks the API server what the service account may do in the
+// watched namespaces and exits if any rule allows more than get, list and
+// watch, or any access to exec, attach or port-forward, so that a read-only
+// deployment is read-only because of its RBAC and not only because of the
+// flag.
+func verifyReadOnly(clientset kubernetes.Interface) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	scopes := watchedNamespaces(cfg())
+	if !*namespaced {
+		// Cluster-wide grants show up in the rules of every namespace.
+		scopes = []string{ownNamespace()}
+	}
+	var violations []string
+	for _, ns := range scopes {
+		review, err := clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+			Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: ns},
+		}, v1.CreateOptions{})
+		if err != nil {
+			log.Fatalf("❌ Read-only mode: cannot review the service account's permissions in %s: %v", ns, err)
+		}
+		if review.Status.Incomplete {
+			log.Printf("⚠️ Read-only mode: the permission review in %s is incomplete (%s), rules from other authorizers are not verified", ns, review.Status.EvaluationError)
+		}
+		for _, rule := range review.Status.ResourceRules {
+			if v := readOnlyViolation(rule); v != "" {
+				violations = append(violations, fmt.Sprintf("%s in %s", v, ns))
+			}
+		}
+	}
+	if len(violations) > 0 {
+		log.Fatalf("❌ Read-only mode: the service account may change the cluster, remove these grants or drop --read-only:\n  %s", strings.Join(violations, "\n  "))
+	}
+	log.Println("🔒 Read-only mode: verified the service account can only get, list and watch")
+}
+
+// readOnlyViolation describes what the rule allows beyond reading, or ""
+// if it only reads.
+func readOnlyViolation(rule authorizationv1.ResourceRule) string {
+	var writes []string
+	for _, verb := range rule.Verbs {
+		if !containsString(readOnlyVerbs, verb) {
+			writes = append(writes, verb)
+		}
+	}
+	if len(writes) > 0 && !onlySelfReviews(rule) {
+		return fmt.Sprintf("%s on %s", strings.Join(writes, ","), describeRule(rule))
+	}
+	if coversExec(rule) {
+		return fmt.Sprintf("%s on %s (includes exec)", strings.Join(rule.Verbs, ","), describeRule(rule))
+	}
+	return ""
+}
+
+// onlySelfReviews matches the rules every authenticated user gets to review
+// their own access.
+func onlySelfReviews(rule authorizationv1.ResourceRule) bool {
+	for _, r := range rule.Resources {
+		if !containsString(selfReviews, r) && r != "selfsubjectreviews" {
+			return false
+		}
+	}
+	return len(rule.Resources) > 0
+}
+
+func coversExec(rule authorizationv1.ResourceRule) bool {
+	if !containsString(rule.APIGroups, "") && !containsString(rule.APIGroups, "*") {
+		return false
+	}
+	for _, r := range rule.Resources {
+		if r == "*" || r == "pods/*" {
+			return true
+		}
+		for _, sub := range execSubresources {
+			if r == "pods/"+sub {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeRule(rule authorizationv1.ResourceRule) string {
+	groups := make([]string, len(rule.APIGroups))
+	for i, g := range rule.APIGroups {
+		groups[i] = g
+		if g == "" {
+			groups[i] = "core"
+		}
+	}
+	s := fmt.Sprintf("%s (%s)", strings.Join(rule.Resources, ","), strings.Join(groups, ","))
+	if len(rule.ResourceNames) > 0 {
+		s += " named " + strings.Join(rule.ResourceNames, ",")
+	}
+	return s
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/analyzer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	REGISTRY_PROBE_TIMEOUT = 10 * time.Second
+	DOCKER_HUB             = "registry-1.docker.io"
+
+	REGISTRY_OK           = "ok"
+	REGISTRY_AUTH         = "auth"
+	REGISTRY_NOT_FOUND    = "not-found"
+	REGISTRY_RATE_LIMITED = "rate-limited"
+	REGISTRY_OUTAGE       = "outage"
+	REGISTRY_UNREACHABLE  = "unreachable"
+	REGISTRY_UNKNOWN      = "unknown"
+)
+
+var (
+	manifestTypes = strings.Join([]string{
+		"application/vnd.oci.image.index.v1+json",
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+	}, ", ")
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	dockerHubKeys  = []string{"https://index.docker.io/v1/", "index.docker.io", "docker.io", DOCKER_HUB}
+)
+
+type RegistryProbeConfig struct {
+	Enabled bool        `json:"enabled"`
+	Timeout v1.Duration `json:"timeout"`
+}
+
+// RegistryFinding is what the registry itself says about an image the node
+// fails to pull.
+type RegistryFinding struct {
+	Image   string
+	Verdict string
+	Detail  string
+}
+
+func (f *RegistryFinding) String() string {
+	var what string
+	switch f.Verdict {
+	case REGISTRY_OK:
+		what = "the manifest exists and the pod's pull credentials can read it, so the pull fails on the node's side"
+	case REGISTRY_AUTH:
+		what = "the registry denied access"
+	case REGISTRY_NOT_FOUND:
+		what = "the tag or digest does not exist in the repository"
+	case REGISTRY_RATE_LIMITED:
+		what = "the registry is rate-limiting pulls"
+	case REGISTRY_OUTAGE:
+		what = "the registry is failing"
+	case REGISTRY_UNREACHABLE:
+		what = "the registry could not be reached from the analyzer"
+	default:
+		what = "the registry gave an unexpected answer"
+	}
+	if f.Detail != "" {
+		what += " (" + f.Detail + ")"
+	}
+	return fmt.Sprintf("`%s`: %s", f.Image, what)
+}
+
+// refine puts the probe's finding ahead of the diagnosis guessed from the
+// pull error, and replaces the fix when the finding settles the cause.
+func (f *RegistryFinding) refine(c *analyzer.Classification) {
+	c.Summary = "*Registry probe:* " + f.String() + "\n" + c.Summary
+	switch f.Verdict {
+	case REGISTRY_OK:
+		c.Fix = "The image and credentials are fine. Check the node: egress to the registry, proxy or mirror settings of the container runtime, and whether the node sees the same pull secret."
+	case REGISTRY_AUTH:
+		c.Fix = "Add an imagePullSecret for this registry to the pod or its service account, or renew the credentials in the existing one and check they have pull access to the repository."
+	case REGISTRY_NOT_FOUND:
+		c.Fix = "Push the missing tag, or point the workload at a tag or digest that exists."
+	case REGISTRY_RATE_LIMITED:
+		c.Fix = "Authenticate pulls (imagePullSecret), use a pull-through cache or mirror, or wait for the limit to reset."
+	case REGISTRY_OUTAGE, REGISTRY_UNREACHABLE:
+		c.Fix = "Check the registry's status page or service health; pulls recover without a change to the workload once it is back."
+	}
+}
+
+// probeRegistry asks the registry for the manifest of an image the
+// container is stuck pulling, with the pod's pull secrets, so the alert can
+// tell auth errors, missing tags and registry outages apart. It returns nil
+// if the probe is disabled or the container is not waiting on a pull.
+func probeRegistry(ctx context.Context, clientset kubernetes.Interface, config *Config, pod *corev1.Pod, cs corev1.ContainerStatus) *RegistryFinding {
+	w := cs.State.Waiting
+	if !config.RegistryProbe.Enabled || w == nil || (w.Reason != "ErrImagePull" && w.Reason != "ImagePullBackOff") {
+		return nil
+	}
+	image := cs.Image
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if c.Name == cs.Name {
+			image = c.Image
+		}
+	}
+	host, repository, reference := parseImage(image)
+	finding := &RegistryFinding{Image: image}
+
+	ctx, cancel := within(ctx, config.RegistryProbe.Timeout)
+	defer cancel()
+	username, password := pullCredentials(ctx, clientset, pod, host)
+
+	endpoint := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, repository, reference)
+	resp, err := headManifest(ctx, endpoint, "")
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		var authorization string
+		authorization, err = registryAuthorization(ctx, resp.Header.Get("WWW-Authenticate"), repository, username, password)
+		if err != nil {
+			finding.Verdict, finding.Detail = REGISTRY_AUTH, err.Error()
+			log.Printf("📦 Registry probe of %s: %s", image, finding.Verdict)
+			return finding
+		}
+		if authorization != "" {
+			resp, err = headManifest(ctx, endpoint, authorization)
+		}
+	}
+	if err != nil {
+		finding.Verdict, finding.Detail = REGISTRY_UNREACHABLE, err.Error()
+		log.Printf("📦 Registry probe of %s: %s", image, finding.Verdict)
+		return finding
+	}
+
+	switch code := resp.StatusCode; {
+	case code == http.StatusOK:
+		finding.Verdict = REGISTRY_OK
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		finding.Verdict = REGISTRY_AUTH
+		if username == "" {
+			finding.Detail = fmt.Sprintf("%s, and the pod has no pull secret for %s", resp.Status, host)
+		} else {
+			finding.Detail = fmt.Sprintf("%s with the pod's pull secret for %s; the repository may also be missing or private", resp.Status, host)
+		}
+	case code == http.StatusNotFound:
+		finding.Verdict, finding.Detail = REGISTRY_NOT_FOUND, fmt.Sprintf("%s:%s", repository, reference)
+	case code == http.StatusTooManyRequests:
+		finding.Verdict, finding.Detail = REGISTRY_RATE_LIMITED, resp.Status
+	case code >= 500:
+		finding.Verdict, finding.Detail = REGISTRY_OUTAGE, resp.Status
+	default:
+		finding.Verdict, finding.Detail = REGISTRY_UNKNOWN, resp.Status
+	}
+	log.Printf("📦 Registry probe of %s: %s", image, finding.Verdict)
+	return finding
+}
+
+func headManifest(ctx context.Context, endpoint, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", manifestTypes)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// registryAuthorization answers the registry's challenge: a token from its
+// auth service for Bearer, the credentials themselves for Basic. It returns
+// "" if there is nothing to answer with.
+func registryAuthorization(ctx context.Context, challenge, repository, username, password string) (string, error) {
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	if scheme == "basic" {
+		if username == "" {
+			return "", nil
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	}
+	if scheme != "bearer" {
+		return "", nil
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", "repository:"+repository+":pull")
+	req, err := http.NewRequestWithContext(ctx, "GET", params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token service unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		if username == "" {
+			return "", fmt.Errorf("token service answered %s and the pod has no pull secret for this registry", resp.Status)
+		}
+		return "", fmt.Errorf("token service rejected the pod's pull secret: %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("token service answered %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("token service: %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseImage splits an image reference into the registry host, repository
+// and tag or digest, with Docker Hub's defaults filled in.
+func parseImage(image string) (host, repository, reference string) {
+	reference = "latest"
+	if i := strings.Index(image, "@"); i >= 0 {
+		image, reference = image[:i], image[i+1:]
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, reference = image[:i], image[i+1:]
+	}
+	host, repository = DOCKER_HUB, image
+	if i := strings.Index(image, "/"); i >= 0 {
+		first := image[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			host, repository = first, image[i+1:]
+		}
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = DOCKER_HUB
+	}
+	if host == DOCKER_HUB && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return host, repository, reference
+}
+
+// pullCredentials finds the pod's credentials for a registry in its
+// imagePullSecrets; the service account's are already copied into the pod
+// spec at admission.
+func pullCredentials(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, host string) (username, password string) {
+	if !allowed(pod.Namespace, "get", "secrets") {
+		return "", ""
+	}
+	for _, ref := range pod.Spec.ImagePullSecrets {
+		secret, err := clientset.CoreV1().Secrets(pod.Namespace).Get(ctx, ref.Name, v1.GetOptions{})
+		if err != nil {
+			log.Printf("⚠️ Failed to read pull secret %s: %v", ref.Name, err)
+			continue
+		}
+		var auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if data, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+			var config struct {
+				Auths json.RawMessage `json:"auths"`
+			}
+			if json.Unmarshal(data, &config) != nil || json.Unmarshal(config.Auths, &auths) != nil {
+				continue
+			}
+		} else if data, ok := secret.Data[corev1.DockerConfigKey]; ok {
+			if json.Unmarshal(data, &auths) != nil {
+				continue
+			}
+		}
+		for key, a := range auths {
+			if !registryMatches(key, host) {
+				continue
+			}
+			if a.Username != "" {
+				return a.Username, a.Password
+			}
+			if decoded, err := base64.StdEncoding.DecodeString(a.Auth); err == nil {
+				if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+					return parts[0], parts[1]
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// registryMatches compares a docker config key, which may be a URL, with a
+// registry host.
+func registryMatches(key, host string) bool {
+	if host == DOCKER_HUB && containsString(dockerHubKeys, key) {
+		return true
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	return strings.SplitN(key, "/", 2)[0] == host
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var kubectlVerbs = map[string]bool{
+	"get": true, "describe": true, "logs": true, "delete": true, "edit": true, "patch": true,
+	"label": true, "annotate": true, "scale": true, "rollout": true, "set": true, "top": true,
+	"exec": true, "port-forward": true, "apply": true, "create": true, "explain": true,
+	"cordon": true, "uncordon": true, "drain": true, "autoscale": true, "debug": true,
+}
+
+// verbs whose positional arguments are TYPE NAME (or TYPE/NAME) rather than
+// a bare pod name.
+var typedVerbs = map[string]bool{
+	"get": true, "describe": true, "delete": true, "edit": true, "patch": true,
+	"label": true, "annotate": true, "scale": true, "top": true, "autoscale": true,
+}
+
+var placeholderPattern = regexp.MustCompile(`<[^>]+>|\byour-|\bYOUR_|\.\.\.`)
+
+type SuggestedCommand struct {
+	Command string
+	Problem string
+}
+
+// extractKubectlCommands collects the kubectl invocations suggested in the
+// model output, joining shell line continuations.
+func extractKubectlCommands(analysis string) []string {
+	var commands []string
+	seen := map[string]bool{}
+	var pending string
+	for _, line := range strings.Split(analysis, "\n") {
+		line = strings.TrimSpace(line)
+		if pending != "" {
+			line = pending + " " + line
+			pending = ""
+		} else {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "$ "), "`")
+			if !strings.HasPrefix(line, "kubectl ") {
+				continue
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			pending = strings.TrimSpace(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		line = strings.TrimSuffix(line, "`")
+		if !seen[line] {
+			seen[line] = true
+			commands = append(commands, line)
+		}
+	}
+	return commands
+}
+
+func validateCommands(ctx context.Context, clientset kubernetes.Interface, namespace string, commands []string) []SuggestedCommand {
+	var checked []SuggestedCommand
+	for _, c := range commands {
+		checked = append(checked, SuggestedCommand{Command: c, Problem: validateCommand(ctx, clientset, namespace, c)})
+	}
+	return checked
+}
+
+func validateCommand(ctx context.Context, clientset kubernetes.Interface, namespace, command string) string {
+	if placeholderPattern.MatchString(command) {
+		return "contains a placeholder"
+	}
+	args, err := splitShellWords(command)
+	if err != nil {
+		return err.Error()
+	}
+
+	var positional []string
+	allNamespaces := false
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-n" || a == "--namespace":
+			if i+1 >= len(args) {
+				return "missing value for " + a
+			}
+			namespace = args[i+1]
+			i++
+		case strings.HasPrefix(a, "--namespace="):
+			namespace = strings.TrimPrefix(a, "--namespace=")
+		case a == "-A" || a == "--all-namespaces":
+			allNamespaces = true
+		case a == "--":
+			i = len(args)
+		case strings.HasPrefix(a, "-"):
+			if !strings.Contains(a, "=") && flagTakesValue(a) && i+1 < len(args) {
+				i++
+			}
+		default:
+			positional = append(positional, a)
+		}
+	}
+	if len(positional) == 0 {
+		return "no subcommand"
+	}
+	verb := positional[0]
+	if !kubectlVerbs[verb] {
+		return fmt.Sprintf("unknown kubectl command %q", verb)
+	}
+	if allNamespaces || verb == "apply" || verb == "create" || verb == "explain" {
+		return ""
+	}
+
+	resourceType, name := referencedResource(verb, positional[1:])
+	if name == "" {
+		return ""
+	}
+	exists, known := resourceExists(ctx, clientset, resourceType, namespace, name)
+	if known && !exists {
+		return fmt.Sprintf("%s `%s` not found in namespace `%s`", resourceType, name, namespace)
+	}
+	return ""
+}
+
+// referencedResource works out which named object a command acts on, e.g.
+// "rollout restart deployment/web" or "get pod web-1".
+func referencedResource(verb string, args []string) (string, string) {
+	switch verb {
+	case "rollout", "set":
+		if len(args) == 0 {
+			return "", ""
+		}
+		args = args[1:]
+	case "logs", "exec", "port-forward", "debug":
+		if len(args) > 0 && !strings.Contains(args[0], "/") {
+			return "pod", args[0]
+		}
+	case "cordon", "uncordon", "drain":
+		if len(args) > 0 {
+			return "node", args[0]
+		}
+		return "", ""
+	}
+
+	if len(args) == 0 {
+		return "", ""
+	}
+	if parts := strings.SplitN(args[0], "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	if (typedVerbs[verb] || verb == "rollout" || verb == "set") && len(args) > 1 {
+		return args[0], args[1]
+	}
+	return "", ""
+}
+
+func flagTakesValue(flag string) bool {
+	switch flag {
+	case "-c", "--container", "-o", "--output", "-l", "--selector", "--tail", "--since", "--replicas", "--patch", "--type", "--to-revision", "-f", "--filename":
+		return true
+	}
+	return false
+}
+
+// resourceExists looks the object up for the resource types we know how to
+// check; known is false for anything else.
+func resourceExists(ctx context.Context, clientset kubernetes.Interface, resourceType, namespace, name string) (exists bool, known bool) {
+	var err error
+	opts := v1.GetOptions{}
+	switch strings.ToLower(resourceType) {
+	case "pod", "pods", "po":
+		_, err = clientset.CoreV1().Pods(namespace).Get(ctx, name, opts)
+	case "deployment", "deployments", "deploy":
+		_, err = clientset.AppsV1().Deployments(namespace).Get(ctx, name, opts)
+	case "statefulset", "statefulsets", "sts":
+		_, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, opts)
+	case "daemonset", "daemonsets", "ds":
+		_, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, opts)
+	case "replicaset", "replicasets", "rs":
+		_, err = clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, opts)
+	case "service", "services", "svc":
+		_, err = clientset.CoreV1().Services(namespace).Get(ctx, name, opts)
+	case "configmap", "configmaps", "cm":
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, opts)
+	case "secret", "secrets":
+		_, err = clientset.CoreV1().Secrets(namespace).Get(ctx, name, opts)
+	case "persistentvolumeclaim", "persistentvolumeclaims", "pvc":
+		_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, opts)
+	case "job", "jobs":
+		_, err = clientset.BatchV1().Jobs(namespace).Get(ctx, name, opts)
+	case "cronjob", "cronjobs", "cj":
+		_, err = clientset.BatchV1().CronJobs(namespace).Get(ctx, name, opts)
+	case "node", "nodes", "no":
+		_, err = clientset.CoreV1().Nodes().Get(ctx, name, opts)
+	default:
+		return false, false
+	}
+	if apierrors.IsNotFound(err) {
+		return false, true
+	}
+	// Forbidden or transient errors say nothing about the name.
+	return true, err == nil
+}
+
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	var quote rune
+	inWord := false
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unbalanced %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+func formatRemediation(commands []SuggestedCommand) string {
+	var b strings.Builder
+	b.WriteString("🛠️ *Suggested remediation:*\n")
+	for _, c := range commands {
+		if c.Problem == "" {
+			fmt.Fprintf(&b, "✅ `%s`\n", c.Command)
+		} else {
+			fmt.Fprintf(&b, "⚠️ `%s`\n      _%s_\n", c.Command, c.Problem)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const RESOLVE_AFTER = 10 * time.Minute
+
+// openIncidents holds the unresolved pod incidents per crash signature. All
+// of them share one paging-tool alert, but each has its own Slack thread.
+var (
+	openMu        sync.Mutex
+	openIncidents = map[string][]*Incident{}
+)
+
+func trackOpen(inc *Incident) {
+	openMu.Lock()
+	openIncidents[inc.Signature] = append(openIncidents[inc.Signature], inc)
+	openMu.Unlock()
+}
+
+// watchResolutions resolves incidents whose workload has stayed healthy for
+// the configured resolveAfter period since its last failure.
+func watchResolutions(clientset kubernetes.Interface, dyn dynamic.Interface) {
+	for {
+		time.Sleep(cfg().CheckInterval.Duration)
+		config := cfg()
+		stable := config.ResolveAfter.Duration
+		if stable <= 0 {
+			continue
+		}
+
+		openMu.Lock()
+		latest := map[string]*Incident{}
+		for sig, list := range openIncidents {
+			latest[sig] = list[len(list)-1]
+		}
+		openMu.Unlock()
+
+		pods := map[string][]corev1.Pod{}
+		for sig, inc := range latest {
+			if time.Since(inc.Time) < stable {
+				continue
+			}
+			if _, listed := pods[inc.Namespace]; !listed {
+				list, err := clientset.CoreV1().Pods(inc.Namespace).List(context.Background(), v1.ListOptions{})
+				if err != nil {
+					log.Printf("⚠️ Failed to list pods in %s: %v", inc.Namespace, err)
+					continue
+				}
+				pods[inc.Namespace] = list.Items
+			}
+			if !workloadHealthy(pods[inc.Namespace], inc.Workload, time.Now().Add(-stable)) {
+				continue
+			}
+
+			openMu.Lock()
+			list := openIncidents[sig]
+			if len(list) == 0 || list[len(list)-1] != inc {
+				// A newer failure arrived while we were checking.
+				openMu.Unlock()
+				continue
+			}
+			delete(openIncidents, sig)
+			openMu.Unlock()
+
+			log.Printf("✅ %s/%s is healthy again, resolving %d incident(s)", inc.Namespace, inc.Workload, len(list))
+			resolveIncidents(config, dyn, list, stable)
+		}
+	}
+}
+
+// workloadHealthy reports whether the workload has running pods whose
+// containers are all ready and none of which terminated since the cutoff.
+func workloadHealthy(pods []corev1.Pod, workload string, since time.Time) bool {
+	found := false
+	for i := range pods {
+		p := &pods[i]
+		if workloadName(p) != workload || p.DeletionTimestamp != nil {
+			continue
+		}
+		if p.Status.Phase != corev1.PodRunning {
+			return false
+		}
+		for _, cs := range p.Status.ContainerStatuses {
+			if !cs.Ready {
+				return false
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil && t.FinishedAt.After(since) {
+				return false
+			}
+		}
+		found = true
+	}
+	return found
+}
+
+// resolveIncidents posts the follow-up in every thread of the signature and
+// closes the shared paging-tool alert.
+func resolveIncidents(config *Config, dyn dynamic.Interface, list []*Incident, stable time.Duration) {
+	ctx := context.Background()
+	now := time.Now()
+	last := list[len(list)-1]
+
+	threads := map[string]bool{}
+	for _, inc := range list {
+		incidentsMu.Lock()
+		inc.Resolved = now
+		incidentsMu.Unlock()
+		markIncidentResolved(ctx, dyn, inc)
+
+		if inc.ThreadTS == "" || threads[inc.ThreadTS] {
+			continue
+		}
+		threads[inc.ThreadTS] = true
+		sendSlackThread(inc.Channel, inc.ThreadTS, fmt.Sprintf(translate(inc.Language, "✅ *Resolved:* `%s` has been healthy for %s since the last failure at %s."),
+			last.Workload, stable, last.Time.Format("2006-01-02 15:04:05")))
+	}
+
+	forgetThread(config, last.Signature)
+
+	for _, n := range notifiers(config) {
+		r, ok := n.(Resolver)
+		if !ok {
+			continue
+		}
+		if err := r.Resolve(last); err != nil {
+			log.Printf("❌ Failed to resolve %s incident for %s [%s]: %v", n.Name(), last.Workload, last.Namespace, err)
+		}
+	}
+}
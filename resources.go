@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+type podMetrics struct {
+	Containers []struct {
+		Name  string            `json:"name"`
+		Usage map[string]string `json:"usage"`
+	} `json:"containers"`
+}
+
+// resourceSnapshot reports current usage from metrics-server next to each
+// container's requests and limits. Usage is omitted if the metrics API is
+// not installed or has no sample for the pod yet.
+func resourceSnapshot(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) string {
+	usage := map[string]map[string]string{}
+	path := fmt.Sprintf("/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods/%s", pod.Namespace, pod.Name)
+	if raw, err := getRaw(ctx, clientset, path); err == nil {
+		var m podMetrics
+		if json.Unmarshal(raw, &m) == nil {
+			for _, c := range m.Containers {
+				usage[c.Name] = c.Usage
+			}
+		}
+	}
+
+	var lines []string
+	for _, c := range pod.Spec.Containers {
+		cpu := formatUsage(corev1.ResourceCPU, usage[c.Name]["cpu"], c.Resources.Requests.Cpu(), c.Resources.Limits.Cpu())
+		mem := formatUsage(corev1.ResourceMemory, usage[c.Name]["memory"], c.Resources.Requests.Memory(), c.Resources.Limits.Memory())
+		lines = append(lines, fmt.Sprintf("%s: cpu %s, memory %s", c.Name, cpu, mem))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getRaw reads an API path that has no typed client, like the metrics API
+// or the kubelet's stats. It fails instead of panicking when the clientset
+// has no REST client, as client-go's fake clientset does.
+func getRaw(ctx context.Context, clientset kubernetes.Interface, path ...string) ([]byte, error) {
+	client := clientset.CoreV1().RESTClient()
+	if rc, ok := client.(*rest.RESTClient); client == nil || ok && rc == nil {
+		return nil, fmt.Errorf("no REST client for %s", strings.Join(path, "/"))
+	}
+	return client.Get().AbsPath(path...).DoRaw(ctx)
+}
+
+func formatUsage(name corev1.ResourceName, used string, request, limit *resource.Quantity) string {
+	s := "using n/a"
+	if used != "" {
+		if q, err := resource.ParseQuantity(used); err == nil {
+			s = "using " + humanQuantity(name, q)
+			if !limit.IsZero() {
+				s += fmt.Sprintf(" of a %s limit (%.0f%%)", limit.String(), float64(q.MilliValue())*100/float64(limit.MilliValue()))
+			}
+		}
+	}
+	if used == "" && !limit.IsZero() {
+		s += ", limit " + limit.String()
+	}
+	if !request.IsZero() {
+		s += ", request " + request.String()
+	}
+	if limit.IsZero() {
+		s += ", no limit"
+	}
+	return s
+}
+
+// humanQuantity rounds metrics-server values (e.g. 996147200 bytes or
+// 12345678n cores) to the units people use in pod specs. The unit follows
+// the resource, as metrics-server reports memory in decimal or binary form.
+func humanQuantity(name corev1.ResourceName, q resource.Quantity) string {
+	if name != corev1.ResourceMemory {
+		return fmt.Sprintf("%dm", q.MilliValue())
+	}
+	if b := q.Value(); b >= 1024*1024*1024 {
+		return fmt.Sprintf("%.1fGi", float64(b)/(1024*1024*1024))
+	}
+	return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ROLLOUT_WINDOW = 30 * time.Minute
+
+	REVISION_ANNOTATION     = "deployment.kubernetes.io/revision"
+	CHANGE_CAUSE_ANNOTATION = "kubernetes.io/change-cause"
+)
+
+// rolloutChange reports whether the pod's ReplicaSet was created within the
+// window before the crash, i.e. the pod runs a release that was just rolled
+// out, and how its container images differ from the previous ReplicaSet.
+func rolloutChange(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, crash time.Time, window time.Duration) string {
+	var rsName string
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "ReplicaSet" && ref.Controller != nil && *ref.Controller {
+			rsName = ref.Name
+		}
+	}
+	if rsName == "" {
+		return ""
+	}
+	rs, err := clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, rsName, v1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	age := crash.Sub(rs.CreationTimestamp.Time)
+	if age < 0 || age > window {
+		return ""
+	}
+
+	deployment := ""
+	for _, ref := range rs.OwnerReferences {
+		if ref.Kind == "Deployment" {
+			deployment = ref.Name
+		}
+	}
+	if deployment == "" {
+		return fmt.Sprintf("new release: replicaset `%s` created %s before the crash", rsName, humanDuration(age))
+	}
+
+	s := fmt.Sprintf("new release: deployment `%s` rolled out revision %s %s before the crash", deployment, rs.Annotations[REVISION_ANNOTATION], humanDuration(age))
+	if cause := rs.Annotations[CHANGE_CAUSE_ANNOTATION]; cause != "" {
+		s += fmt.Sprintf(" (%s)", cause)
+	}
+	prev := previousReplicaSet(ctx, clientset, rs, deployment)
+	if prev == nil {
+		return s
+	}
+	if diff := imageDiff(prev.Spec.Template.Spec.Containers, rs.Spec.Template.Spec.Containers); diff != "" {
+		return s + "; " + diff
+	}
+	return s + "; container images unchanged since revision " + prev.Annotations[REVISION_ANNOTATION] + ", so the pod template changed elsewhere (env, config, resources)"
+}
+
+// previousReplicaSet finds the ReplicaSet of the deployment with the highest
+// revision below the given one.
+func previousReplicaSet(ctx context.Context, clientset kubernetes.Interface, rs *appsv1.ReplicaSet, deployment string) *appsv1.ReplicaSet {
+	current, _ := strconv.Atoi(rs.Annotations[REVISION_ANNOTATION])
+	list, err := clientset.AppsV1().ReplicaSets(rs.Namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+
+	var prev *appsv1.ReplicaSet
+	best := 0
+	for i := range list.Items {
+		candidate := &list.Items[i]
+		owned := false
+		for _, ref := range candidate.OwnerReferences {
+			if ref.Kind == "Deployment" && ref.Name == deployment {
+				owned = true
+			}
+		}
+		rev, _ := strconv.Atoi(candidate.Annotations[REVISION_ANNOTATION])
+		if owned && rev < current && rev > best {
+			prev, best = candidate, rev
+		}
+	}
+	return prev
+}
+
+func imageDiff(before, after []corev1.Container) string {
+	old := map[string]string{}
+	for _, c := range before {
+		old[c.Name] = c.Image
+	}
+	var diffs []string
+	for _, c := range after {
+		prev, ok := old[c.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("container `%s` added (`%s`)", c.Name, c.Image))
+		case prev != c.Image:
+			diffs = append(diffs, fmt.Sprintf("`%s` image `%s` → `%s`", c.Name, prev, c.Image))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
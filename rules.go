@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const RULE_GROUP_VERSION = "pod-analyzer.io/v1alpha1"
+
+var ruleResource = schema.GroupVersionResource{Group: "pod-analyzer.io", Version: "v1alpha1", Resource: "podanalyzerrules"}
+
+type RuleSpec struct {
+	RestartThreshold int32    `json:"restartThreshold,omitempty"`
+	IncidentTypes    []string `json:"incidentTypes,omitempty"`
+	SlackChannel     string   `json:"slackChannel,omitempty"`
+	PromptTemplate   string   `json:"promptTemplate,omitempty"`
+	Language         string   `json:"language,omitempty"`
+}
+
+type Rule struct {
+	Name string
+	RuleSpec
+
+	prompt *template.Template
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]*Rule{}
+)
+
+// watchRules keeps the namespace→rule map in sync with the PodAnalyzerRule
+// objects in the cluster. Without the CRD installed only the global config
+// applies.
+func watchRules(clientset kubernetes.Interface, dyn dynamic.Interface) {
+	if _, err := clientset.Discovery().ServerResourcesForGroupVersion(RULE_GROUP_VERSION); err != nil {
+		log.Printf("⚠️ PodAnalyzerRule CRD not installed, using global config only: %v", err)
+		return
+	}
+
+	// One informer per watched namespace, so --namespaced works with a Role.
+	var factories []dynamicinformer.DynamicSharedInformerFactory
+	var stores []cache.Store
+	for _, ns := range watchedNamespaces(cfg()) {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dyn, 0, ns, nil)
+		factories = append(factories, factory)
+		stores = append(stores, factory.ForResource(ruleResource).Informer().GetStore())
+	}
+	reconcile := func(interface{}) { reconcileRules(stores...) }
+	for _, factory := range factories {
+		factory.ForResource(ruleResource).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    reconcile,
+			UpdateFunc: func(_, obj interface{}) { reconcile(obj) },
+			DeleteFunc: reconcile,
+		})
+		factory.Start(make(chan struct{}))
+	}
+	log.Println("📜 Watching PodAnalyzerRule resources")
+}
+
+// reconcileRules rebuilds the whole map from the informer caches. When a
+// namespace has several rules the alphabetically first one wins.
+func reconcileRules(stores ...cache.Store) {
+	var objs []interface{}
+	for _, store := range stores {
+		objs = append(objs, store.List()...)
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].(*unstructured.Unstructured).GetName() < objs[j].(*unstructured.Unstructured).GetName()
+	})
+
+	next := map[string]*Rule{}
+	for _, obj := range objs {
+		u := obj.(*unstructured.Unstructured)
+		if _, exists := next[u.GetNamespace()]; exists {
+			continue
+		}
+
+		rule := &Rule{Name: u.GetName()}
+		spec, _, _ := unstructured.NestedMap(u.Object, "spec")
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &rule.RuleSpec); err != nil {
+			log.Printf("❌ Invalid PodAnalyzerRule %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+			continue
+		}
+		if rule.PromptTemplate != "" {
+			t, err := template.New(rule.Name).Parse(rule.PromptTemplate)
+			if err != nil {
+				log.Printf("❌ Invalid promptTemplate in PodAnalyzerRule %s/%s, using global prompt: %v", u.GetNamespace(), u.GetName(), err)
+			} else {
+				rule.prompt = t
+			}
+		}
+		next[u.GetNamespace()] = rule
+	}
+
+	rulesMu.Lock()
+	rules = next
+	rulesMu.Unlock()
+}
+
+func ruleFor(namespace string) *Rule {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return rules[namespace]
+}
+
+func (r *Rule) restartThreshold() int32 {
+	if r == nil || r.RestartThreshold <= 0 {
+		return 1
+	}
+	return r.RestartThreshold
+}
+
+func (r *Rule) allowsType(incidentType string) bool {
+	if r == nil || len(r.IncidentTypes) == 0 {
+		return true
+	}
+	for _, t := range r.IncidentTypes {
+		if t == incidentType {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) slackChannel(config *Config) string {
+	if r == nil || r.SlackChannel == "" {
+		return config.SlackChannel
+	}
+	return r.SlackChannel
+}
+
+func (r *Rule) promptTemplate(config *Config) *template.Template {
+	if r == nil || r.prompt == nil {
+		return config.prompt
+	}
+	return r.prompt
+}
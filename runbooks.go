@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Runbook links an internal procedure (Confluence, a Git repo) to the
+// incidents it covers: those of the listed categories or incident types, or
+// whose errors and logs match one of the patterns. Without categories and
+// patterns it covers nothing.
+type Runbook struct {
+	Title      string   `json:"title"`
+	URL        string   `json:"url"`
+	Categories []string `json:"categories"`
+	Patterns   []string `json:"patterns"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// matchRunbooks returns the runbooks for the incident, in config order. The
+// text is searched for the runbooks' patterns.
+func matchRunbooks(config *Config, inc *Incident, text string) []Runbook {
+	var matched []Runbook
+	for _, r := range config.Runbooks {
+		if r.URL == "" || len(r.Namespaces) > 0 && !containsString(r.Namespaces, inc.Namespace) {
+			continue
+		}
+		if r.covers(inc, text) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+func (r Runbook) covers(inc *Incident, text string) bool {
+	if inc.Category != "" && containsString(r.Categories, inc.Category) || containsString(r.Categories, inc.Type) {
+		return true
+	}
+	for _, p := range r.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid pattern %q of runbook %s: %v", p, r.name(), err)
+			continue
+		}
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Runbook) name() string {
+	if r.Title != "" {
+		return r.Title
+	}
+	return r.URL
+}
+
+func runbookURLs(runbooks []Runbook) []string {
+	var urls []string
+	for _, r := range runbooks {
+		urls = append(urls, r.URL)
+	}
+	return urls
+}
+
+// describeRunbooks lists the runbooks for the prompt, one per line.
+func describeRunbooks(runbooks []Runbook) string {
+	var lines []string
+	for _, r := range runbooks {
+		lines = append(lines, fmt.Sprintf("- %s: %s", r.name(), r.URL))
+	}
+	return strings.Join(lines, "\n")
+}
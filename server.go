@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const LISTEN_ADDR = ":8080"
+
+var mux = http.NewServeMux()
+
+func listenAddr() string {
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		return addr
+	}
+	return LISTEN_ADDR
+}
+
+func serveHTTP(clientset kubernetes.Interface, dyn dynamic.Interface) {
+	interactionHandlers[REMEDIATE_ACTION_ID] = func(in SlackInteraction) {
+		handleRemediationApproval(clientset, in)
+	}
+	interactionHandlers[DEEP_ANALYZE_ACTION_ID] = func(in SlackInteraction) {
+		handleDeepAnalyze(clientset, dyn, in)
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/slack/interactions", handleSlackInteraction)
+	mux.HandleFunc("/slack/events", handleSlackEvents(clientset, dyn))
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/incidents", requireAPIToken(handleIncidents))
+	mux.HandleFunc("/incidents/", requireAPIToken(handleIncident))
+	mux.HandleFunc("/analyze", requireAPIToken(handleAnalyze(clientset, dyn)))
+	mux.HandleFunc("/audit", requireToken(handleAudit))
+	registerDebugHandlers()
+
+	addr := listenAddr()
+	log.Printf("🌐 HTTP server listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("❌ HTTP server failed: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SIBLING_LOG_LINES = 30
+	SIBLING_LOG_BYTES = 3000
+)
+
+// Node labels and pod labels worth comparing between replicas: where they
+// run, and which revision of the workload they are.
+var (
+	siblingNodeLabels = []string{"topology.kubernetes.io/zone", "node.kubernetes.io/instance-type", "kubernetes.io/arch", "eks.amazonaws.com/nodegroup", "cloud.google.com/gke-nodepool", "kubernetes.azure.com/agentpool"}
+	revisionLabels    = []string{"pod-template-hash", "controller-revision-hash"}
+)
+
+// compareHealthyReplica finds a healthy replica of the pod's workload and
+// lists how the crashing pod differs from it: node, image digest, revision,
+// environment, resources and annotations, followed by the healthy replica's
+// recent logs. It returns "" for workloads with a single pod or without a
+// healthy replica, where there is nothing to compare with.
+func compareHealthyReplica(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, container string) string {
+	kind, name := podController(pod)
+	if kind == "Pod" || kind == "Node" || kind == "Job" {
+		return ""
+	}
+	list, err := clientset.CoreV1().Pods(pod.Namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return ""
+	}
+	var replicas, healthy []corev1.Pod
+	for _, p := range list.Items {
+		if k, n := podController(&p); k != kind || n != name || p.Name == pod.Name || p.DeletionTimestamp != nil {
+			continue
+		}
+		replicas = append(replicas, p)
+		if replicaHealthy(&p) {
+			healthy = append(healthy, p)
+		}
+	}
+	if len(healthy) == 0 {
+		return ""
+	}
+	// The longest-running healthy replica has proven itself the most.
+	sort.Slice(healthy, func(i, j int) bool {
+		return healthy[i].CreationTimestamp.Before(&healthy[j].CreationTimestamp)
+	})
+	good := &healthy[0]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Healthy replica: %s (%d of %d other replicas healthy; running since %s without restarts)\n",
+		good.Name, len(healthy), len(replicas), good.CreationTimestamp.UTC().Format(time.RFC3339))
+	diffs := replicaDiffs(ctx, clientset, pod, good, container)
+	if len(diffs) == 0 {
+		b.WriteString("Differences: none found in node, image, revision, environment, resources or annotations; the crash is likely triggered by input, load or timing rather than by the pod's setup.\n")
+	} else {
+		b.WriteString("Differences (crashing → healthy):\n")
+		for _, d := range diffs {
+			fmt.Fprintf(&b, "- %s\n", d)
+		}
+	}
+
+	if allowed(pod.Namespace, "get", "pods/log") {
+		lines := int64(SIBLING_LOG_LINES)
+		raw, err := clientset.CoreV1().Pods(good.Namespace).GetLogs(good.Name, &corev1.PodLogOptions{Container: container, TailLines: &lines}).DoRaw(ctx)
+		if err == nil && len(raw) > 0 {
+			fmt.Fprintf(&b, "Recent logs of %s:\n%s", good.Name, tail(strings.TrimRight(string(raw), "\n"), SIBLING_LOG_BYTES))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// replicaHealthy reports whether the pod is running, ready, and has never
+// restarted.
+func replicaHealthy(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	ready := false
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			ready = c.Status == corev1.ConditionTrue
+		}
+	}
+	if !ready {
+		return false
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.RestartCount > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func replicaDiffs(ctx context.Context, clientset kubernetes.Interface, bad, good *corev1.Pod, container string) []string {
+	var diffs []string
+	differs := func(what, a, b string) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("%s: %s → %s", what, orNone(a), orNone(b)))
+		}
+	}
+
+	for _, l := range revisionLabels {
+		differs("revision ("+l+")", bad.Labels[l], good.Labels[l])
+	}
+	differs("node", bad.Spec.NodeName, good.Spec.NodeName)
+	if bad.Spec.NodeName != good.Spec.NodeName && allowed("", "get", "nodes") {
+		diffs = append(diffs, nodeDiffs(ctx, clientset, bad.Spec.NodeName, good.Spec.NodeName)...)
+	}
+
+	badStatus, badSpec := containerOf(bad, container)
+	goodStatus, goodSpec := containerOf(good, container)
+	if badSpec != nil && goodSpec != nil {
+		differs("image", badSpec.Image, goodSpec.Image)
+		differs("requests", resourceList(badSpec.Resources.Requests), resourceList(goodSpec.Resources.Requests))
+		differs("limits", resourceList(badSpec.Resources.Limits), resourceList(goodSpec.Resources.Limits))
+		if env := differingKeys(envMap(badSpec), envMap(goodSpec)); len(env) > 0 {
+			diffs = append(diffs, "environment variables set differently: "+strings.Join(env, ", "))
+		}
+	}
+	if badStatus != nil && goodStatus != nil {
+		differs("image digest", digestOf(badStatus.ImageID), digestOf(goodStatus.ImageID))
+	}
+	var annotations []string
+	for _, k := range differingKeys(bad.Annotations, good.Annotations) {
+		if k != "kubectl.kubernetes.io/last-applied-configuration" {
+			annotations = append(annotations, k)
+		}
+	}
+	if len(annotations) > 0 {
+		diffs = append(diffs, "annotations set differently: "+strings.Join(annotations, ", "))
+	}
+	return diffs
+}
+
+// nodeDiffs compares the nodes' pool, zone and software versions, and flags
+// pressure conditions only the crashing pod's node reports.
+func nodeDiffs(ctx context.Context, clientset kubernetes.Interface, bad, good string) []string {
+	badNode, err := clientset.CoreV1().Nodes().Get(ctx, bad, v1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	goodNode, err := clientset.CoreV1().Nodes().Get(ctx, good, v1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	var diffs []string
+	differs := func(what, a, b string) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("node %s: %s → %s", what, orNone(a), orNone(b)))
+		}
+	}
+	for _, l := range siblingNodeLabels {
+		differs(l, badNode.Labels[l], goodNode.Labels[l])
+	}
+	bi, gi := badNode.Status.NodeInfo, goodNode.Status.NodeInfo
+	differs("kubelet", bi.KubeletVersion, gi.KubeletVersion)
+	differs("container runtime", bi.ContainerRuntimeVersion, gi.ContainerRuntimeVersion)
+	differs("kernel", bi.KernelVersion, gi.KernelVersion)
+	differs("OS image", bi.OSImage, gi.OSImage)
+	for _, c := range badNode.Status.Conditions {
+		if c.Type != corev1.NodeReady && c.Status == corev1.ConditionTrue {
+			diffs = append(diffs, fmt.Sprintf("node %s reports %s: %s", bad, c.Type, c.Message))
+		}
+	}
+	return diffs
+}
+
+func containerOf(pod *corev1.Pod, name string) (*corev1.ContainerStatus, *corev1.Container) {
+	var status *corev1.ContainerStatus
+	var spec *corev1.Container
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == name {
+			status = &pod.Status.ContainerStatuses[i]
+		}
+	}
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			spec = &pod.Spec.Containers[i]
+		}
+	}
+	return status, spec
+}
+
+// envMap flattens a container's environment for comparison. Values are only
+// compared, never reported, as they may hold credentials.
+func envMap(c *corev1.Container) map[string]string {
+	env := map[string]string{}
+	for _, e := range c.Env {
+		value := e.Value
+		if e.ValueFrom != nil {
+			value = e.ValueFrom.String()
+		}
+		env[e.Name] = value
+	}
+	for _, from := range c.EnvFrom {
+		switch {
+		case from.ConfigMapRef != nil:
+			env["envFrom configmap "+from.ConfigMapRef.Name] = from.Prefix
+		case from.SecretRef != nil:
+			env["envFrom secret "+from.SecretRef.Name] = from.Prefix
+		}
+	}
+	return env
+}
+
+// differingKeys lists the keys set in either map whose values differ.
+func differingKeys(a, b map[string]string) []string {
+	var keys []string
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func resourceList(rl corev1.ResourceList) string {
+	var parts []string
+	for name, q := range rl {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, q.String()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func digestOf(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+	return imageID
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
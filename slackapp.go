@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type SlackInteraction struct {
+	UserID      string
+	UserName    string
+	ChannelID   string
+	MessageTS   string
+	ThreadTS    string
+	ActionID    string
+	Value       string
+	ResponseURL string
+}
+
+// interactionHandlers maps Block Kit action_ids to the code that handles a
+// click on them. Handlers run in their own goroutine after Slack has been
+// acknowledged.
+var interactionHandlers = map[string]func(SlackInteraction){}
+
+// verifySlackRequest checks the v0 request signature Slack computes with the
+// app's signing secret, rejecting replays older than five minutes. The
+// secret that matches tells which tenant's Slack app sent the request.
+func verifySlackRequest(r *http.Request) ([]byte, string, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", false
+	}
+	secrets := signingSecrets()
+	if len(secrets) == 0 {
+		log.Println("❌ SLACK_SIGNING_SECRET is not set, rejecting Slack request")
+		return nil, "", false
+	}
+
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || math.Abs(float64(time.Now().Unix()-sec)) > 300 {
+		return nil, "", false
+	}
+	for tenant, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + ts + ":"))
+		mac.Write(body)
+		expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+		if hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+			return body, tenant, true
+		}
+	}
+	return body, "", false
+}
+
+func handleSlackInteraction(w http.ResponseWriter, r *http.Request) {
+	body, tenant, ok := verifySlackRequest(r)
+	if !ok {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+		Message struct {
+			TS       string `json:"ts"`
+			ThreadTS string `json:"thread_ts"`
+		} `json:"message"`
+		ResponseURL string `json:"response_url"`
+		Actions     []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	for _, a := range payload.Actions {
+		handler, ok := interactionHandlers[a.ActionID]
+		if !ok {
+			log.Printf("⚠️ Unhandled Slack action %q", a.ActionID)
+			continue
+		}
+		go handler(SlackInteraction{
+			UserID:      payload.User.ID,
+			UserName:    payload.User.Username,
+			ChannelID:   tenantChannel(tenant, payload.Channel.ID),
+			MessageTS:   payload.Message.TS,
+			ThreadTS:    payload.Message.ThreadTS,
+			ActionID:    a.ActionID,
+			Value:       a.Value,
+			ResponseURL: payload.ResponseURL,
+		})
+	}
+}
+
+// replaceInteractiveMessage swaps the message holding the clicked buttons
+// for plain text so the action cannot be triggered twice.
+func replaceInteractiveMessage(responseURL, text string) {
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"replace_original": true,
+		"text":             text,
+	})
+	jsonData = outbound("slack", "response_url", jsonData)
+	resp, err := http.Post(responseURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("❌ Failed to update Slack message: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
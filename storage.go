@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghulevishal/pod-analyzer/internal/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var storageEventReasons = []string{
+	"FailedAttachVolume", "FailedMount", "FailedMapVolume", "VolumeResizeFailed",
+	"FileSystemResizeFailed", "FailedBinding", "ProvisioningFailed", "ExternalProvisioning",
+}
+
+type volumeStats struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Volume []struct {
+			Name          string `json:"name"`
+			UsedBytes     uint64 `json:"usedBytes"`
+			CapacityBytes uint64 `json:"capacityBytes"`
+			InodesUsed    uint64 `json:"inodesUsed"`
+			Inodes        uint64 `json:"inodes"`
+			PVCRef        *struct {
+				Name string `json:"name"`
+			} `json:"pvcRef"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// describeStorage reports the PVCs a pod mounts: claim and volume status,
+// filesystem usage from the kubelet and the storage events of the pod and
+// its claims. It returns "" for pods without persistent volumes.
+func describeStorage(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, events []corev1.Event, since time.Time) string {
+	var claims []string
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil {
+			claims = append(claims, v.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	if len(claims) == 0 {
+		return ""
+	}
+
+	usage := volumeUsage(ctx, clientset, pod)
+	var lines []string
+	var storageEvents []corev1.Event
+	for _, name := range claims {
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("pvc %s: %v", name, err))
+			continue
+		}
+		line := fmt.Sprintf("pvc %s: %s", name, pvc.Status.Phase)
+		if q, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+			line += ", capacity " + q.String()
+		} else if q, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			line += ", requested " + q.String()
+		}
+		if pvc.Spec.StorageClassName != nil {
+			line += ", storageClass " + *pvc.Spec.StorageClassName
+		}
+		var modes []string
+		for _, m := range pvc.Spec.AccessModes {
+			modes = append(modes, string(m))
+		}
+		line += ", accessModes " + strings.Join(modes, ",")
+		for _, c := range pvc.Status.Conditions {
+			if c.Status == corev1.ConditionTrue {
+				line += fmt.Sprintf(", %s: %s", c.Type, c.Message)
+			}
+		}
+		if u, ok := usage[name]; ok {
+			line += ", " + u
+		}
+		lines = append(lines, line)
+
+		if pvc.Spec.VolumeName != "" {
+			lines = append(lines, "  "+describePV(ctx, clientset, pvc.Spec.VolumeName))
+		}
+		if pvcEvents, err := podEvents(ctx, clientset, pod.Namespace, name, since); err == nil {
+			storageEvents = append(storageEvents, pvcEvents...)
+		}
+	}
+
+	for _, e := range events {
+		if containsString(storageEventReasons, e.Reason) {
+			storageEvents = append(storageEvents, e)
+		}
+	}
+	if len(storageEvents) > 0 {
+		lines = append(lines, "storage events:", collector.FormatEvents(storageEvents))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func describePV(ctx context.Context, clientset kubernetes.Interface, name string) string {
+	pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return fmt.Sprintf("pv %s: %v", name, err)
+	}
+	s := fmt.Sprintf("pv %s: %s, reclaimPolicy %s", name, pv.Status.Phase, pv.Spec.PersistentVolumeReclaimPolicy)
+	if pv.Status.Message != "" {
+		s += ", " + pv.Status.Message
+	}
+	if pv.Spec.CSI != nil {
+		s += ", csi " + pv.Spec.CSI.Driver
+	}
+	if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+		var terms []string
+		for _, t := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+			for _, e := range t.MatchExpressions {
+				terms = append(terms, fmt.Sprintf("%s %s %s", e.Key, e.Operator, strings.Join(e.Values, ",")))
+			}
+		}
+		s += ", nodeAffinity " + strings.Join(terms, "; ")
+	}
+	return s
+}
+
+// volumeUsage reads filesystem usage per claim from the kubelet summary API
+// of the pod's node. It needs get on nodes/proxy and returns nothing without.
+func volumeUsage(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) map[string]string {
+	usage := map[string]string{}
+	if pod.Spec.NodeName == "" || !allowed("", "get", "nodes/proxy") {
+		return usage
+	}
+	raw, err := getRaw(ctx, clientset, "/api/v1/nodes", pod.Spec.NodeName, "proxy/stats/summary")
+	if err != nil {
+		return usage
+	}
+	var stats volumeStats
+	if json.Unmarshal(raw, &stats) != nil {
+		return usage
+	}
+	for _, p := range stats.Pods {
+		if p.PodRef.Name != pod.Name || p.PodRef.Namespace != pod.Namespace {
+			continue
+		}
+		for _, v := range p.Volume {
+			if v.PVCRef == nil || v.CapacityBytes == 0 {
+				continue
+			}
+			s := fmt.Sprintf("used %dMi of %dMi (%.0f%%)", v.UsedBytes/(1024*1024), v.CapacityBytes/(1024*1024), float64(v.UsedBytes)*100/float64(v.CapacityBytes))
+			if v.Inodes > 0 {
+				s += fmt.Sprintf(", inodes %.0f%%", float64(v.InodesUsed)*100/float64(v.Inodes))
+			}
+			usage[v.PVCRef.Name] = s
+		}
+	}
+	return usage
+}
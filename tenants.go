@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	TENANT_LABEL     = "pod-analyzer.io/tenant"
+	TENANT_CACHE_TTL = 5 * time.Minute
+)
+
+// TenantConfig isolates one team's credentials and model. Secrets are never
+// in the config, only the names of the environment variables holding them,
+// so each team's Secret can be mounted with envFrom.
+type TenantConfig struct {
+	Namespaces       []string          `json:"namespaces"`
+	SlackChannel     string            `json:"slackChannel"`
+	SlackTokenEnv    string            `json:"slackTokenEnv"`
+	SlackSigningEnv  string            `json:"slackSigningSecretEnv"`
+	APITokenEnv      string            `json:"apiTokenEnv"`
+	Provider         string            `json:"provider"`
+	OllamaAPI        string            `json:"ollamaAPI"`
+	OllamaModel      string            `json:"ollamaModel"`
+	OpenAIAPI        string            `json:"openaiAPI"`
+	OpenAIModel      string            `json:"openaiModel"`
+	OpenAIKeyEnv     string            `json:"openaiKeyEnv"`
+	IncidentModels   map[string]string `json:"incidentModels"`
+	StructuredOutput *bool             `json:"structuredOutput"`
+}
+
+type cachedTenant struct {
+	name    string
+	fetched time.Time
+}
+
+var (
+	tenantClient kubernetes.Interface
+
+	tenantCacheMu sync.Mutex
+	tenantCache   = map[string]cachedTenant{}
+)
+
+func watchTenants(clientset kubernetes.Interface) {
+	tenantClient = clientset
+	if n := len(cfg().Tenants); n > 0 {
+		log.Printf("🏢 Serving %d tenant(s), selected by the %s namespace label", n, cfg().TenantLabel)
+	}
+}
+
+// tenantFor returns the tenant a namespace belongs to, or "" for the global
+// config. A tenant's namespaces list wins over the namespace label.
+func tenantFor(config *Config, namespace string) string {
+	if len(config.Tenants) == 0 {
+		return ""
+	}
+	for name, t := range config.Tenants {
+		if containsString(t.Namespaces, namespace) {
+			return name
+		}
+	}
+	if config.TenantLabel == "" || tenantClient == nil || !allowed("", "get", "namespaces") {
+		return ""
+	}
+
+	tenantCacheMu.Lock()
+	c, ok := tenantCache[namespace]
+	tenantCacheMu.Unlock()
+	if ok && time.Since(c.fetched) < TENANT_CACHE_TTL {
+		return c.name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ns, err := tenantClient.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
+	if err != nil {
+		log.Printf("⚠️ Failed to get namespace %s for its tenant: %v", namespace, err)
+		return c.name
+	}
+	name := ns.Labels[config.TenantLabel]
+	if _, known := config.Tenants[name]; name != "" && !known {
+		log.Printf("⚠️ Namespace %s has unknown tenant %q, using the global config", namespace, name)
+		name = ""
+	}
+	tenantCacheMu.Lock()
+	tenantCache[namespace] = cachedTenant{name: name, fetched: time.Now()}
+	tenantCacheMu.Unlock()
+	return name
+}
+
+// forNamespace returns the config for incidents in a namespace: a copy with
+// the tenant's channel and model if it belongs to one, or the config itself.
+func (c *Config) forNamespace(namespace string) *Config {
+	name := tenantFor(c, namespace)
+	if name == "" {
+		return c
+	}
+	t := c.Tenants[name]
+	copied := *c
+	copied.tenant = name
+	if t.SlackChannel != "" {
+		copied.SlackChannel = t.SlackChannel
+	}
+	// A tenant with its own model endpoint does not inherit the global
+	// per-type models, which may not exist there.
+	if t.Provider != "" || t.OllamaAPI != "" || t.OpenAIAPI != "" || t.OllamaModel != "" || t.OpenAIModel != "" {
+		copied.IncidentModels = t.IncidentModels
+	}
+	if t.Provider != "" {
+		copied.Provider = t.Provider
+	}
+	if t.OllamaAPI != "" {
+		copied.OllamaAPI = t.OllamaAPI
+	}
+	if t.OllamaModel != "" {
+		copied.OllamaModel = t.OllamaModel
+	}
+	if t.OpenAIAPI != "" {
+		copied.OpenAIAPI = t.OpenAIAPI
+	}
+	if t.OpenAIModel != "" {
+		copied.OpenAIModel = t.OpenAIModel
+	}
+	if t.StructuredOutput != nil {
+		copied.StructuredOutput = *t.StructuredOutput
+	}
+	return &copied
+}
+
+// channelFor addresses a channel in the config's Slack workspace. Channels
+// of tenants carry the tenant as a prefix, "tenant/#channel", so every later
+// post to the incident's channel uses that tenant's token.
+func (c *Config) channelFor(channel string) string {
+	return tenantChannel(c.tenant, channel)
+}
+
+func tenantChannel(tenant, channel string) string {
+	if tenant == "" || channel == "" || strings.Contains(channel, "/") {
+		return channel
+	}
+	return tenant + "/" + channel
+}
+
+// slackCredentials splits a channel address into the Slack channel and the
+// bot token of its workspace.
+func slackCredentials(address string) (channel, token string) {
+	if i := strings.Index(address, "/"); i >= 0 {
+		if t, ok := cfg().Tenants[address[:i]]; ok {
+			if t.SlackTokenEnv == "" {
+				return address[i+1:], os.Getenv("SLACK_BOT_TOKEN")
+			}
+			return address[i+1:], os.Getenv(t.SlackTokenEnv)
+		}
+	}
+	return address, os.Getenv("SLACK_BOT_TOKEN")
+}
+
+// openAIKey returns the API key for the config's tenant, falling back to
+// OPENAI_API_KEY.
+func (c *Config) openAIKey() string {
+	if t, ok := c.Tenants[c.tenant]; ok && t.OpenAIKeyEnv != "" {
+		return os.Getenv(t.OpenAIKeyEnv)
+	}
+	return os.Getenv("OPENAI_API_KEY")
+}
+
+// signingSecrets lists the Slack signing secrets to verify interactions
+// with, by tenant; "" is the global app.
+func signingSecrets() map[string]string {
+	secrets := map[string]string{}
+	if s := os.Getenv("SLACK_SIGNING_SECRET"); s != "" {
+		secrets[""] = s
+	}
+	for name, t := range cfg().Tenants {
+		if t.SlackSigningEnv == "" {
+			continue
+		}
+		if s := os.Getenv(t.SlackSigningEnv); s != "" {
+			secrets[name] = s
+		}
+	}
+	return secrets
+}
+
+// apiTokens lists the bearer tokens the API accepts, by tenant; "" is
+// API_TOKEN, which may see every namespace.
+func apiTokens() map[string]string {
+	tokens := map[string]string{}
+	if t := os.Getenv("API_TOKEN"); t != "" {
+		tokens[""] = t
+	}
+	for name, t := range cfg().Tenants {
+		if t.APITokenEnv == "" {
+			continue
+		}
+		if s := os.Getenv(t.APITokenEnv); s != "" {
+			tokens[name] = s
+		}
+	}
+	return tokens
+}
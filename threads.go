@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	THREAD_CONFIGMAP = "pod-analyzer-threads"
+	THREAD_EXPIRE    = 24 * time.Hour
+	THREADS_KEY      = "threads.json"
+)
+
+// ThreadConfig controls posting repeated detections of the same ongoing
+// incident into its first Slack thread instead of new messages.
+type ThreadConfig struct {
+	Reuse     bool        `json:"reuse"`
+	ConfigMap string      `json:"configMap"`
+	Expire    v1.Duration `json:"expire"`
+}
+
+// slackThread is the Slack thread of an ongoing incident, keyed by its crash
+// signature.
+type slackThread struct {
+	Channel    string    `json:"channel"`
+	TS         string    `json:"ts"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+	Detections int       `json:"detections"`
+	Restarts   int32     `json:"restarts"`
+}
+
+var (
+	threadsMu   sync.Mutex
+	threads     = map[string]*slackThread{}
+	threadStore kubernetes.Interface
+)
+
+// loadThreads restores the thread mapping, and the tracker issues of
+// recurring crashes, from the ConfigMap in the analyzer's namespace, so a
+// restart keeps posting into the same threads and issues.
+func loadThreads(clientset kubernetes.Interface) {
+	threadStore = clientset
+	name := cfg().Threads.ConfigMap
+	if name == "" {
+		return
+	}
+	cm, err := clientset.CoreV1().ConfigMaps(ownNamespace()).Get(context.Background(), name, v1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Printf("⚠️ Failed to load Slack threads from ConfigMap %s: %v", name, err)
+		}
+		return
+	}
+	loadIssues(cm)
+	if cm.Data[THREADS_KEY] == "" {
+		return
+	}
+	restored := map[string]*slackThread{}
+	if err := json.Unmarshal([]byte(cm.Data[THREADS_KEY]), &restored); err != nil {
+		log.Printf("⚠️ Invalid Slack threads in ConfigMap %s: %v", name, err)
+		return
+	}
+	threadsMu.Lock()
+	threads = restored
+	threadsMu.Unlock()
+	log.Printf("🧵 Restored %d Slack thread(s) of ongoing incidents", len(restored))
+}
+
+// activeThread returns the thread of the ongoing incident with the
+// signature, or nil if there is none or it went quiet for too long.
+func activeThread(config *Config, signature string) *slackThread {
+	if !config.Threads.Reuse {
+		return nil
+	}
+	threadsMu.Lock()
+	defer threadsMu.Unlock()
+	t, ok := threads[signature]
+	if !ok || time.Since(t.Last) > config.Threads.Expire.Duration {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
+
+// touchThread records another detection in the signature's thread, creating
+// the mapping on the first one, and returns the updated thread.
+func touchThread(config *Config, signature, channel, ts string, restarts int32) *slackThread {
+	if !config.Threads.Reuse || ts == "" {
+		return nil
+	}
+	threadsMu.Lock()
+	now := time.Now()
+	for sig, t := range threads {
+		if now.Sub(t.Last) > config.Threads.Expire.Duration {
+			delete(threads, sig)
+		}
+	}
+	t, ok := threads[signature]
+	if !ok || t.TS != ts {
+		t = &slackThread{Channel: channel, TS: ts, First: now}
+		threads[signature] = t
+	}
+	t.Last = now
+	t.Detections++
+	t.Restarts = restarts
+	copied := *t
+	threadsMu.Unlock()
+
+	saveThreads(config)
+	return &copied
+}
+
+// forgetThread ends the thread of a resolved incident; the next failure
+// starts a new one.
+func forgetThread(config *Config, signature string) {
+	threadsMu.Lock()
+	_, ok := threads[signature]
+	delete(threads, signature)
+	threadsMu.Unlock()
+	if ok {
+		saveThreads(config)
+	}
+}
+
+func saveThreads(config *Config) {
+	name := config.Threads.ConfigMap
+	if name == "" || threadStore == nil || *dryRun || *readOnly {
+		return
+	}
+	threadsMu.Lock()
+	data, _ := json.Marshal(threads)
+	threadsMu.Unlock()
+
+	if err := storeInConfigMap(name, THREADS_KEY, data); err != nil {
+		log.Printf("⚠️ Failed to save Slack threads to ConfigMap %s: %v", name, err)
+	}
+}
+
+// storeInConfigMap writes one key of the state ConfigMap, leaving the
+// others alone, and creates the ConfigMap if it does not exist yet.
+func storeInConfigMap(name, key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := threadStore.CoreV1().ConfigMaps(ownNamespace())
+	cm, err := client.Get(ctx, name, v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{Name: name, Labels: map[string]string{"app.kubernetes.io/name": "pod-analyzer"}},
+			Data:       map[string]string{key: string(data)},
+		}
+		_, err = client.Create(ctx, cm, v1.CreateOptions{})
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[key] = string(data)
+		_, err = client.Update(ctx, cm, v1.UpdateOptions{})
+	}
+	return err
+}
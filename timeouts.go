@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ANALYSIS_TIMEOUT = 10 * time.Minute
+	LOGS_TIMEOUT     = 30 * time.Second
+	EVENTS_TIMEOUT   = 15 * time.Second
+	MODEL_TIMEOUT    = 5 * time.Minute
+	SLACK_TIMEOUT    = 10 * time.Second
+)
+
+// TimeoutConfig bounds each step of an analysis; 0 means no deadline for
+// that step beyond the whole analysis.
+type TimeoutConfig struct {
+	Analysis v1.Duration `json:"analysis"`
+	Logs     v1.Duration `json:"logs"`
+	Events   v1.Duration `json:"events"`
+	Model    v1.Duration `json:"model"`
+	Slack    v1.Duration `json:"slack"`
+}
+
+type runningAnalysis struct {
+	restart time.Time
+	cancel  context.CancelFunc
+}
+
+var (
+	analysesMu sync.Mutex
+	analyses   = map[string]*runningAnalysis{}
+)
+
+// within derives a context with the step's timeout, or just a cancelable
+// one if the timeout is unset.
+func within(parent context.Context, timeout v1.Duration) (context.Context, context.CancelFunc) {
+	if timeout.Duration <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout.Duration)
+}
+
+// startAnalysis returns the context for analyzing a container's restart,
+// cancelling an analysis of an earlier restart of the same container that
+// is still running: the newer restart supersedes it. Analyses of the same
+// restart run side by side. done must be called when the analysis ends.
+func startAnalysis(key string, restart time.Time, timeout v1.Duration) (ctx context.Context, done func()) {
+	ctx, cancel := within(context.Background(), timeout)
+	run := &runningAnalysis{restart: restart, cancel: cancel}
+
+	analysesMu.Lock()
+	if prev, ok := analyses[key]; !ok {
+		analyses[key] = run
+	} else if restart.After(prev.restart) {
+		log.Printf("⏹️ Cancelling the running analysis of %s, superseded by a newer restart", key)
+		prev.cancel()
+		analyses[key] = run
+	}
+	analysesMu.Unlock()
+
+	return ctx, func() {
+		analysesMu.Lock()
+		if analyses[key] == run {
+			delete(analyses, key)
+		}
+		analysesMu.Unlock()
+		cancel()
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+const (
+	CONTEXT_TOKENS   = 8192
+	RESPONSE_TOKENS  = 1024
+	MIN_CHUNK_TOKENS = 256
+
+	SUMMARY_PROMPT = `Condense the following %s from a Kubernetes incident to at most %d words for a root-cause analysis. Keep exact error messages, exit codes, status codes, resource names and timestamps of the first and last failure; drop repetitive or informational lines.
+
+%s`
+)
+
+// Rough characters-per-token ratios by model family; logs tokenize worse
+// than prose, so these sit below the usual ~4 for English text.
+var charsPerToken = map[string]float64{
+	"llama":   3.4,
+	"mistral": 3.2,
+	"mixtral": 3.2,
+	"qwen":    3.1,
+	"gemma":   3.6,
+	"phi":     3.3,
+	"gpt":     3.6,
+	"claude":  3.5,
+}
+
+func estimateTokens(model, text string) int {
+	ratio := 3.3
+	family := strings.ToLower(model)
+	for prefix, r := range charsPerToken {
+		if strings.HasPrefix(family, prefix) {
+			ratio = r
+			break
+		}
+	}
+	return int(math.Ceil(float64(len(text)) / ratio))
+}
+
+type promptSection struct {
+	name   string
+	text   *string
+	weight int
+	// keepHead trims from the end instead of the start, for sections whose
+	// beginning matters more than their latest lines.
+	keepHead bool
+}
+
+// contextTokens is the prompt budget for the configured model.
+func (c *Config) contextTokens() int {
+	if n, ok := c.ModelContextTokens[c.model()]; ok && n > 0 {
+		return n
+	}
+	if c.ContextTokens > 0 {
+		return c.ContextTokens
+	}
+	return CONTEXT_TOKENS
+}
+
+// fitPromptData shrinks the sections of a templated prompt so the whole
+// rendered prompt fits the model's context window.
+func fitPromptData(ctx context.Context, config *Config, t *template.Template, data *PromptData) {
+	overhead := estimateTokens(config.model(), renderPrompt(t, PromptData{Type: data.Type}))
+	budgetSections(ctx, config, overhead, []promptSection{
+		{name: "recent changes", text: &data.Changes, weight: 1, keepHead: true},
+		{name: "delivery", text: &data.Delivery, weight: 1, keepHead: true},
+		{name: "previous incidents", text: &data.History, weight: 1, keepHead: true},
+		{name: "registry probe", text: &data.Registry, weight: 1, keepHead: true},
+		{name: "events", text: &data.Events, weight: 2},
+		{name: "resource usage", text: &data.Resources, weight: 1, keepHead: true},
+		{name: "probe configuration", text: &data.Probes, weight: 1, keepHead: true},
+		{name: "storage status", text: &data.Storage, weight: 1, keepHead: true},
+		{name: "autoscaler", text: &data.Autoscaler, weight: 1, keepHead: true},
+		{name: "healthy replica", text: &data.Replica, weight: 1, keepHead: true},
+		{name: "network context", text: &data.Network, weight: 1, keepHead: true},
+		{name: "enrichment", text: &data.Enrichment, weight: 1, keepHead: true},
+		{name: "runbooks", text: &data.Runbooks, weight: 1, keepHead: true},
+		{name: "error lines and stack traces", text: &data.Errors, weight: 3},
+		{name: "container logs", text: &data.Logs, weight: 4},
+	})
+}
+
+// budgetSections shares the tokens left after the fixed prompt text between
+// the sections by weight. Sections under their share keep everything and
+// pass the rest on; sections over it are summarized by the model (or cut at
+// a line boundary if summarizing fails) to fit.
+func budgetSections(ctx context.Context, config *Config, overhead int, sections []promptSection) {
+	model := config.model()
+	available := config.contextTokens() - config.responseTokens() - overhead - estimateTokens(model, config.ModelParams.SystemPrompt)
+	if available < 256 {
+		available = 256
+	}
+
+	sizes := make([]int, len(sections))
+	total := 0
+	for i, s := range sections {
+		sizes[i] = estimateTokens(model, *s.text)
+		total += sizes[i]
+	}
+	if total <= available {
+		return
+	}
+
+	order := make([]int, len(sections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return float64(sizes[order[a]])/float64(sections[order[a]].weight) < float64(sizes[order[b]])/float64(sections[order[b]].weight)
+	})
+
+	remaining, weights := available, 0
+	for _, s := range sections {
+		weights += s.weight
+	}
+	for _, i := range order {
+		s := sections[i]
+		share := remaining * s.weight / weights
+		weights -= s.weight
+		if sizes[i] <= share {
+			remaining -= sizes[i]
+			continue
+		}
+		*s.text = shrinkSection(ctx, config, s, share)
+		remaining -= estimateTokens(model, *s.text)
+	}
+}
+
+func shrinkSection(ctx context.Context, config *Config, s promptSection, tokens int) string {
+	if config.SummarizeOverflow {
+		summary, err := summarizeSection(ctx, config, s.name, *s.text, tokens)
+		if err == nil && estimateTokens(config.model(), summary) <= tokens {
+			return "(summarized) " + summary
+		}
+		if err != nil {
+			log.Printf("⚠️ Failed to summarize %s, truncating instead: %v", s.name, err)
+		}
+	}
+	return trimToTokens(config.model(), *s.text, tokens, s.keepHead)
+}
+
+// summarizeSection asks the model to condense a section, first splitting it
+// into chunks that each fit the context window.
+func summarizeSection(ctx context.Context, config *Config, name, text string, tokens int) (string, error) {
+	model := config.model()
+	chunkTokens := config.contextTokens() - config.responseTokens() - estimateTokens(model, SUMMARY_PROMPT+config.ModelParams.SystemPrompt) - 64
+	if chunkTokens < MIN_CHUNK_TOKENS {
+		// A long system prompt or response budget would otherwise leave
+		// room for a line or two per call, or none at all.
+		chunkTokens = MIN_CHUNK_TOKENS
+	}
+	chunks := splitByTokens(model, text, chunkTokens)
+	words := tokens * 3 / 4 / len(chunks)
+	if words < 20 {
+		words = 20
+	}
+
+	var parts []string
+	for _, chunk := range chunks {
+		summary, err := callModel(ctx, config, fmt.Sprintf(SUMMARY_PROMPT, name, words, chunk))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, strings.TrimSpace(summary))
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+func splitByTokens(model, text string, tokens int) []string {
+	var chunks []string
+	var cur []string
+	used := 0
+	for _, line := range strings.Split(text, "\n") {
+		n := estimateTokens(model, line) + 1
+		if used+n > tokens && len(cur) > 0 {
+			chunks = append(chunks, strings.Join(cur, "\n"))
+			cur, used = nil, 0
+		}
+		cur = append(cur, line)
+		used += n
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, strings.Join(cur, "\n"))
+	}
+	return chunks
+}
+
+// trimToTokens cuts whole lines, keeping the end of the text (the most
+// recent lines) unless keepHead is set. A single line longer than the
+// budget, like a stack trace or JSON record logged on one line, is cut
+// inside instead of dropped.
+func trimToTokens(model, text string, tokens int, keepHead bool) string {
+	lines := strings.Split(text, "\n")
+	var kept []string
+	cut := false
+	used := estimateTokens(model, "[... lines omitted ...]\n")
+	for i := range lines {
+		idx := len(lines) - 1 - i
+		if keepHead {
+			idx = i
+		}
+		n := estimateTokens(model, lines[idx]) + 1
+		if used+n > tokens {
+			if len(kept) == 0 && tokens > used {
+				kept, cut = []string{cutLine(lines[idx], (tokens-used)*len(lines[idx])/n, keepHead)}, true
+			}
+			break
+		}
+		used += n
+		if keepHead {
+			kept = append(kept, lines[idx])
+		} else {
+			kept = append([]string{lines[idx]}, kept...)
+		}
+	}
+	if len(kept) == len(lines) && !cut {
+		return text
+	}
+	if keepHead {
+		return strings.Join(kept, "\n") + "\n[... lines omitted ...]"
+	}
+	return "[... lines omitted ...]\n" + strings.Join(kept, "\n")
+}
+
+// cutLine shortens a line to at most n bytes, keeping its start or its end.
+func cutLine(line string, n int, keepHead bool) string {
+	if keepHead {
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		return line[:n] + " …"
+	}
+	start := len(line) - n
+	for start < len(line) && !utf8.RuneStart(line[start]) {
+		start++
+	}
+	return "… " + line[start:]
+}
+
+func (c *Config) responseTokens() int {
+	if c.ModelParams.MaxTokens > 0 {
+		return c.ModelParams.MaxTokens
+	}
+	if c.ResponseTokens > 0 {
+		return c.ResponseTokens
+	}
+	return RESPONSE_TOKENS
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const USAGE_RETENTION = 8 * 24 * time.Hour
+
+// errBudgetSpent is returned for model calls refused by the daily token
+// budget. Unlike an unreachable model, retrying before midnight is useless.
+var errBudgetSpent = errors.New("daily token budget spent")
+
+// UsageConfig caps how many tokens the model may spend per day and prices
+// them for the cost metrics. Prices are per 1000 tokens and matched by model
+// name prefix, like modelContextTokens.
+type UsageConfig struct {
+	DailyTokenBudget int                   `json:"dailyTokenBudget"`
+	Prices           map[string]ModelPrice `json:"prices"`
+}
+
+type ModelPrice struct {
+	Prompt   float64 `json:"prompt"`
+	Response float64 `json:"response"`
+}
+
+// modelUsage is one call to the model. Estimated is set when the provider
+// did not report token counts and they were derived from the text length.
+type modelUsage struct {
+	Time      time.Time
+	Namespace string
+	Provider  string
+	Model     string
+	Prompt    int
+	Response  int
+	Estimated bool
+}
+
+// analysisUsage adds up the tokens of all model calls made for one analysis.
+type analysisUsage struct {
+	mu        sync.Mutex
+	namespace string
+	prompt    int
+	response  int
+}
+
+type usageKey struct{}
+
+type usageTotal struct {
+	Calls    int
+	Prompt   int
+	Response int
+	Cost     float64
+}
+
+var (
+	usageMu       sync.Mutex
+	usageLog      []modelUsage
+	usageTotals   = map[[3]string]*usageTotal{}
+	budgetWarned  string
+	budgetRefused int
+)
+
+// withUsage returns a context that attributes the model calls made with it
+// to the namespace and counts their tokens.
+func withUsage(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, usageKey{}, &analysisUsage{namespace: namespace})
+}
+
+// usageOf returns the tokens used so far by the analysis of the context.
+func usageOf(ctx context.Context) (prompt, response int) {
+	u, _ := ctx.Value(usageKey{}).(*analysisUsage)
+	if u == nil {
+		return 0, 0
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.prompt, u.response
+}
+
+// recordUsage accounts one model call. Counts of zero or less are estimated
+// from the prompt and answer.
+func recordUsage(ctx context.Context, config *Config, prompt, answer string, promptTokens, responseTokens int) {
+	u := modelUsage{Time: time.Now(), Provider: config.Provider, Model: config.model(), Prompt: promptTokens, Response: responseTokens}
+	if u.Prompt <= 0 {
+		u.Prompt, u.Estimated = estimateTokens(u.Model, prompt), true
+	}
+	if u.Response <= 0 {
+		u.Response, u.Estimated = estimateTokens(u.Model, answer), true
+	}
+	if a, _ := ctx.Value(usageKey{}).(*analysisUsage); a != nil {
+		a.mu.Lock()
+		a.prompt += u.Prompt
+		a.response += u.Response
+		a.mu.Unlock()
+		u.Namespace = a.namespace
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	cutoff := time.Now().Add(-USAGE_RETENTION)
+	kept := usageLog[:0]
+	for _, r := range usageLog {
+		if r.Time.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	usageLog = append(kept, u)
+
+	key := [3]string{u.Namespace, u.Provider, u.Model}
+	t := usageTotals[key]
+	if t == nil {
+		t = &usageTotal{}
+		usageTotals[key] = t
+	}
+	t.Calls++
+	t.Prompt += u.Prompt
+	t.Response += u.Response
+	t.Cost += config.cost(u.Model, u.Prompt, u.Response)
+}
+
+// cost prices the tokens with the longest matching prefix in usage.prices.
+func (c *Config) cost(model string, prompt, response int) float64 {
+	var price ModelPrice
+	matched := -1
+	for prefix, p := range c.Usage.Prices {
+		if strings.HasPrefix(strings.ToLower(model), strings.ToLower(prefix)) && len(prefix) > matched {
+			price, matched = p, len(prefix)
+		}
+	}
+	return (float64(prompt)*price.Prompt + float64(response)*price.Response) / 1000
+}
+
+// tokensToday returns the tokens spent since local midnight.
+func tokensToday() int {
+	y, m, d := time.Now().Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	total := 0
+	for _, u := range usageSince(midnight) {
+		total += u.Prompt + u.Response
+	}
+	return total
+}
+
+// checkTokenBudget refuses model calls once the daily budget is spent, so
+// analyses fall back to the heuristics until midnight.
+func checkTokenBudget(config *Config) error {
+	budget := config.Usage.DailyTokenBudget
+	if budget <= 0 {
+		return nil
+	}
+	used := tokensToday()
+	if used < budget {
+		return nil
+	}
+	today := time.Now().Format("2006-01-02")
+	usageMu.Lock()
+	budgetRefused++
+	warn := budgetWarned != today
+	budgetWarned = today
+	usageMu.Unlock()
+	if warn {
+		log.Printf("💸 Daily token budget of %d spent (%d used), analyzing with heuristics only until midnight", budget, used)
+	}
+	return fmt.Errorf("%w (%d tokens)", errBudgetSpent, budget)
+}
+
+func overTokenBudget(config *Config) bool {
+	return config.Usage.DailyTokenBudget > 0 && tokensToday() >= config.Usage.DailyTokenBudget
+}
+
+func usageSince(since time.Time) []modelUsage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	var list []modelUsage
+	for _, u := range usageLog {
+		if u.Time.After(since) {
+			list = append(list, u)
+		}
+	}
+	return list
+}
+
+// usageDigest summarizes the model usage for the digest report.
+func usageDigest(config *Config, list []modelUsage) string {
+	if len(list) == 0 {
+		return ""
+	}
+	tokens := map[string]int{}
+	providers := map[string]int{}
+	prompt, response, estimated := 0, 0, false
+	cost := 0.0
+	for _, u := range list {
+		namespace := u.Namespace
+		if namespace == "" {
+			namespace = "(cluster)"
+		}
+		tokens[namespace] += u.Prompt + u.Response
+		providers[u.Provider+"/"+u.Model] += u.Prompt + u.Response
+		prompt += u.Prompt
+		response += u.Response
+		estimated = estimated || u.Estimated
+		cost += config.cost(u.Model, u.Prompt, u.Response)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n*Model usage:* %d calls, %d prompt + %d response tokens", len(list), prompt, response)
+	if cost > 0 {
+		fmt.Fprintf(&b, ", ~$%.2f", cost)
+	}
+	if estimated {
+		b.WriteString(" (partly estimated)")
+	}
+	b.WriteString("\n")
+	for _, kv := range topCounts(providers, 0) {
+		fmt.Fprintf(&b, "• `%s` — %d tokens\n", kv.key, kv.count)
+	}
+	b.WriteString("*Tokens by namespace:*\n")
+	for _, kv := range topCounts(tokens, DIGEST_TOP_N) {
+		fmt.Fprintf(&b, "• `%s` — %d\n", kv.key, kv.count)
+	}
+	if budget := config.Usage.DailyTokenBudget; budget > 0 {
+		fmt.Fprintf(&b, "Daily budget: %d of %d tokens used today\n", tokensToday(), budget)
+	}
+	return b.String()
+}
+
+func writeUsageMetrics(b *strings.Builder, config *Config) {
+	usageMu.Lock()
+	keys := make([][3]string, 0, len(usageTotals))
+	for k := range usageTotals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "|") < strings.Join(keys[j][:], "|")
+	})
+	totals := make([]usageTotal, len(keys))
+	for i, k := range keys {
+		totals[i] = *usageTotals[k]
+	}
+	refused := budgetRefused
+	usageMu.Unlock()
+
+	labels := func(k [3]string) string {
+		return fmt.Sprintf("namespace=%q,provider=%q,model=%q", k[0], k[1], k[2])
+	}
+	b.WriteString("# HELP pod_analyzer_model_calls_total Model calls by namespace, provider and model.\n")
+	b.WriteString("# TYPE pod_analyzer_model_calls_total counter\n")
+	for i, k := range keys {
+		fmt.Fprintf(b, "pod_analyzer_model_calls_total{%s} %d\n", labels(k), totals[i].Calls)
+	}
+	b.WriteString("# HELP pod_analyzer_model_tokens_total Tokens sent to and generated by the model; estimated from characters when the provider does not report them.\n")
+	b.WriteString("# TYPE pod_analyzer_model_tokens_total counter\n")
+	for i, k := range keys {
+		fmt.Fprintf(b, "pod_analyzer_model_tokens_total{%s,kind=\"prompt\"} %d\n", labels(k), totals[i].Prompt)
+		fmt.Fprintf(b, "pod_analyzer_model_tokens_total{%s,kind=\"response\"} %d\n", labels(k), totals[i].Response)
+	}
+	b.WriteString("# HELP pod_analyzer_model_cost_dollars_total Model cost according to usage.prices.\n")
+	b.WriteString("# TYPE pod_analyzer_model_cost_dollars_total counter\n")
+	for i, k := range keys {
+		fmt.Fprintf(b, "pod_analyzer_model_cost_dollars_total{%s} %g\n", labels(k), totals[i].Cost)
+	}
+	b.WriteString("# HELP pod_analyzer_model_tokens_today Tokens used since midnight, counted against usage.dailyTokenBudget.\n")
+	b.WriteString("# TYPE pod_analyzer_model_tokens_today gauge\n")
+	fmt.Fprintf(b, "pod_analyzer_model_tokens_today %d\n", tokensToday())
+	b.WriteString("# HELP pod_analyzer_model_budget_exceeded Whether the daily token budget is spent and only heuristics run.\n")
+	b.WriteString("# TYPE pod_analyzer_model_budget_exceeded gauge\n")
+	exceeded := 0
+	if overTokenBudget(config) {
+		exceeded = 1
+	}
+	fmt.Fprintf(b, "pod_analyzer_model_budget_exceeded %d\n", exceeded)
+	b.WriteString("# HELP pod_analyzer_model_budget_refused_total Model calls refused because the daily token budget was spent.\n")
+	b.WriteString("# TYPE pod_analyzer_model_budget_refused_total counter\n")
+	fmt.Fprintf(b, "pod_analyzer_model_budget_refused_total %d\n", refused)
+}